@@ -6,6 +6,7 @@ import (
 
 	"github.com/A-Flex-Box/cli/internal/config"
 	"github.com/A-Flex-Box/cli/internal/logger"
+	wh "github.com/A-Flex-Box/cli/internal/wormhole"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/lipgloss/table"
 	"github.com/spf13/cobra"
@@ -47,7 +48,7 @@ func newListCmd(cfg *config.Root) *cobra.Command {
 				if name == active {
 					mark = " *"
 				}
-				rows = append(rows, []string{name + mark, addr})
+				rows = append(rows, []string{name + mark, wh.MaskRelayAddr(addr)})
 			}
 
 			t := table.New().
@@ -73,7 +74,7 @@ func newListCmd(cfg *config.Root) *cobra.Command {
 
 			fmt.Println(t.Render())
 			fmt.Println(lipgloss.NewStyle().Foreground(muted).Render(" * = active"))
-			logger.Info("config.list done", logger.Context("result", map[string]any{"relays": relays})...)
+			logger.Info("config.list done", logger.Context("result", map[string]any{"relays": maskedRelays(relays)})...)
 		},
 	}
 }
@@ -86,7 +87,7 @@ func newUseCmd(cfg *config.Root, mgr *config.Manager) *cobra.Command {
 		Args:    cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			name := args[0]
-			logger.Info("config.use start", logger.Context("params", map[string]any{"name": name, "relays": cfg.Wormhole.Relays})...)
+			logger.Info("config.use start", logger.Context("params", map[string]any{"name": name, "relays": maskedRelays(cfg.Wormhole.Relays)})...)
 			if cfg.Wormhole.Relays[name] == "" {
 				fmt.Printf("Relay '%s' not found\n", name)
 				os.Exit(1)
@@ -107,10 +108,15 @@ func newAddCmd(cfg *config.Root, mgr *config.Manager) *cobra.Command {
 	return &cobra.Command{
 		Use:   "add [name] [addr]",
 		Short: "Add relay alias",
-		Args:  cobra.ExactArgs(2),
+		Example: `  cli config add home tcp://192.168.1.10:9000
+  cli config add team tcp://TOKEN@relay.example.com:9000   # relay started with --token
+  cli config add corp tls://relay.example.com:443
+  cli config add lab tls://10.0.0.5:9443?pin=<sha256>      # relay started with --tls-self-signed
+  cli config add proxied wss://relay.example.com/wormhole  # via HTTPS_PROXY`,
+		Args: cobra.ExactArgs(2),
 		Run: func(cmd *cobra.Command, args []string) {
 			name, addr := args[0], args[1]
-			logger.Info("config.add start", logger.Context("params", map[string]any{"name": name, "addr": addr})...)
+			logger.Info("config.add start", logger.Context("params", map[string]any{"name": name, "addr": wh.MaskRelayAddr(addr)})...)
 			if cfg.Wormhole.Relays == nil {
 				cfg.Wormhole.Relays = make(map[string]string)
 			}
@@ -120,8 +126,8 @@ func newAddCmd(cfg *config.Root, mgr *config.Manager) *cobra.Command {
 				fmt.Printf("Error: %v\n", err)
 				os.Exit(1)
 			}
-			logger.Info("config.add done", logger.Context("result", map[string]any{"name": name, "addr": addr})...)
-			fmt.Printf("Added relay '%s' -> %s\n", name, addr)
+			logger.Info("config.add done", logger.Context("result", map[string]any{"name": name, "addr": wh.MaskRelayAddr(addr)})...)
+			fmt.Printf("Added relay '%s' -> %s\n", name, wh.MaskRelayAddr(addr))
 		},
 	}
 }
@@ -134,7 +140,7 @@ func newRmCmd(cfg *config.Root, mgr *config.Manager) *cobra.Command {
 		Args:    cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			name := args[0]
-			logger.Info("config.rm start", logger.Context("params", map[string]any{"name": name, "relays": cfg.Wormhole.Relays})...)
+			logger.Info("config.rm start", logger.Context("params", map[string]any{"name": name, "relays": maskedRelays(cfg.Wormhole.Relays)})...)
 			if cfg.Wormhole.Relays == nil {
 				cfg.Wormhole.Relays = make(map[string]string)
 			}
@@ -149,3 +155,12 @@ func newRmCmd(cfg *config.Root, mgr *config.Manager) *cobra.Command {
 		},
 	}
 }
+
+// maskedRelays copies relays with access tokens hidden, for logging.
+func maskedRelays(relays map[string]string) map[string]string {
+	out := make(map[string]string, len(relays))
+	for name, addr := range relays {
+		out[name] = wh.MaskRelayAddr(addr)
+	}
+	return out
+}
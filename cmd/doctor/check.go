@@ -91,6 +91,14 @@ func parseRelayAddr(addr string) (host, port string) {
 	addr = strings.TrimSpace(addr)
 	addr = strings.TrimPrefix(addr, "tcp://")
 	addr = strings.TrimPrefix(addr, "tls://")
+	addr = strings.TrimPrefix(addr, "wss://")
+	addr = strings.TrimPrefix(addr, "ws://")
+	if i := strings.IndexAny(addr, "/?"); i >= 0 {
+		addr = addr[:i] // drop WebSocket path and ?pin=
+	}
+	if i := strings.LastIndexByte(addr, '@'); i >= 0 {
+		addr = addr[i+1:] // drop access token
+	}
 	host, port, err := net.SplitHostPort(addr)
 	if err != nil {
 		if strings.Contains(addr, ":") {
@@ -16,7 +16,7 @@ func newPortCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:     "port [port]",
 		Short:   "Deep analysis of a local port (Process + Protocol)",
-		Long:    `Inspect who is using the port, connect to it, grab banner and detect protocol.`,
+		Long:    `Inspect who is using the port, connect to it, grab banner and detect protocol (HTTP, TLS with version, ALPN and certificate name, SSH, MySQL, PostgreSQL, VNC, ...).`,
 		Example: "cli doctor port 8080",
 		Args:    cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -47,15 +47,13 @@ func runPort(port int) error {
 	}
 
 	// 2. Connect and probe
-	banner := doctor.GrabBanner(target)
-	protocol := instrument.ProtocolTCP
-	if len(banner) > 0 {
-		protocol = instrument.DetectProtocol([]byte(banner))
-	}
+	probe := doctor.Probe(target)
+	banner := probe.Banner
 	logger.Debug("doctor port probe result",
 		zap.String("component", "cmd.doctor.port"),
 		zap.Int("port", port),
-		zap.String("protocol", protocol),
+		zap.String("protocol", probe.Detection.Protocol),
+		zap.String("details", probe.Detection.Summary()),
 		zap.String("banner", instrument.TruncateForDisplay([]byte(banner), 80)))
 
 	// 3. Output
@@ -84,7 +82,10 @@ func runPort(port int) error {
 		lines = append(lines, "  Process:  (port not in use or not detected)")
 	}
 
-	lines = append(lines, fmt.Sprintf("  Protocol: %s", protocol))
+	lines = append(lines, fmt.Sprintf("  Protocol: %s", probe.Detection.Protocol))
+	if details := probe.Detection.Summary(); details != "" {
+		lines = append(lines, fmt.Sprintf("  Details:  %s", details))
+	}
 	if banner != "" {
 		bannerShort := instrument.TruncateForDisplay([]byte(banner), 80)
 		lines = append(lines, fmt.Sprintf("  Banner:   %s", bannerShort))
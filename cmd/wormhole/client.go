@@ -1,36 +1,57 @@
 package wormhole
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/A-Flex-Box/cli/internal/config"
 	"github.com/A-Flex-Box/cli/internal/logger"
 	wh "github.com/A-Flex-Box/cli/internal/wormhole"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 func newSendCmd(cfg *config.WormholeConfig) *cobra.Command {
-	var code string
+	var code, name, limitStr string
+	var noDirect, noCompress, verify, mailbox bool
+	var ttl time.Duration
 
 	cmd := &cobra.Command{
-		Use:     "send [file|text] [path|content]",
-		Short:   "Send file or text",
-		Long:    "wormhole send file <path>  - send a file\nwormhole send text <content> - send text",
-		Example: "cli wormhole send file ./report.pdf\n  cli wormhole send text 'Hello'",
-		Args:    cobra.MinimumNArgs(2),
+		Use:     "send [file|text] [path...|content] | send -",
+		Short:   "Send files, directories, text or stdin",
+		Long:    "wormhole send file <path>...  - send a file, or several files/directories as one bundle\nwormhole send text <content>  - send text\nwormhole send -                - stream stdin until EOF (size unknown; shows throughput)\n\nWith --mailbox the payload is encrypted and left on the relay for a receiver that is offline;\nthey fetch it later with 'cli wormhole receive <code>' until --ttl runs out. The relay must run with --mailbox-dir.",
+		Example: "cli wormhole send file ./report.pdf\n  cli wormhole send file ./build ./notes.md\n  cli wormhole send file ./disk.img --limit 5MB/s\n  cli wormhole send text 'Hello'\n  tar c . | cli wormhole send - --name project.tar\n  cli wormhole send file ./report.pdf --mailbox --ttl 24h",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 && args[0] == "-" {
+				return nil
+			}
+			return cobra.MinimumNArgs(2)(cmd, args)
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 			relayAddr := cfg.GetActiveRelayAddr()
 			logger.Info("wormhole.send cmd start", logger.Context("params", map[string]any{
-				"relay_addr": relayAddr, "active_relay": cfg.ActiveRelay, "args": args,
+				"relay_addr": wh.MaskRelayAddr(relayAddr), "active_relay": cfg.ActiveRelay, "args": args,
 			})...)
 			if relayAddr == "" {
 				fmt.Println("No active relay. Run: cli config use <name>")
 				os.Exit(1)
 			}
 
-			pairCode := code
+			limit := parseLimit(limitStr)
+			if ttl < 0 || (ttl > 0 && !mailbox) {
+				fmt.Println("--ttl must be positive and is only used with --mailbox")
+				os.Exit(1)
+			}
+			if mailbox {
+				sendMailbox(relayAddr, wh.NormalizeCode(code), args, name, ttl, limit)
+				return
+			}
+			pairCode := wh.NormalizeCode(code)
 			if pairCode == "" {
 				pairCode = wh.GenerateCode()
 				fmt.Printf("Your code: %s (share with receiver)\n", pairCode)
@@ -38,16 +59,64 @@ func newSendCmd(cfg *config.WormholeConfig) *cobra.Command {
 
 			mode := args[0]
 			switch mode {
+			case "-":
+				title := "Streaming stdin"
+				if name != "" {
+					title = "Streaming: " + name
+				}
+				err := runStreamUI(title, pairCode, nil, os.Stdout, true, func(opts *wh.TransferOptions) error {
+					opts.NoDirect = noDirect
+					opts.VerifySAS = verify
+					opts.NoCompress = noCompress
+					opts.Limit.SetRate(limit)
+					return wh.SendStream(relayAddr, pairCode, os.Stdin, name, opts)
+				})
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
 			case "file":
-				filePath := args[1]
-				info, err := os.Stat(filePath)
+				paths := args[1:]
+				info, err := os.Stat(paths[0])
 				if err != nil {
 					fmt.Printf("Error: %v\n", err)
 					os.Exit(1)
 				}
-				title := "Sending: " + filepath.Base(filePath)
-				err = wh.RunTransferUI(title, info.Size(), pairCode, nil, func(onProgress func(int64, int64)) error {
-					return wh.SendFile(relayAddr, pairCode, filePath, onProgress)
+				if len(paths) == 1 && info.Mode().IsRegular() {
+					filePath := paths[0]
+					title := "Sending: " + filepath.Base(filePath)
+					err = wh.RunTransferUI(title, info.Size(), pairCode, nil, func(opts *wh.TransferOptions) error {
+						opts.NoDirect = noDirect
+						opts.VerifySAS = verify
+						opts.NoCompress = noCompress
+						opts.Limit.SetRate(limit)
+						return wh.SendFile(relayAddr, pairCode, filePath, opts)
+					})
+					if err != nil {
+						fmt.Printf("Error: %v\n", err)
+						if !errors.Is(err, wh.ErrRejected) && !errors.Is(err, wh.ErrIncompatiblePeer) {
+							fmt.Printf("Re-run both sides with -c %s to resume the transfer.\n", pairCode)
+						}
+						os.Exit(1)
+					}
+					return
+				}
+				for _, p := range paths[1:] {
+					if _, err := os.Lstat(p); err != nil {
+						fmt.Printf("Error: %v\n", err)
+						os.Exit(1)
+					}
+				}
+				title := "Sending: " + filepath.Base(filepath.Clean(paths[0]))
+				if len(paths) > 1 {
+					title = fmt.Sprintf("Sending: %d items", len(paths))
+				}
+				err = wh.RunTransferUI(title, 0, pairCode, nil, func(opts *wh.TransferOptions) error {
+					opts.NoDirect = noDirect
+					opts.VerifySAS = verify
+					opts.NoCompress = noCompress
+					opts.Limit.SetRate(limit)
+					return wh.SendFiles(relayAddr, pairCode, paths, opts)
 				})
 				if err != nil {
 					fmt.Printf("Error: %v\n", err)
@@ -55,11 +124,21 @@ func newSendCmd(cfg *config.WormholeConfig) *cobra.Command {
 				}
 			case "text":
 				text := args[1]
-				if err := wh.SendText(relayAddr, pairCode, text); err != nil {
+				var path *wh.PathInfo
+				var sas *wh.SAS
+				opts := &wh.TransferOptions{
+					NoDirect:   noDirect,
+					Limit:      wh.NewLimiter(limit),
+					OnPath:     func(p wh.PathInfo) { path = &p },
+					OnSAS:      func(s wh.SAS) { sas = &s },
+					ConfirmSAS: confirmSASPrompt,
+					VerifySAS:  verify,
+				}
+				if err := wh.SendText(relayAddr, pairCode, text, opts); err != nil {
 					fmt.Printf("Error: %v\n", err)
 					os.Exit(1)
 				}
-				fmt.Println(wh.RenderSecureBox())
+				fmt.Println(wh.RenderSecureBox(path, sas))
 			default:
 				fmt.Printf("Unknown mode: %s (use file or text)\n", mode)
 				os.Exit(1)
@@ -67,5 +146,107 @@ func newSendCmd(cfg *config.WormholeConfig) *cobra.Command {
 		},
 	}
 	cmd.Flags().StringVarP(&code, "code", "c", "", "Pairing code (generated if empty)")
+	cmd.Flags().StringVar(&name, "name", "", "File name offered for a stdin stream (receivers without --stdout save it under this name)")
+	cmd.Flags().StringVar(&limitStr, "limit", "", "Bandwidth cap, e.g. 5MB/s (adjust with +/- in the UI)")
+	cmd.Flags().BoolVar(&noCompress, "no-compress", false, "Send raw bytes (compression is otherwise offered, except for already-compressed data)")
+	cmd.Flags().BoolVar(&verify, "verify", false, "Require confirming that both sides show the same security code before anything is sent")
+	cmd.Flags().BoolVar(&noDirect, "no-direct", false, "Always go through the relay, even on a shared LAN")
+	cmd.Flags().BoolVar(&mailbox, "mailbox", false, "Leave the payload encrypted on the relay for a receiver that is offline")
+	cmd.Flags().DurationVar(&ttl, "ttl", 0, "With --mailbox: how long the relay keeps the payload (0 = relay default; capped by the relay)")
 	return cmd
 }
+
+// sendMailbox uploads the payload named by args to the relay mailbox and prints
+// the code the receiver fetches it with. code may be empty to generate one.
+func sendMailbox(relayAddr, code string, args []string, name string, ttl time.Duration, limit int64) {
+	if code == "" {
+		code = wh.GenerateMailboxCode()
+	}
+	code = wh.MailboxCode(code)
+	fmt.Printf("Mailbox code: %s (share with receiver)\n", code)
+
+	var expiry time.Time
+	var err error
+	switch args[0] {
+	case "-":
+		title := "Uploading stdin"
+		if name != "" {
+			title = "Uploading: " + name
+		}
+		err = runStreamUI(title, code, nil, os.Stdout, true, func(opts *wh.TransferOptions) error {
+			opts.MailboxTTL = ttl
+			opts.Limit.SetRate(limit)
+			e, err := wh.MailboxStream(relayAddr, code, os.Stdin, name, opts)
+			expiry = e
+			return err
+		})
+	case "file":
+		paths := args[1:]
+		info, statErr := os.Stat(paths[0])
+		if statErr != nil {
+			fmt.Printf("Error: %v\n", statErr)
+			os.Exit(1)
+		}
+		single := len(paths) == 1 && info.Mode().IsRegular()
+		title, total := "Uploading: "+filepath.Base(filepath.Clean(paths[0])), int64(0)
+		if single {
+			total = info.Size()
+		} else if len(paths) > 1 {
+			title = fmt.Sprintf("Uploading: %d items", len(paths))
+		}
+		err = wh.RunTransferUI(title, total, code, nil, func(opts *wh.TransferOptions) error {
+			opts.MailboxTTL = ttl
+			opts.Limit.SetRate(limit)
+			var e time.Time
+			var err error
+			if single {
+				e, err = wh.MailboxFile(relayAddr, code, paths[0], opts)
+			} else {
+				e, err = wh.MailboxFiles(relayAddr, code, paths, opts)
+			}
+			expiry = e
+			return err
+		})
+	case "text":
+		expiry, err = wh.MailboxText(relayAddr, code, args[1], &wh.TransferOptions{MailboxTTL: ttl, Limit: wh.NewLimiter(limit)})
+	default:
+		fmt.Printf("Unknown mode: %s (use file or text)\n", args[0])
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Stored on the relay until %s.\nReceive with: cli wormhole receive %s\n", expiry.Format("2006-01-02 15:04 MST"), code)
+}
+
+// runStreamUI runs a transfer whose stdin or stdout is a pipe. The UI renders on
+// out and reads keys from the terminal; without a terminal on out it runs plainly.
+func runStreamUI(title, code string, result *wh.ReceiveResult, out *os.File, stdinIsData bool, fn func(opts *wh.TransferOptions) error) error {
+	if !term.IsTerminal(int(out.Fd())) {
+		return fn(&wh.TransferOptions{Limit: wh.NewLimiter(0)})
+	}
+	return wh.RunTransferUIWithOptions(title, -1, code, result, &wh.UIOptions{
+		Output:     out,
+		InputTTY:   stdinIsData,
+		QuitOnDone: true,
+	}, fn)
+}
+
+// parseLimit parses a --limit value or exits with a usage error.
+func parseLimit(s string) int64 {
+	limit, err := wh.ParseRate(s)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --limit: %v\n", err)
+		os.Exit(1)
+	}
+	return limit
+}
+
+// confirmSASPrompt asks on the terminal whether the peer shows the same security code.
+func confirmSASPrompt(sas wh.SAS) bool {
+	fmt.Fprintf(os.Stderr, "Security code: %s\nDoes your peer see the same code? [y/N] ", sas)
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes"
+}
@@ -2,7 +2,6 @@ package wormhole
 
 import (
 	"fmt"
-	"net"
 	"os"
 
 	"github.com/A-Flex-Box/cli/internal/config"
@@ -12,16 +11,30 @@ import (
 )
 
 func newConnectCmd(cfg *config.WormholeConfig) *cobra.Command {
-	var code string
+	var code, limitStr string
+	var noDirect, verify, reconnect bool
 
 	cmd := &cobra.Command{
-		Use:   "connect [code] <local_bind_addr>",
-		Short: "Map a remote service to a local address",
-		Long:  "Connect to a remote exposed service using the pairing code. Use -c to pass code, or provide code as first arg. Local bind address can be e.g. :9090 or 127.0.0.1:9000.",
-		Example: `  cli wormhole connect abc1 :9090
-  cli wormhole connect -c abc1 :9090
-  cli wormhole connect -c 7-magic-fish :9000`,
-		Args: cobra.MinimumNArgs(1),
+		Use:   "connect [code] [local_binds]",
+		Short: "Map remote services to local addresses",
+		Long: "Connect to remote exposed services using the pairing code. Use -c to pass code, or provide code as first arg. " +
+			"Without binds, every exposed port is bound on 127.0.0.1 under the same number. Binds are comma-separated: " +
+			"3000 (same port), 9090=3000 (local 9090 to remote 3000), unix:///tmp/docker.sock=2375 (a local Unix socket), " +
+			"an address like :9090 or 127.0.0.1:9000 when one port is exposed, or socks / 1081=socks for the SOCKS5 proxy " +
+			"of a peer exposing with --socks (127.0.0.1:1080 by default).",
+		Example: `  cli wormhole connect 7-guitar-sunset-maple :9090
+  cli wormhole connect -c 7-guitar-sunset-maple :9090
+  cli wormhole connect -c 42-magnet-otter
+  cli wormhole connect -c 42-magnet-otter 13000=3000,8080,15432=5432
+  cli wormhole connect -c 42-magnet-otter unix:///tmp/docker.sock=2375
+  cli wormhole connect -c 42-magnet-otter 8080,1081=socks`,
+		Args: cobra.MaximumNArgs(2),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 0 && code == "" {
+				return completeCode(cmd, args, toComplete)
+			}
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 			relayAddr := cfg.GetActiveRelayAddr()
 			if relayAddr == "" {
@@ -29,35 +42,53 @@ func newConnectCmd(cfg *config.WormholeConfig) *cobra.Command {
 				os.Exit(1)
 			}
 
-			var pairCode, bindAddr string
+			var pairCode, bindSpec string
 			if code != "" {
-				// -c provided: args[0] is bindAddr
+				// -c provided: args[0] (optional) is the bind list
 				pairCode = code
-				bindAddr = args[0]
-			} else if len(args) >= 2 {
-				// no -c: args[0] is code, args[1] is bindAddr
+				if len(args) > 1 {
+					fmt.Println("Too many arguments: with -c, give only the local binds.")
+					os.Exit(1)
+				}
+				if len(args) == 1 {
+					bindSpec = args[0]
+				}
+			} else if len(args) >= 1 {
+				// no -c: args[0] is code, args[1] (optional) is the bind list
 				pairCode = args[0]
-				bindAddr = args[1]
+				if len(args) == 2 {
+					bindSpec = args[1]
+				}
 			} else {
 				fmt.Println("Code required. Use -c <code> or provide as first argument.")
 				os.Exit(1)
 			}
 
+			limit := parseLimit(limitStr)
+			pairCode = wh.NormalizeCode(pairCode)
 			if pairCode == "" {
 				fmt.Println("Code is required")
 				os.Exit(1)
 			}
-			if _, _, err := net.SplitHostPort(bindAddr); err != nil {
-				fmt.Printf("Invalid bind address: %s (use e.g. :9090 or 127.0.0.1:9000)\n", bindAddr)
-				os.Exit(1)
+			var binds []wh.TunnelBind
+			if bindSpec != "" {
+				var err error
+				if binds, err = wh.ParseTunnelBinds(bindSpec); err != nil {
+					fmt.Printf("Invalid binds %s: %v\n", bindSpec, err)
+					os.Exit(1)
+				}
 			}
 
 			logger.Info("wormhole.connect start", logger.Context("params", map[string]any{
-				"relay_addr": relayAddr, "code": pairCode, "bind_addr": bindAddr,
+				"relay_addr": wh.MaskRelayAddr(relayAddr), "code": pairCode, "binds": bindSpec,
 			})...)
 
-			if err := wh.RunTunnelUI("connect", pairCode, bindAddr, func(opts *wh.TunnelOptions) error {
-				return wh.ConnectTunnel(relayAddr, pairCode, bindAddr, opts)
+			if err := wh.RunTunnelUI("connect", pairCode, bindSpec, func(opts *wh.TunnelOptions) error {
+				opts.NoDirect = noDirect
+				opts.VerifySAS = verify
+				opts.Reconnect = reconnect
+				opts.Limit.SetRate(limit)
+				return wh.ConnectTunnel(relayAddr, pairCode, binds, opts)
 			}); err != nil {
 				fmt.Printf("Error: %v\n", err)
 				os.Exit(1)
@@ -65,5 +96,10 @@ func newConnectCmd(cfg *config.WormholeConfig) *cobra.Command {
 		},
 	}
 	cmd.Flags().StringVarP(&code, "code", "c", "", "Pairing code from expose side")
+	cmd.Flags().StringVar(&limitStr, "limit", "", "Bandwidth cap for the tunnel, e.g. 5MB/s (adjust with +/- in the UI)")
+	cmd.Flags().BoolVar(&verify, "verify", false, "Require confirming that both sides show the same security code before anything is sent")
+	cmd.Flags().BoolVar(&reconnect, "reconnect", false, "Redial with the same code when the relay or network drops, instead of exiting")
+	cmd.Flags().BoolVar(&noDirect, "no-direct", false, "Always go through the relay, even on a shared LAN")
+	cmd.RegisterFlagCompletionFunc("code", completeCode)
 	return cmd
 }
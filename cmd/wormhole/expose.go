@@ -3,8 +3,7 @@ package wormhole
 import (
 	"fmt"
 	"os"
-	"strconv"
-	"strings"
+	"time"
 
 	"github.com/A-Flex-Box/cli/internal/config"
 	"github.com/A-Flex-Box/cli/internal/logger"
@@ -13,16 +12,37 @@ import (
 )
 
 func newExposeCmd(cfg *config.WormholeConfig) *cobra.Command {
-	var code string
+	var code, limitStr, allow string
+	var noDirect, verify, reconnect, socks, inspect, once bool
+	var maxStreams int
+	var idleTimeout, ttl time.Duration
 
 	cmd := &cobra.Command{
-		Use:   "expose <local_port>",
-		Short: "Share a local service via the wormhole tunnel",
-		Long:  "Expose a local port (e.g. 8080) through the wormhole. Remote users with the code can connect via wormhole connect.",
+		Use:   "expose [targets]",
+		Short: "Share local services via the wormhole tunnel",
+		Long: "Expose one or more services through one wormhole: local ports (8080), hosts on your network (10.0.0.5:5432) " +
+			"or Unix sockets (unix:///var/run/docker.sock), comma-separated. Each is reachable under a port number: its own, " +
+			"one given as PORT=target, or 10000 and up for sockets. Remote users with the code connect via wormhole connect; " +
+			"only the listed targets are reachable. With --socks the remote side also gets a SOCKS5 proxy whose connections " +
+			"are dialed from this machine, limited to the destinations in --allow (private networks by default). With --inspect " +
+			"every HTTP request is recorded; press i in the UI to browse them, replay one or export them as HAR. " +
+			"--max-streams, --idle-timeout, --ttl and --once bound what the code grants; press s in the UI to list streams and x to kill one.",
 		Example: `  cli wormhole expose 8080
-  cli wormhole expose -c abc1 8080
-  cli wormhole expose 3000`,
-		Args: cobra.ExactArgs(1),
+  cli wormhole expose -c 7-guitar-sunset-maple 8080
+  cli wormhole expose 3000,8080,5432
+  cli wormhole expose 10.0.0.5:5432,2375=unix:///var/run/docker.sock
+  cli wormhole expose --reconnect 8080
+  cli wormhole expose --inspect 3000
+  cli wormhole expose --once 8080
+  cli wormhole expose --ttl 2h --max-streams 4 --idle-timeout 10m 5432
+  cli wormhole expose --socks
+  cli wormhole expose --socks --allow '10.0.0.0/8,!10.0.0.1,*.corp.example:443' 8080`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if socks {
+				return cobra.MaximumNArgs(1)(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 			relayAddr := cfg.GetActiveRelayAddr()
 			if relayAddr == "" {
@@ -30,23 +50,60 @@ func newExposeCmd(cfg *config.WormholeConfig) *cobra.Command {
 				os.Exit(1)
 			}
 
-			portStr := strings.TrimPrefix(args[0], ":")
-			if _, err := strconv.Atoi(portStr); err != nil {
-				fmt.Printf("Invalid port: %s\n", args[0])
+			var targets []wh.TunnelTarget
+			spec := "socks"
+			if len(args) == 1 {
+				var err error
+				if targets, err = wh.ParseTunnelTargets(args[0]); err != nil {
+					fmt.Printf("Invalid targets %s: %v\n", args[0], err)
+					os.Exit(1)
+				}
+				spec = args[0]
+			}
+			var policy *wh.DialPolicy
+			if allow != "" && !socks {
+				fmt.Println("--allow only applies with --socks")
+				os.Exit(1)
+			}
+			if socks {
+				if allow == "" {
+					allow = wh.DefaultSocksAllow
+				}
+				var err error
+				if policy, err = wh.ParseDialPolicy(allow); err != nil {
+					fmt.Printf("Invalid --allow %s: %v\n", allow, err)
+					os.Exit(1)
+				}
+			}
+
+			if maxStreams < 0 || idleTimeout < 0 || ttl < 0 {
+				fmt.Println("--max-streams, --idle-timeout and --ttl must not be negative")
 				os.Exit(1)
 			}
 
-			pairCode := code
+			limit := parseLimit(limitStr)
+			pairCode := wh.NormalizeCode(code)
 			if pairCode == "" {
 				pairCode = wh.GenerateCode()
 			}
 
 			logger.Info("wormhole.expose start", logger.Context("params", map[string]any{
-				"relay_addr": relayAddr, "code": pairCode, "local_port": portStr,
+				"relay_addr": wh.MaskRelayAddr(relayAddr), "code": pairCode, "targets": spec, "socks_allow": allow,
+				"max_streams": maxStreams, "idle_timeout": idleTimeout.String(), "ttl": ttl.String(), "once": once,
 			})...)
 
-			if err := wh.RunTunnelUI("expose", pairCode, portStr, func(opts *wh.TunnelOptions) error {
-				return wh.ExposeTunnel(relayAddr, pairCode, portStr, opts)
+			if err := wh.RunTunnelUI("expose", pairCode, spec, func(opts *wh.TunnelOptions) error {
+				opts.NoDirect = noDirect
+				opts.VerifySAS = verify
+				opts.Reconnect = reconnect
+				opts.Socks = policy
+				opts.InspectHTTP = inspect
+				opts.MaxStreams = maxStreams
+				opts.IdleTimeout = idleTimeout
+				opts.TTL = ttl
+				opts.OneShot = once
+				opts.Limit.SetRate(limit)
+				return wh.ExposeTunnel(relayAddr, pairCode, targets, opts)
 			}); err != nil {
 				fmt.Printf("Error: %v\n", err)
 				os.Exit(1)
@@ -54,5 +111,16 @@ func newExposeCmd(cfg *config.WormholeConfig) *cobra.Command {
 		},
 	}
 	cmd.Flags().StringVarP(&code, "code", "c", "", "Pairing code (generated if empty)")
+	cmd.Flags().StringVar(&limitStr, "limit", "", "Bandwidth cap for the tunnel, e.g. 5MB/s (adjust with +/- in the UI)")
+	cmd.Flags().BoolVar(&verify, "verify", false, "Require confirming that both sides show the same security code before anything is sent")
+	cmd.Flags().BoolVar(&reconnect, "reconnect", false, "Redial with the same code when the relay or network drops, instead of exiting")
+	cmd.Flags().BoolVar(&socks, "socks", false, "Also offer a SOCKS5 proxy; the connect side serves it on 127.0.0.1:1080 by default")
+	cmd.Flags().StringVar(&allow, "allow", "", "SOCKS destinations to allow: CIDRs, IPs, hosts or *.domain, each with an optional :port, ! to deny (default private networks)")
+	cmd.Flags().BoolVar(&inspect, "inspect", false, "Record HTTP requests and responses for the inspector (press i), with replay and HAR export")
+	cmd.Flags().IntVar(&maxStreams, "max-streams", 0, "Refuse streams beyond this many at once (0 for no limit)")
+	cmd.Flags().DurationVar(&idleTimeout, "idle-timeout", 0, "Close a stream after this long without traffic, e.g. 10m")
+	cmd.Flags().DurationVar(&ttl, "ttl", 0, "Close the tunnel this long after the peer first connects, e.g. 2h")
+	cmd.Flags().BoolVar(&once, "once", false, "Accept a single connection and close the tunnel when it finishes")
+	cmd.Flags().BoolVar(&noDirect, "no-direct", false, "Always go through the relay, even on a shared LAN")
 	return cmd
 }
@@ -1,6 +1,8 @@
 package wormhole
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"os"
 
@@ -11,32 +13,45 @@ import (
 )
 
 func newReceiveCmd(cfg *config.WormholeConfig) *cobra.Command {
-	var code, outDir string
+	var code, outDir, limitStr string
+	var noDirect, toStdout, yes, noClobber, verify bool
 
 	cmd := &cobra.Command{
-		Use:     "receive",
+		Use:     "receive [code]",
 		Short:   "Receive file or text",
-		Example: "cli wormhole receive -c abc-123",
+		Long:    "Receive a file, bundle, stream or text. The offer (name, size, sender's hash) is shown first so you can accept, rename or decline it; --yes accepts without asking. Mailbox codes (box-...) fetch a payload the sender left on the relay; it stays there until received or expired.",
+		Example: "cli wormhole receive -c 7-guitar-sunset-maple\n  cli wormhole receive -c 7-guitar-sunset-maple --stdout > out.tar\n  cli wormhole receive -c 7-guitar-sunset-maple --yes --no-clobber -o ./inbox\n  cli wormhole receive box-acid-maple-orbit-amber-otter-tiger",
+		Args:    cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
+			if code == "" && len(args) == 1 {
+				code = args[0]
+			}
 			relayAddr := cfg.GetActiveRelayAddr()
 			logger.Info("wormhole.receive cmd start", logger.Context("params", map[string]any{
-				"relay_addr": relayAddr, "active_relay": cfg.ActiveRelay, "code": code, "out_dir": outDir,
+				"relay_addr": wh.MaskRelayAddr(relayAddr), "active_relay": cfg.ActiveRelay, "code": code, "out_dir": outDir,
 			})...)
 			if relayAddr == "" {
 				fmt.Println("No active relay. Run: cli config use <name>")
 				os.Exit(1)
 			}
 
-			pairCode := code
+			limit := parseLimit(limitStr)
+			pairCode := wh.NormalizeCode(code)
 			if pairCode == "" {
-				fmt.Print("Enter code from sender: ")
-				fmt.Scanln(&pairCode)
+				fmt.Fprint(os.Stderr, "Enter code from sender: ")
+				line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+				pairCode = wh.NormalizeCode(line)
 				if pairCode == "" {
 					fmt.Println("Code required")
 					os.Exit(1)
 				}
 			}
 
+			receive := wh.Receive
+			if wh.IsMailboxCode(pairCode) {
+				receive = wh.ReceiveMailbox
+			}
+
 			dir := outDir
 			if dir == "" {
 				dir = "."
@@ -44,16 +59,60 @@ func newReceiveCmd(cfg *config.WormholeConfig) *cobra.Command {
 
 			var receivedText string
 			var result wh.ReceiveResult
-			err := wh.RunTransferUI("Receiving...", 0, pairCode, &result, func(onProgress func(int64, int64)) error {
-				return wh.Receive(relayAddr, pairCode, dir, onProgress, &receivedText, &result)
+			if toStdout {
+				// stdout carries the payload; everything else goes to stderr.
+				err := runStreamUI("Receiving to stdout", pairCode, &result, os.Stderr, false, func(opts *wh.TransferOptions) error {
+					opts.NoDirect = noDirect
+					opts.VerifySAS = verify
+					opts.Limit.SetRate(limit)
+					opts.Output = os.Stdout
+					if yes {
+						opts.OnOffer = nil
+					}
+					return receive(relayAddr, pairCode, dir, opts, &receivedText, &result)
+				})
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				return
+			}
+			err := wh.RunTransferUI("Receiving...", 0, pairCode, &result, func(opts *wh.TransferOptions) error {
+				opts.NoDirect = noDirect
+				opts.VerifySAS = verify
+				opts.NoClobber = noClobber
+				opts.Limit.SetRate(limit)
+				if yes {
+					opts.OnOffer = nil
+				}
+				return receive(relayAddr, pairCode, dir, opts, &receivedText, &result)
 			})
 			if err != nil {
 				fmt.Printf("Error: %v\n", err)
+				if wh.IsMailboxCode(pairCode) {
+					if !errors.Is(err, wh.ErrMailboxEmpty) && !errors.Is(err, wh.ErrRelayNoMailbox) {
+						fmt.Printf("The payload stays on the relay until it expires; re-run with -c %s to try again.\n", pairCode)
+					}
+				} else if result.PartPath != "" {
+					fmt.Printf("Partial data is kept in %s; re-run with -c %s to resume.\n", result.PartPath, pairCode)
+				}
 				os.Exit(1)
 			}
 		},
 	}
 	cmd.Flags().StringVarP(&code, "code", "c", "", "Pairing code from sender")
 	cmd.Flags().StringVarP(&outDir, "out", "o", ".", "Output directory for received files")
+	cmd.Flags().StringVar(&limitStr, "limit", "", "Bandwidth cap, e.g. 5MB/s (adjust with +/- in the UI)")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Accept the offer without asking (for scripts)")
+	cmd.Flags().BoolVar(&noClobber, "no-clobber", false, "Decline offers that would overwrite an existing file")
+	cmd.Flags().BoolVar(&toStdout, "stdout", false, "Write the received file, stream or text to stdout (progress on stderr)")
+	cmd.Flags().BoolVar(&verify, "verify", false, "Require confirming that both sides show the same security code before anything is sent")
+	cmd.Flags().BoolVar(&noDirect, "no-direct", false, "Always go through the relay, even on a shared LAN")
+	cmd.RegisterFlagCompletionFunc("code", completeCode)
 	return cmd
 }
+
+// completeCode completes the word part of a pairing code ("7-gu" -> "7-guitar").
+func completeCode(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return wh.CompleteCode(toComplete), cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
@@ -1,9 +1,14 @@
 package wormhole
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/A-Flex-Box/cli/internal/logger"
@@ -14,11 +19,26 @@ import (
 func newRelayCmd() *cobra.Command {
 	var port int
 	var timeout time.Duration
+	var admin string
+	var tokens []string
+	var tokenFile, perPipeLimit string
+	var maxRoomsPerIP, maxPipes int
+	var tlsCert, tlsKey string
+	var tlsSelfSigned bool
+	var wsPort int
+	var mailboxDir, mailboxQuota string
+	var mailboxTTL time.Duration
 
 	cmd := &cobra.Command{
-		Use:     "relay",
-		Short:   "Run the relay server (dumb TCP signal server)",
-		Example: "cli wormhole relay -p 9000",
+		Use:   "relay",
+		Short: "Run the relay server (dumb TCP/TLS/WebSocket signal server)",
+		Example: `  cli wormhole relay -p 9000
+  cli wormhole relay -p 9000 --admin 127.0.0.1:9100   # /metrics and /status
+  cli wormhole relay --token s3cret --max-rooms-per-ip 5 --max-pipes 100 --per-pipe-limit 10MB/s
+  cli wormhole relay -p 443 --tls-cert fullchain.pem --tls-key privkey.pem
+  cli wormhole relay -p 9443 --tls-self-signed   # prints the ?pin= for clients
+  cli wormhole relay -p 9000 --ws-port 8080      # also accept ws://host:8080 (through HTTP proxies)
+  cli wormhole relay --mailbox-dir /var/lib/wormhole --mailbox-ttl 24h --mailbox-quota 5GB   # store-and-forward`,
 		Run: func(cmd *cobra.Command, args []string) {
 			addr := fmt.Sprintf(":%d", port)
 			ln, err := net.Listen("tcp", addr)
@@ -28,11 +48,108 @@ func newRelayCmd() *cobra.Command {
 			}
 			defer ln.Close()
 
-			srv := wh.NewRelayServer(timeout)
+			scheme, wsScheme := wh.SchemeTCP, wh.SchemeWS
+			var tlsConfig *tls.Config
+			if tlsCert != "" || tlsKey != "" || tlsSelfSigned {
+				cert, pin, err := loadRelayCert(tlsCert, tlsKey, tlsSelfSigned)
+				if err != nil {
+					fmt.Printf("TLS setup failed: %v\n", err)
+					os.Exit(1)
+				}
+				tlsConfig = wh.RelayTLSConfig(cert)
+				ln = tls.NewListener(ln, tlsConfig)
+				scheme, wsScheme = wh.SchemeTLS, wh.SchemeWSS
+				if tlsSelfSigned {
+					fmt.Printf("TLS certificate pin: %s\n", pin)
+					fmt.Printf("Clients: tls://<host>:%d?pin=%s\n", port, pin)
+				}
+			}
+
+			if tokenFile != "" {
+				fileTokens, err := readTokenFile(tokenFile)
+				if err != nil {
+					fmt.Printf("Failed to read token file: %v\n", err)
+					os.Exit(1)
+				}
+				tokens = append(tokens, fileTokens...)
+			}
+			limit, err := wh.ParseRate(perPipeLimit)
+			if err != nil {
+				fmt.Printf("Invalid --per-pipe-limit: %v\n", err)
+				os.Exit(1)
+			}
+			quota, err := wh.ParseSize(mailboxQuota)
+			if err != nil {
+				fmt.Printf("Invalid --mailbox-quota: %v\n", err)
+				os.Exit(1)
+			}
+			if mailboxDir != "" {
+				if err := os.MkdirAll(mailboxDir, 0700); err != nil {
+					fmt.Printf("Failed to create mailbox directory: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			srv := wh.NewRelayServer(timeout, &wh.RelayOptions{
+				Tokens:        tokens,
+				MaxRoomsPerIP: maxRoomsPerIP,
+				MaxPipes:      maxPipes,
+				PerPipeLimit:  limit,
+				MailboxDir:    mailboxDir,
+				MailboxTTL:    mailboxTTL,
+				MailboxQuota:  quota,
+			})
 			logger.Info("relay.listening", logger.Context("params", map[string]any{
-				"addr": addr, "timeout_sec": timeout.Seconds(),
+				"addr": addr, "scheme": scheme, "timeout_sec": timeout.Seconds(), "tokens": len(tokens),
+				"max_rooms_per_ip": maxRoomsPerIP, "max_pipes": maxPipes, "per_pipe_limit": limit,
+				"mailbox_dir": mailboxDir, "mailbox_ttl_sec": mailboxTTL.Seconds(), "mailbox_quota": quota,
 			})...)
-			fmt.Printf("Relay listening on %s (timeout: %v)\n", addr, timeout)
+			fmt.Printf("Relay listening on %s://%s (timeout: %v)\n", scheme, addr, timeout)
+			if len(tokens) > 0 {
+				fmt.Printf("Access control: %d token(s) required\n", len(tokens))
+			}
+			if maxRoomsPerIP > 0 || maxPipes > 0 || limit > 0 {
+				fmt.Printf("Limits: rooms/IP %s, pipes %s, per pipe %s\n", limitString(maxRoomsPerIP), limitString(maxPipes), wh.FormatRate(limit))
+			}
+			if mailboxDir != "" {
+				ttl := mailboxTTL
+				if ttl <= 0 {
+					ttl = wh.DefaultMailboxTTL
+				}
+				quotaString := "unlimited"
+				if quota > 0 {
+					quotaString = wh.FormatSize(quota)
+				}
+				fmt.Printf("Mailbox: %s (kept up to %v, quota %s)\n", mailboxDir, ttl, quotaString)
+			}
+
+			if wsPort > 0 {
+				wsAddr := fmt.Sprintf(":%d", wsPort)
+				wsSrv := newHTTPServer(wsAddr, srv.WebSocketHandler())
+				wsSrv.TLSConfig = tlsConfig
+				go func() {
+					logger.Info("relay.websocket listening", logger.Context("params", map[string]any{"addr": wsAddr, "scheme": wsScheme})...)
+					var err error
+					if tlsConfig != nil {
+						err = wsSrv.ListenAndServeTLS("", "")
+					} else {
+						err = wsSrv.ListenAndServe()
+					}
+					logger.Error("relay.websocket stopped", logger.Context("params", map[string]any{"error": err.Error()})...)
+					fmt.Printf("WebSocket listener error: %v\n", err)
+				}()
+				fmt.Printf("WebSocket relay on %s://%s%s\n", wsScheme, wsAddr, wh.DefaultWebSocketPath)
+			}
+
+			if admin != "" {
+				go func() {
+					logger.Info("relay.admin listening", logger.Context("params", map[string]any{"addr": admin})...)
+					if err := newHTTPServer(admin, srv.AdminHandler()).ListenAndServe(); err != nil {
+						logger.Error("relay.admin stopped", logger.Context("params", map[string]any{"error": err.Error()})...)
+						fmt.Printf("Admin listener error: %v\n", err)
+					}
+				}()
+				fmt.Printf("Admin endpoint on http://%s (/metrics, /status)\n", admin)
+			}
 
 			for {
 				conn, err := ln.Accept()
@@ -48,9 +165,104 @@ func newRelayCmd() *cobra.Command {
 	}
 	cmd.Flags().IntVarP(&port, "port", "p", envInt("CLI_RELAY_PORT", 9000), "Port to listen on")
 	cmd.Flags().DurationVarP(&timeout, "timeout", "t", envDuration("CLI_RELAY_TIMEOUT", 60*time.Second), "Pairing wait timeout")
+	cmd.Flags().StringVar(&admin, "admin", os.Getenv("CLI_RELAY_ADMIN"), "Admin HTTP listen address for metrics and status (empty = disabled)")
+	cmd.Flags().StringSliceVar(&tokens, "token", envList("CLI_RELAY_TOKENS"), "Accepted access token (repeatable); clients put it in the relay URL as tcp://TOKEN@host:port")
+	cmd.Flags().StringVar(&tokenFile, "token-file", os.Getenv("CLI_RELAY_TOKEN_FILE"), "File with one accepted token per line (# comments allowed)")
+	cmd.Flags().IntVar(&maxRoomsPerIP, "max-rooms-per-ip", envInt("CLI_RELAY_MAX_ROOMS_PER_IP", 0), "Concurrent waiting rooms per source IP (0 = unlimited)")
+	cmd.Flags().IntVar(&maxPipes, "max-pipes", envInt("CLI_RELAY_MAX_PIPES", 0), "Concurrent active pipes (0 = unlimited)")
+	cmd.Flags().StringVar(&perPipeLimit, "per-pipe-limit", os.Getenv("CLI_RELAY_PER_PIPE_LIMIT"), "Bandwidth per pipe direction, e.g. 10MB/s (empty = unlimited)")
+	cmd.Flags().IntVar(&wsPort, "ws-port", envInt("CLI_RELAY_WS_PORT", 0), "Also accept WebSocket relay clients on this HTTP port (0 = disabled; wss when TLS is on)")
+	cmd.Flags().StringVar(&mailboxDir, "mailbox-dir", os.Getenv("CLI_RELAY_MAILBOX_DIR"), "Store encrypted payloads here for offline receivers (empty = mailbox disabled)")
+	cmd.Flags().DurationVar(&mailboxTTL, "mailbox-ttl", envDuration("CLI_RELAY_MAILBOX_TTL", wh.DefaultMailboxTTL), "Longest a mailbox payload is kept, and the default when the sender asks for none")
+	cmd.Flags().StringVar(&mailboxQuota, "mailbox-quota", envString("CLI_RELAY_MAILBOX_QUOTA", "1GB"), "Total size of stored mailbox payloads, e.g. 5GB (0 = unlimited)")
+	cmd.Flags().StringVar(&tlsCert, "tls-cert", os.Getenv("CLI_RELAY_TLS_CERT"), "TLS certificate (PEM); clients use tls://host:port")
+	cmd.Flags().StringVar(&tlsKey, "tls-key", os.Getenv("CLI_RELAY_TLS_KEY"), "TLS private key (PEM)")
+	cmd.Flags().BoolVar(&tlsSelfSigned, "tls-self-signed", false, "Generate (or reuse) a self-signed certificate; clients pin it with ?pin=")
 	return cmd
 }
 
+// loadRelayCert loads the relay certificate, defaulting self-signed files to the
+// config directory, and returns it with its client pin.
+func loadRelayCert(certFile, keyFile string, selfSigned bool) (tls.Certificate, string, error) {
+	if selfSigned && (certFile == "" || keyFile == "") {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return tls.Certificate{}, "", err
+		}
+		dir = filepath.Join(dir, "a-flex-box", "relay-tls")
+		if certFile == "" {
+			certFile = filepath.Join(dir, "cert.pem")
+		}
+		if keyFile == "" {
+			keyFile = filepath.Join(dir, "key.pem")
+		}
+	}
+	if certFile == "" || keyFile == "" {
+		return tls.Certificate{}, "", fmt.Errorf("--tls-cert and --tls-key must be given together (or use --tls-self-signed)")
+	}
+	cert, err := wh.LoadOrCreateRelayCert(certFile, keyFile, selfSigned)
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+	logger.Info("relay.tls loaded", logger.Context("params", map[string]any{
+		"cert": certFile, "self_signed": selfSigned, "subject": leaf.Subject.String(), "not_after": leaf.NotAfter,
+	})...)
+	return cert, wh.CertPin(leaf), nil
+}
+
+// HTTP listeners of the relay drop clients that are slow to send request
+// headers or that keep idle connections open.
+const (
+	httpReadHeaderTimeout = 10 * time.Second
+	httpIdleTimeout       = 2 * time.Minute
+)
+
+// newHTTPServer returns an http.Server for a relay listener with the timeouts above.
+func newHTTPServer(addr string, h http.Handler) *http.Server {
+	return &http.Server{Addr: addr, Handler: h, ReadHeaderTimeout: httpReadHeaderTimeout, IdleTimeout: httpIdleTimeout}
+}
+
+func limitString(n int) string {
+	if n <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprint(n)
+}
+
+// readTokenFile returns the non-empty, non-comment lines of path.
+func readTokenFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			tokens = append(tokens, line)
+		}
+	}
+	return tokens, nil
+}
+
+func envList(key string) []string {
+	if v := os.Getenv(key); v != "" {
+		return strings.Split(v, ",")
+	}
+	return nil
+}
+
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
 func envInt(key string, def int) int {
 	if v := os.Getenv(key); v != "" {
 		var n int
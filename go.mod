@@ -3,10 +3,11 @@ module github.com/A-Flex-Box/cli
 go 1.24.6
 
 require (
+	fyne.io/fyne/v2 v2.6.1
 	github.com/charmbracelet/bubbles v0.21.1
 	github.com/charmbracelet/bubbletea v1.3.10
 	github.com/charmbracelet/lipgloss v1.1.0
-	fyne.io/fyne/v2 v2.6.1
+	github.com/coder/websocket v1.8.15
 	github.com/hashicorp/yamux v0.1.1
 	github.com/phin1x/go-ipp v1.7.0
 	github.com/schollz/pake/v3 v3.1.0
@@ -20,6 +21,7 @@ require (
 
 require (
 	filippo.io/edwards25519 v1.1.0 // indirect
+	github.com/atotto/clipboard v0.1.4 // indirect
 	github.com/aymanbagabas/go-osc52/v2 v2.0.1 // indirect
 	github.com/charmbracelet/colorprofile v0.4.1 // indirect
 	github.com/charmbracelet/harmonica v0.2.0 // indirect
@@ -161,7 +161,8 @@ func (sc *SpeedCalculator) Record(bytes int64) {
 	sc.samples = newSamples
 }
 
-// BytesPerSec returns the average bytes/sec over the window.
+// BytesPerSec returns the average bytes/sec over the window. The first sample's
+// bytes arrived before it was taken, so they do not count against its span.
 func (sc *SpeedCalculator) BytesPerSec() float64 {
 	sc.mu.RLock()
 	defer sc.mu.RUnlock()
@@ -169,7 +170,7 @@ func (sc *SpeedCalculator) BytesPerSec() float64 {
 		return 0
 	}
 	cutoff := time.Now().Add(-sc.window)
-	var total int64
+	var total, firstBytes int64
 	var first, last time.Time
 	for i, s := range sc.samples {
 		if s.at.Before(cutoff) {
@@ -177,7 +178,7 @@ func (sc *SpeedCalculator) BytesPerSec() float64 {
 		}
 		total += s.bytes
 		if first.IsZero() || s.at.Before(first) {
-			first = s.at
+			first, firstBytes = s.at, s.bytes
 		}
 		if last.IsZero() || s.at.After(last) {
 			last = s.at
@@ -188,5 +189,5 @@ func (sc *SpeedCalculator) BytesPerSec() float64 {
 	if elapsed <= 0 {
 		return 0
 	}
-	return float64(total) / elapsed
+	return float64(total-firstBytes) / elapsed
 }
@@ -0,0 +1,485 @@
+package instrument
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/A-Flex-Box/cli/internal/logger"
+	"go.uber.org/zap"
+)
+
+// Detection is what Detect recognized in the first bytes of a stream: the
+// protocol and whatever details the opening message gives away.
+type Detection struct {
+	Protocol string   // One of the Protocol constants
+	Version  string   // e.g. "TLS 1.3", "OpenSSH_9.6", MySQL server "8.0.36", VNC "3.8"
+	SNI      string   // TLS server name
+	ALPN     []string // TLS application protocols offered
+	User     string   // PostgreSQL, MySQL or RDP user
+	Database string   // PostgreSQL, MySQL or MongoDB database
+	Command  string   // MongoDB command, e.g. "find"
+	Method   string   // HTTP method
+	Path     string   // HTTP path
+}
+
+// Summary renders the details, e.g. "TLS 1.3, sni=example.com, alpn=h2,http/1.1".
+func (d Detection) Summary() string {
+	var parts []string
+	add := func(key, v string) {
+		if v != "" {
+			parts = append(parts, key+v)
+		}
+	}
+	add("", strings.TrimSpace(d.Method+" "+d.Path))
+	add("", d.Version)
+	add("sni=", d.SNI)
+	add("alpn=", strings.Join(d.ALPN, ","))
+	add("user=", d.User)
+	add("db=", d.Database)
+	add("cmd=", d.Command)
+	return strings.Join(parts, ", ")
+}
+
+// String renders the protocol and its details, e.g. "PostgreSQL (3.0, user=app, db=shop)".
+func (d Detection) String() string {
+	if s := d.Summary(); s != "" {
+		return d.Protocol + " (" + s + ")"
+	}
+	return d.Protocol
+}
+
+// Detect analyzes the first bytes of a stream (up to MaxHeaderBytes) from either
+// side, client or server, and returns the protocol with its details. Messages cut
+// short by the limit still yield what precedes the cut.
+func Detect(head []byte) Detection {
+	d := detect(head)
+	logger.Debug("Detect: protocol detected",
+		zap.String("component", "instrument.Sniffer"),
+		zap.String("detection", d.String()),
+		zap.Int("head_len", len(head)))
+	return d
+}
+
+func detect(head []byte) Detection {
+	if len(head) == 0 {
+		return Detection{Protocol: ProtocolTCP}
+	}
+	for _, f := range []func([]byte) (Detection, bool){
+		detectTLS, detectHTTP2, detectHTTP, detectSSH, detectVNC,
+		detectPostgres, detectMySQL, detectMongo, detectRDP, detectRedis,
+	} {
+		if d, ok := f(head); ok {
+			return d
+		}
+	}
+	return Detection{Protocol: ProtocolTCP}
+}
+
+// cursor reads big-endian fields from a byte slice; any read past the end
+// sets err and returns zero values.
+type cursor struct {
+	b   []byte
+	err bool
+}
+
+func (c *cursor) take(n int) []byte {
+	if c.err || n < 0 || n > len(c.b) {
+		c.err = true
+		return nil
+	}
+	v := c.b[:n]
+	c.b = c.b[n:]
+	return v
+}
+
+func (c *cursor) u8() int {
+	if v := c.take(1); v != nil {
+		return int(v[0])
+	}
+	return 0
+}
+
+func (c *cursor) u16() int {
+	if v := c.take(2); v != nil {
+		return int(binary.BigEndian.Uint16(v))
+	}
+	return 0
+}
+
+func (c *cursor) vec8() []byte  { return c.take(c.u8()) }
+func (c *cursor) vec16() []byte { return c.take(c.u16()) }
+
+// cstring reads a NUL-terminated string.
+func (c *cursor) cstring() string {
+	i := bytes.IndexByte(c.b, 0)
+	if c.err || i < 0 {
+		c.err = true
+		return ""
+	}
+	s := string(c.b[:i])
+	c.b = c.b[i+1:]
+	return s
+}
+
+var tlsVersions = map[int]string{0x0300: "SSL 3.0", 0x0301: "TLS 1.0", 0x0302: "TLS 1.1", 0x0303: "TLS 1.2", 0x0304: "TLS 1.3"}
+
+// detectTLS recognizes a TLS record; for a ClientHello it extracts the highest
+// offered version, the SNI host name and the ALPN protocols.
+func detectTLS(head []byte) (Detection, bool) {
+	if len(head) < 6 || head[0] != 0x16 || head[1] != 3 {
+		return Detection{}, false
+	}
+	d := Detection{Protocol: ProtocolTLS}
+	if head[5] != 1 { // not a ClientHello, e.g. a server's reply
+		return d, true
+	}
+	c := &cursor{b: head[5:]}
+	c.take(4) // handshake type and length
+	version := c.u16()
+	c.take(32) // random
+	c.vec8()   // session id
+	c.vec16()  // cipher suites
+	c.vec8()   // compression methods
+	n := c.u16()
+	if c.err {
+		return d, true
+	}
+	exts := &cursor{b: c.b[:min(n, len(c.b))]}
+	for len(exts.b) >= 4 {
+		typ, body := exts.u16(), exts.vec16()
+		if exts.err {
+			break // cut off by the peek limit
+		}
+		e := &cursor{b: body}
+		switch typ {
+		case 0: // server_name
+			names := &cursor{b: e.vec16()}
+			for len(names.b) > 0 && !names.err {
+				if kind, name := names.u8(), names.vec16(); kind == 0 && !names.err {
+					d.SNI = string(name)
+				}
+			}
+		case 16: // application_layer_protocol_negotiation
+			protos := &cursor{b: e.vec16()}
+			for len(protos.b) > 0 && !protos.err {
+				if p := protos.vec8(); !protos.err {
+					d.ALPN = append(d.ALPN, string(p))
+				}
+			}
+		case 43: // supported_versions
+			vs := &cursor{b: e.vec8()}
+			for len(vs.b) >= 2 {
+				if v := vs.u16(); v&0x0f0f != 0x0a0a && v > version { // skip GREASE
+					version = v
+				}
+			}
+		}
+	}
+	d.Version = tlsVersions[version]
+	return d, true
+}
+
+// http2Preface opens every HTTP/2 connection (RFC 9113 §3.4).
+const http2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// grpcContentType is "application/grpc" as a header value, plain and HPACK
+// Huffman-coded; the coded form is byte-aligned, so "application/grpc+proto"
+// starts with it too.
+var grpcContentType = [][]byte{
+	[]byte("application/grpc"),
+	{0x1d, 0x75, 0xd0, 0x62, 0x0d, 0x26, 0x3d, 0x4c, 0x4d, 0x65, 0x64},
+}
+
+// detectHTTP2 recognizes the HTTP/2 preface, and gRPC by the content type in
+// the first HEADERS frame when it fits in head.
+func detectHTTP2(head []byte) (Detection, bool) {
+	if !bytes.HasPrefix(head, []byte(http2Preface)) {
+		return Detection{}, false
+	}
+	for _, ct := range grpcContentType {
+		if bytes.Contains(head[len(http2Preface):], ct) {
+			return Detection{Protocol: ProtocolGRPC}, true
+		}
+	}
+	return Detection{Protocol: ProtocolHTTP2}, true
+}
+
+var httpMethods = []string{"GET", "POST", "HEAD", "PUT", "DELETE", "PATCH", "OPTIONS", "CONNECT", "TRACE"}
+
+// detectHTTP recognizes an HTTP/1.x request line or status line.
+func detectHTTP(head []byte) (Detection, bool) {
+	line, _, _ := bytes.Cut(head, []byte("\n"))
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return Detection{}, false
+	}
+	if strings.HasPrefix(fields[0], "HTTP/") {
+		return Detection{Protocol: ProtocolHTTP, Version: fields[0]}, true
+	}
+	method := strings.ToUpper(fields[0])
+	for _, m := range httpMethods {
+		if method == m {
+			d := Detection{Protocol: ProtocolHTTP, Method: method}
+			if len(fields) > 1 {
+				d.Path = fields[1]
+			}
+			return d, true
+		}
+	}
+	return Detection{}, false
+}
+
+// detectSSH recognizes an SSH identification string, e.g. "SSH-2.0-OpenSSH_9.6".
+func detectSSH(head []byte) (Detection, bool) {
+	if !bytes.HasPrefix(head, []byte("SSH-")) {
+		return Detection{}, false
+	}
+	line, _, _ := bytes.Cut(head, []byte("\n"))
+	d := Detection{Protocol: ProtocolSSH}
+	if parts := strings.SplitN(strings.TrimSpace(string(line)), "-", 3); len(parts) == 3 {
+		d.Version = parts[2]
+	}
+	return d, true
+}
+
+// detectVNC recognizes the RFB version handshake both sides send, "RFB 003.008\n".
+func detectVNC(head []byte) (Detection, bool) {
+	var major, minor int
+	if len(head) < 12 || !bytes.HasPrefix(head, []byte("RFB ")) {
+		return Detection{}, false
+	}
+	if _, err := fmt.Sscanf(string(head[4:11]), "%03d.%03d", &major, &minor); err != nil {
+		return Detection{}, false
+	}
+	return Detection{Protocol: ProtocolVNC, Version: fmt.Sprintf("%d.%d", major, minor)}, true
+}
+
+// PostgreSQL request codes in place of a protocol version (protocol §55.7).
+const (
+	pgProtocol3     = 0x00030000
+	pgSSLRequest    = 80877103
+	pgGSSENCRequest = 80877104
+	pgCancel        = 80877102
+)
+
+// detectPostgres recognizes a StartupMessage, with its user and database, or
+// an SSL, GSSAPI or cancel request.
+func detectPostgres(head []byte) (Detection, bool) {
+	if len(head) < 8 {
+		return Detection{}, false
+	}
+	n, code := binary.BigEndian.Uint32(head), binary.BigEndian.Uint32(head[4:])
+	d := Detection{Protocol: ProtocolPostgres}
+	switch {
+	case n == 8 && code == pgSSLRequest:
+		d.Version = "SSL request"
+	case n == 8 && code == pgGSSENCRequest:
+		d.Version = "GSSAPI request"
+	case n == 16 && code == pgCancel:
+		d.Version = "cancel request"
+	case n > 8 && n < 10000 && code == pgProtocol3:
+		d.Version = "3.0"
+		c := &cursor{b: head[8:min(int(n), len(head))]}
+		for {
+			key := c.cstring()
+			if key == "" {
+				break
+			}
+			switch v := c.cstring(); key {
+			case "user":
+				d.User = v
+			case "database":
+				d.Database = v
+			}
+		}
+	default:
+		return Detection{}, false
+	}
+	return d, true
+}
+
+// MySQL capability flags read from a client's handshake response.
+const (
+	mysqlConnectWithDB   = 0x00000008
+	mysqlProtocol41      = 0x00000200
+	mysqlSSL             = 0x00000800
+	mysqlSecureConn      = 0x00008000
+	mysqlPluginAuthLenEn = 0x00200000
+)
+
+// detectMySQL recognizes the server's initial handshake (protocol 10), with its
+// version, or a client's handshake response, with its user and database.
+func detectMySQL(head []byte) (Detection, bool) {
+	if len(head) < 5 {
+		return Detection{}, false
+	}
+	n := int(head[0]) | int(head[1])<<8 | int(head[2])<<16
+	seq, body := head[3], head[4:]
+	if n < 4 || n > 1<<16 {
+		return Detection{}, false
+	}
+	body = body[:min(n, len(body))]
+	d := Detection{Protocol: ProtocolMySQL}
+	switch {
+	case seq == 0 && body[0] == 10:
+		c := &cursor{b: body[1:]}
+		v := c.cstring()
+		if c.err || v == "" || strings.IndexFunc(v, func(r rune) bool { return r < ' ' || r > '~' }) >= 0 {
+			return Detection{}, false
+		}
+		d.Version = v
+	case seq == 1 && len(body) >= 32:
+		caps := binary.LittleEndian.Uint32(body)
+		if caps&mysqlProtocol41 == 0 || !bytes.Equal(body[9:32], make([]byte, 23)) {
+			return Detection{}, false
+		}
+		if n == 32 && caps&mysqlSSL != 0 {
+			d.Version = "SSL request"
+			return d, true
+		}
+		c := &cursor{b: body[32:]}
+		d.User = c.cstring()
+		if caps&(mysqlPluginAuthLenEn|mysqlSecureConn) != 0 {
+			c.vec8() // auth data; as a length-encoded integer its length fits one byte below 251
+		} else {
+			c.cstring()
+		}
+		if caps&mysqlConnectWithDB != 0 {
+			if db := c.cstring(); !c.err {
+				d.Database = db
+			}
+		}
+	default:
+		return Detection{}, false
+	}
+	return d, true
+}
+
+// MongoDB wire protocol op codes.
+const (
+	mongoOpReply      = 1
+	mongoOpQuery      = 2004
+	mongoOpCompressed = 2012
+	mongoOpMsg        = 2013
+)
+
+// detectMongo recognizes a MongoDB message header; for a command it extracts
+// the command name and database.
+func detectMongo(head []byte) (Detection, bool) {
+	if len(head) < 16 {
+		return Detection{}, false
+	}
+	n := binary.LittleEndian.Uint32(head)
+	responseTo := binary.LittleEndian.Uint32(head[8:])
+	op := binary.LittleEndian.Uint32(head[12:])
+	if n < 16 || n > 48<<20 {
+		return Detection{}, false
+	}
+	d := Detection{Protocol: ProtocolMongo}
+	body := head[16:min(int(n), len(head))]
+	switch {
+	case op == mongoOpMsg && len(body) >= 5 && body[4] == 0: // flags, then a body section
+		d.Command, d.Database = bsonCommand(body[5:])
+	case op == mongoOpQuery && responseTo == 0 && len(body) > 4:
+		c := &cursor{b: body[4:]} // flags
+		coll := c.cstring()
+		c.take(8) // numberToSkip, numberToReturn
+		if c.err || !strings.Contains(coll, ".") {
+			return Detection{}, false
+		}
+		d.Database, _, _ = strings.Cut(coll, ".")
+		d.Command, _ = bsonCommand(c.b)
+	case op == mongoOpCompressed || op == mongoOpReply && responseTo != 0:
+	default:
+		return Detection{}, false
+	}
+	return d, true
+}
+
+// bsonCommand returns the name of a command document's first element and its
+// "$db" field, reading as far as doc goes.
+func bsonCommand(doc []byte) (cmd, db string) {
+	if len(doc) < 5 {
+		return "", ""
+	}
+	// The length includes itself and the trailing NUL; anything shorter than an
+	// empty document is garbage.
+	n := binary.LittleEndian.Uint32(doc)
+	if n < 5 {
+		return "", ""
+	}
+	c := &cursor{b: doc[4:min(n, uint32(len(doc)))]}
+	for !c.err && len(c.b) > 1 {
+		typ := c.u8()
+		name := c.cstring()
+		if cmd == "" {
+			cmd = name
+		}
+		var size int
+		switch typ {
+		case 0x01, 0x09, 0x11, 0x12: // double, datetime, timestamp, int64
+			size = 8
+		case 0x02, 0x0d, 0x0e: // string, code, symbol
+			v := c.take(4)
+			if v == nil {
+				return cmd, db
+			}
+			s := c.take(int(binary.LittleEndian.Uint32(v)))
+			if name == "$db" && len(s) > 0 {
+				db = string(s[:len(s)-1])
+			}
+			continue
+		case 0x03, 0x04: // document, array (length includes itself)
+			if len(c.b) < 4 {
+				return cmd, db
+			}
+			size = int(binary.LittleEndian.Uint32(c.b))
+		case 0x05: // binary
+			if len(c.b) < 4 {
+				return cmd, db
+			}
+			size = int(binary.LittleEndian.Uint32(c.b)) + 5
+		case 0x07: // ObjectId
+			size = 12
+		case 0x08: // bool
+			size = 1
+		case 0x10: // int32
+			size = 4
+		case 0x13: // decimal128
+			size = 16
+		case 0x06, 0x0a, 0x7f, 0xff: // undefined, null, max key, min key
+		default:
+			return cmd, db
+		}
+		c.take(size)
+	}
+	return cmd, db
+}
+
+// detectRDP recognizes an X.224 Connection Request in a TPKT, as RDP clients
+// open with, and the user from its "Cookie: mstshash=" routing token.
+func detectRDP(head []byte) (Detection, bool) {
+	if len(head) < 11 || head[0] != 3 || head[1] != 0 || head[5] != 0xe0 {
+		return Detection{}, false
+	}
+	if n := binary.BigEndian.Uint16(head[2:]); n < 11 || int(head[4]) != int(n)-5 {
+		return Detection{}, false
+	}
+	d := Detection{Protocol: ProtocolRDP}
+	if _, rest, ok := bytes.Cut(head[11:], []byte("Cookie: mstshash=")); ok {
+		user, _, _ := bytes.Cut(rest, []byte("\r\n"))
+		d.User = string(user)
+	}
+	return d, true
+}
+
+// detectRedis recognizes a RESP array or simple string, or an inline PING.
+func detectRedis(head []byte) (Detection, bool) {
+	s := strings.TrimSpace(string(head))
+	if strings.HasPrefix(s, "*") || strings.HasPrefix(s, "+") || strings.HasPrefix(strings.ToUpper(s), "PING") {
+		return Detection{Protocol: ProtocolRedis}, true
+	}
+	return Detection{}, false
+}
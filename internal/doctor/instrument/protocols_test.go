@@ -0,0 +1,122 @@
+package instrument
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// clientHello captures the first flight of a real TLS client.
+func clientHello(t *testing.T, cfg *tls.Config) []byte {
+	t.Helper()
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	go tls.Client(a, cfg).Handshake()
+	b.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, MaxHeaderBytes)
+	n, err := b.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf[:n]
+}
+
+func TestDetect(t *testing.T) {
+	hello := clientHello(t, &tls.Config{ServerName: "db.example.com", NextProtos: []string{"h2", "http/1.1"}})
+	tls12 := clientHello(t, &tls.Config{ServerName: "old.example.com", MaxVersion: tls.VersionTLS12})
+
+	mysqlPacket := func(seq byte, body []byte) []byte {
+		n := len(body)
+		return append([]byte{byte(n), byte(n >> 8), byte(n >> 16), seq}, body...)
+	}
+	mysqlGreeting := mysqlPacket(0, append([]byte("\x0a8.0.36\x00"), make([]byte, 40)...))
+	response := binary.LittleEndian.AppendUint32(nil, mysqlProtocol41|mysqlSecureConn|mysqlConnectWithDB)
+	response = append(response, make([]byte, 28)...) // max packet, charset, filler
+	response = append(response, "app\x00\x03abc"+"shop\x00"...)
+	mysqlResponse := mysqlPacket(1, response)
+
+	params := "user\x00app\x00database\x00shop\x00\x00"
+	startup := binary.BigEndian.AppendUint32(nil, uint32(8+len(params)))
+	startup = binary.BigEndian.AppendUint32(startup, pgProtocol3)
+	startup = append(startup, params...)
+
+	tests := []struct {
+		name string
+		head []byte
+		want Detection
+	}{
+		{"empty", nil, Detection{Protocol: ProtocolTCP}},
+		{"TLS ClientHello", hello, Detection{Protocol: ProtocolTLS, Version: "TLS 1.3", SNI: "db.example.com", ALPN: []string{"h2", "http/1.1"}}},
+		{"TLS 1.2 ClientHello", tls12, Detection{Protocol: ProtocolTLS, Version: "TLS 1.2", SNI: "old.example.com"}},
+		{"TLS server record", []byte{0x16, 3, 3, 0, 0x5a, 2, 0, 0, 0x56}, Detection{Protocol: ProtocolTLS}},
+		{"HTTP/2 preface", []byte(http2Preface + "\x00\x00\x00\x04\x00\x00\x00\x00\x00"), Detection{Protocol: ProtocolHTTP2}},
+		{"HTTP request", []byte("GET /health HTTP/1.1\r\nHost: x\r\n\r\n"), Detection{Protocol: ProtocolHTTP, Method: "GET", Path: "/health"}},
+		{"MySQL greeting", mysqlGreeting, Detection{Protocol: ProtocolMySQL, Version: "8.0.36"}},
+		{"MySQL handshake response", mysqlResponse, Detection{Protocol: ProtocolMySQL, User: "app", Database: "shop"}},
+		{"PostgreSQL startup", startup, Detection{Protocol: ProtocolPostgres, Version: "3.0", User: "app", Database: "shop"}},
+		{"PostgreSQL SSL request", []byte{0, 0, 0, 8, 0x04, 0xd2, 0x16, 0x2f}, Detection{Protocol: ProtocolPostgres, Version: "SSL request"}},
+		{"VNC", []byte("RFB 003.008\n"), Detection{Protocol: ProtocolVNC, Version: "3.8"}},
+		{"SSH", []byte("SSH-2.0-OpenSSH_9.6\r\n"), Detection{Protocol: ProtocolSSH, Version: "OpenSSH_9.6"}},
+
+		// Cut short by the peek limit: what precedes the cut still counts.
+		{"truncated TLS ClientHello", hello[:len(hello)-1], Detection{Protocol: ProtocolTLS, Version: "TLS 1.3", SNI: "db.example.com", ALPN: []string{"h2", "http/1.1"}}},
+		{"truncated TLS record header", hello[:8], Detection{Protocol: ProtocolTLS}},
+		{"truncated PostgreSQL startup", startup[:len(startup)-8], Detection{Protocol: ProtocolPostgres, Version: "3.0", User: "app"}},
+		{"truncated MySQL greeting", mysqlGreeting[:8], Detection{Protocol: ProtocolTCP}},
+		{"truncated VNC", []byte("RFB 003."), Detection{Protocol: ProtocolTCP}},
+		{"truncated HTTP/2 preface", []byte(http2Preface[:10]), Detection{Protocol: ProtocolTCP}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect(tt.head); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Detect() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectionString(t *testing.T) {
+	d := Detection{Protocol: ProtocolTLS, Version: "TLS 1.3", SNI: "example.com", ALPN: []string{"h2", "http/1.1"}}
+	if got, want := d.String(), "TLS/SSL (TLS 1.3, sni=example.com, alpn=h2,http/1.1)"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := (Detection{Protocol: ProtocolTCP}).String(); got != ProtocolTCP {
+		t.Errorf("String() = %q, want %q", got, ProtocolTCP)
+	}
+}
+
+func TestDetectMongoShortDocument(t *testing.T) {
+	// An OP_MSG whose body section claims a BSON document of 0 bytes.
+	head := binary.LittleEndian.AppendUint32(nil, 29)
+	head = binary.LittleEndian.AppendUint32(head, 1)
+	head = binary.LittleEndian.AppendUint32(head, 0)
+	head = binary.LittleEndian.AppendUint32(head, mongoOpMsg)
+	head = append(head, 0, 0, 0, 0, 0)
+	head = append(head, 0, 0, 0, 0, 0x10, 'x', 0, 0)
+	if got := Detect(head); got.Protocol != ProtocolMongo || got.Command != "" {
+		t.Errorf("Detect() = %+v, want MongoDB without a command", got)
+	}
+}
+
+func FuzzDetect(f *testing.F) {
+	f.Add([]byte(http2Preface))
+	f.Add([]byte("RFB 003.008\n"))
+	f.Add([]byte{0, 0, 0, 8, 0x04, 0xd2, 0x16, 0x2f})
+	f.Add([]byte("\x0d\x00\x00\x00\x0a8.0.36\x00"))
+	f.Add([]byte{0x16, 3, 1, 0, 0x40, 1, 0, 0, 0x3c, 3, 3})
+	f.Add([]byte{29, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0xdd, 7, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	f.Add([]byte{3, 0, 0, 11, 6, 0xe0, 0, 0, 0, 0, 0})
+	f.Fuzz(func(t *testing.T, head []byte) {
+		if len(head) > MaxHeaderBytes {
+			head = head[:MaxHeaderBytes]
+		}
+		d := Detect(head)
+		if d.Protocol == "" {
+			t.Errorf("Detect(%q) returned no protocol", head)
+		}
+	})
+}
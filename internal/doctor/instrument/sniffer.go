@@ -9,68 +9,32 @@ import (
 )
 
 const (
-	// MaxHeaderBytes is the maximum bytes used for protocol detection.
-	MaxHeaderBytes = 512
+	// MaxHeaderBytes is the maximum bytes used for protocol detection. It fits
+	// a typical TLS ClientHello, whose SNI may come late among the extensions.
+	MaxHeaderBytes = 2048
 )
 
 // Protocol constants for DetectProtocol result.
 const (
-	ProtocolHTTP  = "HTTP"
-	ProtocolSSH   = "SSH"
-	ProtocolRedis = "Redis"
-	ProtocolTLS   = "TLS/SSL"
-	ProtocolTCP   = "TCP (Raw)"
+	ProtocolHTTP     = "HTTP"
+	ProtocolHTTP2    = "HTTP/2"
+	ProtocolGRPC     = "gRPC"
+	ProtocolSSH      = "SSH"
+	ProtocolRedis    = "Redis"
+	ProtocolTLS      = "TLS/SSL"
+	ProtocolPostgres = "PostgreSQL"
+	ProtocolMySQL    = "MySQL"
+	ProtocolMongo    = "MongoDB"
+	ProtocolRDP      = "RDP"
+	ProtocolVNC      = "VNC"
+	ProtocolTCP      = "TCP (Raw)"
 )
 
 // DetectProtocol analyzes the first bytes of a stream (up to MaxHeaderBytes) and returns
-// the guessed protocol. Used for Deep Packet Inspection (DPI) logic.
+// the guessed protocol. Used for Deep Packet Inspection (DPI) logic. See Detect
+// for the details extracted along the way.
 func DetectProtocol(head []byte) string {
-	if len(head) == 0 {
-		logger.Debug("DetectProtocol: empty head, returning TCP (Raw)",
-			zap.String("component", "instrument.Sniffer"))
-		return ProtocolTCP
-	}
-	// TLS/SSL: magic byte 0x16 for Handshake
-	if head[0] == 0x16 {
-		logger.Debug("DetectProtocol: TLS/SSL handshake magic 0x16 detected",
-			zap.String("component", "instrument.Sniffer"))
-		return ProtocolTLS
-	}
-	// Normalize to ASCII for string checks
-	headStr := strings.TrimSpace(string(head))
-	upper := strings.ToUpper(headStr)
-	// HTTP: GET, POST, HEAD, PUT, DELETE, PATCH, OPTIONS, CONNECT, or response HTTP/
-	if strings.HasPrefix(upper, "GET ") ||
-		strings.HasPrefix(upper, "POST ") ||
-		strings.HasPrefix(upper, "HEAD ") ||
-		strings.HasPrefix(upper, "PUT ") ||
-		strings.HasPrefix(upper, "DELETE ") ||
-		strings.HasPrefix(upper, "PATCH ") ||
-		strings.HasPrefix(upper, "OPTIONS ") ||
-		strings.HasPrefix(upper, "CONNECT ") ||
-		strings.HasPrefix(upper, "HTTP/") {
-		logger.Debug("DetectProtocol: HTTP signature detected",
-			zap.String("component", "instrument.Sniffer"),
-			zap.String("prefix", headStr[:min(20, len(headStr))]))
-		return ProtocolHTTP
-	}
-	// SSH: starts with SSH-
-	if strings.HasPrefix(headStr, "SSH-") {
-		logger.Debug("DetectProtocol: SSH banner detected",
-			zap.String("component", "instrument.Sniffer"))
-		return ProtocolSSH
-	}
-	// Redis: Array (*), String (+), or PING
-	if strings.HasPrefix(headStr, "*") || strings.HasPrefix(headStr, "+") ||
-		strings.HasPrefix(upper, "PING") {
-		logger.Debug("DetectProtocol: Redis signature detected",
-			zap.String("component", "instrument.Sniffer"))
-		return ProtocolRedis
-	}
-	logger.Debug("DetectProtocol: no signature match, returning TCP (Raw)",
-		zap.String("component", "instrument.Sniffer"),
-		zap.Int("head_len", len(head)))
-	return ProtocolTCP
+	return Detect(head).Protocol
 }
 
 // SniffFromReader reads up to MaxHeaderBytes from r and runs DetectProtocol.
@@ -2,7 +2,9 @@ package doctor
 
 import (
 	"bufio"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
 	"strings"
 	"time"
@@ -51,7 +53,7 @@ func GrabBanner(target string) string {
 		zap.String("component", "doctor.probe"),
 		zap.String("target", target))
 
-	conn, err := net.DialTimeout("tcp", target, 5*time.Second)
+	peek, err := readGreeting(target)
 	if err != nil {
 		logger.Warn("GrabBanner: dial failed",
 			zap.String("component", "doctor.probe"),
@@ -59,16 +61,6 @@ func GrabBanner(target string) string {
 			zap.Error(err))
 		return ""
 	}
-	defer conn.Close()
-
-	_ = conn.SetReadDeadline(time.Now().Add(BannerWait))
-	rd := bufio.NewReader(conn)
-	// Peek first bytes to detect protocol
-	peek, err := rd.Peek(instrument.MaxHeaderBytes)
-	if err != nil && err.Error() != "EOF" {
-		// May get timeout or connection reset
-		peek = []byte{}
-	}
 	if len(peek) > 0 {
 		proto := instrument.DetectProtocol(peek)
 		logger.Debug("GrabBanner: detected protocol from peek",
@@ -77,7 +69,6 @@ func GrabBanner(target string) string {
 			zap.String("protocol", proto))
 		if proto == instrument.ProtocolHTTP {
 			// Reconnect and send HEAD for HTTP
-			_ = conn.Close()
 			return grabHTTPBanner(target)
 		}
 		// Return first line(s) as banner
@@ -96,6 +87,129 @@ func GrabBanner(target string) string {
 	return grabHTTPBanner(target)
 }
 
+// readGreeting connects to target and returns what the server sends unasked
+// within BannerWait, up to MaxHeaderBytes; often nothing.
+func readGreeting(target string) ([]byte, error) {
+	conn, err := net.DialTimeout("tcp", target, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(BannerWait))
+	// Peek returns what arrived before the deadline along with the timeout error.
+	peek, _ := bufio.NewReaderSize(conn, instrument.MaxHeaderBytes).Peek(instrument.MaxHeaderBytes)
+	return peek, nil
+}
+
+// ProbeResult is what Probe learned about the service on a port.
+type ProbeResult struct {
+	Banner    string               // Greeting or HTTP response head, when readable
+	Detection instrument.Detection // Protocol and details
+}
+
+// Probe identifies the service on target (host:port). Servers that speak
+// first (SSH, MySQL, VNC, ...) are recognized from their greeting; otherwise
+// a TLS handshake, an HTTP HEAD and a PostgreSQL SSL request are tried in turn.
+func Probe(target string) ProbeResult {
+	logger.Debug("Probe: connecting",
+		zap.String("component", "doctor.probe"),
+		zap.String("target", target))
+
+	res := ProbeResult{Detection: instrument.Detection{Protocol: instrument.ProtocolTCP}}
+	peek, err := readGreeting(target)
+	switch {
+	case err != nil:
+		logger.Warn("Probe: dial failed",
+			zap.String("component", "doctor.probe"),
+			zap.String("target", target),
+			zap.Error(err))
+		return res
+	case len(peek) > 0:
+		res.Banner, res.Detection = printableLine(peek), instrument.Detect(peek)
+	default:
+		if d, ok := probeTLS(target); ok {
+			res.Detection = d
+		} else if banner := grabHTTPBanner(target); banner != "" && instrument.DetectProtocol([]byte(banner)) == instrument.ProtocolHTTP {
+			res.Banner, res.Detection = banner, instrument.Detect([]byte(banner))
+		} else if d, ok := probePostgres(target); ok {
+			res.Detection = d
+		}
+	}
+	logger.Debug("Probe: result",
+		zap.String("component", "doctor.probe"),
+		zap.String("target", target),
+		zap.String("detection", res.Detection.String()))
+	return res
+}
+
+// probeTimeout bounds each active probe of a silent server.
+const probeTimeout = 2 * time.Second
+
+// probeTLS tries a TLS handshake and reports the version, the ALPN protocol
+// the server picked and the name on its certificate.
+func probeTLS(target string) (instrument.Detection, bool) {
+	conn, err := net.DialTimeout("tcp", target, probeTimeout)
+	if err != nil {
+		return instrument.Detection{}, false
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(probeTimeout))
+	tc := tls.Client(conn, &tls.Config{
+		InsecureSkipVerify: true, // identifying the service, not trusting it
+		NextProtos:         []string{"h2", "http/1.1"},
+	})
+	if err := tc.Handshake(); err != nil {
+		return instrument.Detection{}, false
+	}
+	st := tc.ConnectionState()
+	d := instrument.Detection{Protocol: instrument.ProtocolTLS, Version: tls.VersionName(st.Version)}
+	if st.NegotiatedProtocol != "" {
+		d.ALPN = []string{st.NegotiatedProtocol}
+	}
+	if len(st.PeerCertificates) > 0 {
+		cert := st.PeerCertificates[0]
+		d.SNI = cert.Subject.CommonName
+		if len(cert.DNSNames) > 0 {
+			d.SNI = cert.DNSNames[0]
+		}
+	}
+	return d, true
+}
+
+// probePostgres sends a PostgreSQL SSLRequest; a server answers with a single
+// 'S' (TLS available) or 'N'.
+func probePostgres(target string) (instrument.Detection, bool) {
+	conn, err := net.DialTimeout("tcp", target, probeTimeout)
+	if err != nil {
+		return instrument.Detection{}, false
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(probeTimeout))
+	if _, err := conn.Write([]byte{0, 0, 0, 8, 0x04, 0xd2, 0x16, 0x2f}); err != nil {
+		return instrument.Detection{}, false
+	}
+	reply := make([]byte, 2)
+	if n, _ := io.ReadAtLeast(conn, reply, 1); n != 1 || (reply[0] != 'S' && reply[0] != 'N') {
+		return instrument.Detection{}, false
+	}
+	d := instrument.Detection{Protocol: instrument.ProtocolPostgres, Version: "SSL supported"}
+	if reply[0] == 'N' {
+		d.Version = "SSL not supported"
+	}
+	return d, true
+}
+
+// printableLine returns the first line of a greeting, or "" for binary ones.
+func printableLine(b []byte) string {
+	line, _, _ := strings.Cut(string(b), "\n")
+	line = strings.TrimSpace(line)
+	if strings.IndexFunc(line, func(r rune) bool { return r < ' ' || r > '~' }) >= 0 {
+		return ""
+	}
+	return line
+}
+
 func grabHTTPBanner(target string) string {
 	logger.Debug("GrabBanner: attempting HTTP HEAD",
 		zap.String("component", "doctor.probe"),
@@ -0,0 +1,55 @@
+package doctor
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/A-Flex-Box/cli/internal/doctor/instrument"
+)
+
+func TestProbeTLS(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	target := srv.Listener.Addr().String()
+
+	want := instrument.Detection{Protocol: instrument.ProtocolTLS, Version: "TLS 1.3", SNI: "example.com", ALPN: []string{"h2"}}
+	d, ok := probeTLS(target)
+	if !ok || d.String() != want.String() {
+		t.Errorf("probeTLS() = %v, %v, want %v", d, ok, want)
+	}
+	// A TLS server waits for the client, so Probe falls through to the handshake.
+	if res := Probe(target); res.Detection.String() != want.String() || res.Banner != "" {
+		t.Errorf("Probe() = %+v, want %v", res, want)
+	}
+}
+
+func TestProbeGreeting(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+			conn.Close()
+		}
+	}()
+
+	res := Probe(ln.Addr().String())
+	if res.Detection.Protocol != instrument.ProtocolSSH || !strings.HasPrefix(res.Banner, "SSH-2.0") {
+		t.Errorf("Probe() = %+v, want SSH", res)
+	}
+	if _, ok := probeTLS(ln.Addr().String()); ok {
+		t.Error("probeTLS() succeeded against an SSH server")
+	}
+}
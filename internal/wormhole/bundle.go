@@ -0,0 +1,376 @@
+package wormhole
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/A-Flex-Box/cli/internal/logger"
+)
+
+// bundleSource pairs a manifest entry with the local path it was read from.
+type bundleSource struct {
+	entry ManifestEntry
+	local string
+}
+
+// buildBundle walks paths (files, directories, symlinks) into manifest order.
+// Symlinks are recorded, never followed; special files are skipped.
+func buildBundle(paths []string) ([]bundleSource, int64, error) {
+	var sources []bundleSource
+	var total int64
+	seen := make(map[string]bool)
+
+	for _, p := range paths {
+		p = filepath.Clean(p)
+		root := filepath.Base(p)
+		if root == "." || root == ".." || root == string(filepath.Separator) {
+			abs, err := filepath.Abs(p)
+			if err != nil {
+				return nil, 0, err
+			}
+			root = filepath.Base(abs)
+		}
+		if seen[root] {
+			return nil, 0, fmt.Errorf("duplicate top-level name %q (rename one of the inputs)", root)
+		}
+		seen[root] = true
+
+		err := filepath.WalkDir(p, func(local string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(p, local)
+			if err != nil {
+				return err
+			}
+			name := path.Join(root, filepath.ToSlash(rel))
+
+			info, err := os.Lstat(local)
+			if err != nil {
+				return err
+			}
+			e := ManifestEntry{Path: name, Mode: uint32(info.Mode().Perm())}
+			switch {
+			case info.Mode()&fs.ModeSymlink != 0:
+				target, err := os.Readlink(local)
+				if err != nil {
+					return err
+				}
+				e.Kind = EntrySymlink
+				e.Link = filepath.ToSlash(target)
+			case info.IsDir():
+				e.Kind = EntryDir
+			case info.Mode().IsRegular():
+				e.Kind = EntryFile
+				e.Size = info.Size()
+				total += e.Size
+			default:
+				logger.Info("wormhole.buildBundle skip special file", logger.Context("params", map[string]any{
+					"path": local, "mode": info.Mode().String(),
+				})...)
+				return nil
+			}
+			sources = append(sources, bundleSource{entry: e, local: local})
+			return nil
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return sources, total, nil
+}
+
+// bundleName returns the display name of a bundle for MetaHeader.Name.
+func bundleName(paths []string) string {
+	if len(paths) == 1 {
+		return filepath.Base(filepath.Clean(paths[0]))
+	}
+	return fmt.Sprintf("%d items", len(paths))
+}
+
+// safeJoin resolves a manifest path under root, rejecting absolute paths,
+// ".." escapes and anything else that is not local to root.
+func safeJoin(root, rel string) (string, error) {
+	if rel == "" || strings.ContainsRune(rel, '\\') || strings.ContainsRune(rel, 0) {
+		return "", fmt.Errorf("%w: %q", ErrUnsafePath, rel)
+	}
+	local := filepath.FromSlash(rel)
+	if !filepath.IsLocal(local) {
+		return "", fmt.Errorf("%w: %q", ErrUnsafePath, rel)
+	}
+	return filepath.Join(root, local), nil
+}
+
+// checkNoSymlinkParents ensures no existing parent of target below root is a
+// symlink, so writes cannot be redirected outside root.
+func checkNoSymlinkParents(root, target string) error {
+	rel, err := filepath.Rel(root, filepath.Dir(target))
+	if err != nil || rel == "." {
+		return err
+	}
+	cur := root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		cur = filepath.Join(cur, part)
+		info, err := os.Lstat(cur)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("%w: %s is a symlink", ErrUnsafePath, cur)
+		}
+	}
+	return nil
+}
+
+// safeLinkTarget reports whether a symlink at linkPath pointing to target stays
+// inside root. A lexical check is not enough once links exist: with top/s -> ".."
+// the target "s/../../etc" of top/t cleans to a path inside root but resolves
+// outside it. So the target is walked step by step and may not pass through a
+// symlink, whether one on disk or one of links, the paths of received links.
+func safeLinkTarget(root, linkPath, target string, links map[string]bool) bool {
+	if target == "" || strings.ContainsRune(target, 0) {
+		return false
+	}
+	local := filepath.FromSlash(target)
+	if filepath.IsAbs(local) || filepath.VolumeName(local) != "" {
+		return false
+	}
+	cur := filepath.Dir(linkPath)
+	for _, part := range strings.Split(local, string(filepath.Separator)) {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			cur = filepath.Dir(cur)
+		default:
+			cur = filepath.Join(cur, part)
+		}
+		if rel, err := filepath.Rel(root, cur); err != nil || (rel != "." && !filepath.IsLocal(rel)) {
+			return false
+		}
+		if links[cur] {
+			return false
+		}
+		if info, err := os.Lstat(cur); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// receiveBundle reads a Manifest and the file bodies that follow it into outDir.
+// The whole manifest is validated before anything is written. Symlinks are created
+// last and only when they resolve inside outDir; refused ones are returned as skipped.
+func receiveBundle(r io.Reader, outDir string, h *MetaHeader, opts *TransferOptions) (files, skipped []string, err error) {
+	m, err := ReadManifest(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	targets := make([]string, len(m.Entries))
+	var total int64
+	count := 0
+	for i, e := range m.Entries {
+		target, err := safeJoin(outDir, e.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		targets[i] = target
+		// The offer only named the bundle, so NoClobber is enforced here, per
+		// entry; existing directories are merged into.
+		if opts.noClobber() && e.Kind != EntryDir {
+			if _, err := os.Lstat(target); err == nil {
+				return nil, nil, fmt.Errorf("%w: %s", ErrExists, e.Path)
+			}
+		}
+		switch e.Kind {
+		case EntryFile:
+			if e.Size < 0 {
+				return nil, nil, fmt.Errorf("wormhole: negative size for %q", e.Path)
+			}
+			total += e.Size
+			count++
+		case EntryDir, EntrySymlink:
+		default:
+			return nil, nil, fmt.Errorf("wormhole: unknown manifest entry kind %q for %q", e.Kind, e.Path)
+		}
+	}
+	if total != h.Size {
+		return nil, nil, fmt.Errorf("wormhole: manifest size %d does not match header size %d", total, h.Size)
+	}
+
+	var done int64
+	index := 0
+	var dirs []int
+	opts.progress(0, total)
+	for i, e := range m.Entries {
+		target := targets[i]
+		if err := checkNoSymlinkParents(outDir, target); err != nil {
+			return files, skipped, err
+		}
+		switch e.Kind {
+		case EntryDir:
+			// MkdirAll accepts a symlink to a directory, which the chmod
+			// below would then follow out of outDir.
+			if info, err := os.Lstat(target); err == nil && !info.IsDir() {
+				return files, skipped, fmt.Errorf("%w: %s exists and is not a directory", ErrUnsafePath, target)
+			}
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return files, skipped, err
+			}
+			dirs = append(dirs, i)
+
+		case EntryFile:
+			index++
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return files, skipped, err
+			}
+			fp := FileProgress{Name: e.Path, Index: index, Count: count, Total: e.Size}
+			opts.file(fp)
+			base := done
+			if err := receiveBundleFile(r, target, e, func(n int64) {
+				fp.Current = n
+				opts.file(fp)
+				opts.progress(base+n, total)
+			}); err != nil {
+				return files, skipped, err
+			}
+			done += e.Size
+			files = append(files, target)
+		}
+	}
+
+	// Symlinks go last so a received link can never redirect a later write.
+	links := make(map[string]bool)
+	for i, e := range m.Entries {
+		if e.Kind == EntrySymlink {
+			links[targets[i]] = true
+		}
+	}
+	for i, e := range m.Entries {
+		if e.Kind != EntrySymlink {
+			continue
+		}
+		target := targets[i]
+		// Links created so far may now sit in target's parents.
+		if err := checkNoSymlinkParents(outDir, target); err != nil {
+			return files, skipped, err
+		}
+		if !safeLinkTarget(outDir, target, e.Link, links) {
+			logger.Warn("wormhole.receiveBundle unsafe symlink skipped", logger.Context("params", map[string]any{
+				"path": e.Path, "link": e.Link,
+			})...)
+			skipped = append(skipped, e.Path)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return files, skipped, err
+		}
+		if info, err := os.Lstat(target); err == nil && !info.IsDir() {
+			os.Remove(target)
+		}
+		if err := os.Symlink(filepath.FromSlash(e.Link), target); err != nil {
+			return files, skipped, err
+		}
+	}
+
+	// Apply directory modes deepest-first, after their contents are written.
+	for j := len(dirs) - 1; j >= 0; j-- {
+		e := m.Entries[dirs[j]]
+		if e.Mode == 0 {
+			continue
+		}
+		if info, err := os.Lstat(targets[dirs[j]]); err == nil && info.IsDir() {
+			os.Chmod(targets[dirs[j]], os.FileMode(e.Mode))
+		}
+	}
+	return files, skipped, nil
+}
+
+// receiveBundleFile writes exactly e.Size bytes from r to target via a temp file
+// in the same directory, so an existing symlink at target is replaced, not followed.
+// The temp file is only renamed into place once the sender's trailer hash matches.
+func receiveBundleFile(r io.Reader, target string, e ManifestEntry, onChunk func(int64)) error {
+	f, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*"+partSuffix)
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	hasher := sha256.New()
+	if err := copyBody(io.MultiWriter(f, hasher), r, e.Size, onChunk); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if _, err := verifyTrailer(r, hasher); err != nil {
+		return fmt.Errorf("%s: %w", e.Path, err)
+	}
+	perm := os.FileMode(e.Mode)
+	if perm == 0 {
+		perm = 0644
+	}
+	if err := os.Chmod(tmp, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, target)
+}
+
+// sendBundle streams the manifest and every file body in order.
+func sendBundle(w io.Writer, sources []bundleSource, total int64, opts *TransferOptions) error {
+	m := &Manifest{Entries: make([]ManifestEntry, len(sources))}
+	count := 0
+	for i, s := range sources {
+		m.Entries[i] = s.entry
+		if s.entry.Kind == EntryFile {
+			count++
+		}
+	}
+	if err := WriteManifest(w, m); err != nil {
+		return err
+	}
+
+	var done int64
+	index := 0
+	opts.progress(0, total)
+	for _, s := range sources {
+		if s.entry.Kind != EntryFile {
+			continue
+		}
+		index++
+		fp := FileProgress{Name: s.entry.Path, Index: index, Count: count, Total: s.entry.Size}
+		opts.file(fp)
+		f, err := os.Open(s.local)
+		if err != nil {
+			return err
+		}
+		base := done
+		hasher := sha256.New()
+		err = copyBody(w, io.TeeReader(f, hasher), s.entry.Size, func(n int64) {
+			fp.Current = n
+			opts.file(fp)
+			opts.progress(base+n, total)
+		})
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w (file changed while sending?)", s.local, err)
+		}
+		if err := WriteTrailer(w, &Trailer{Hash: hex.EncodeToString(hasher.Sum(nil))}); err != nil {
+			return err
+		}
+		done += s.entry.Size
+	}
+	return nil
+}
@@ -1,72 +1,64 @@
 package wormhole
 
 import (
-	"crypto/rand"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
+	"path"
 	"path/filepath"
-	"strings"
+	"time"
 
 	"github.com/A-Flex-Box/cli/internal/logger"
 	"github.com/charmbracelet/lipgloss"
 	"go.uber.org/zap"
 )
 
-const roomIDLen = 4
-
-// RoomID converts a code string to 4 bytes for the relay.
-func RoomID(code string) [roomIDLen]byte {
-	var id [roomIDLen]byte
-	copy(id[:], code)
-	return id
-}
-
-// ParseRelayAddr parses "tcp://host:port" to host:port.
-func ParseRelayAddr(addr string) (string, error) {
-	addr = strings.TrimSpace(addr)
-	if strings.HasPrefix(addr, "tcp://") {
-		return addr[6:], nil
-	}
-	return addr, nil
-}
-
 // Role bytes for relay protocol (must match PAKE: 0=sender, 1=receiver).
 const (
 	RoleSender   = 0
 	RoleReceiver = 1
 )
 
-// DialRelay connects to relay, sends RoomID+role, and returns the connection (piped to opposite role after match).
+// DialRelay connects to relay, sends the relay header (RoomID+role), and returns the connection (piped to opposite role after match).
 // Relay pairs sender only with receiver to avoid "can't have its own role" in PAKE.
 func DialRelay(relayAddr, code string, isSender bool) (net.Conn, error) {
 	role := RoleReceiver
 	if isSender {
 		role = RoleSender
 	}
+	return dialRelay(relayAddr, RoomID(code), role, false)
+}
+
+// dialRelay connects to relay and sends the header for roomID and role, or with
+// mailbox for a mailbox store (RoleSender) or fetch (RoleReceiver).
+func dialRelay(relayAddr, roomID string, role int, mailbox bool) (net.Conn, error) {
 	logger.Info("wormhole.DialRelay start", logger.Context("params", map[string]any{
-		"relay_addr": relayAddr, "code": code, "room_id_len": roomIDLen, "role": role,
+		"relay_addr": MaskRelayAddr(relayAddr), "room_id": roomID, "role": role, "mailbox": mailbox,
 	})...)
-	addr, err := ParseRelayAddr(relayAddr)
+	ep, err := parseRelayEndpoint(relayAddr)
 	if err != nil {
-		logger.Warn("wormhole.DialRelay parse failed", zap.Error(err), zap.String("relay_addr", relayAddr))
+		logger.Warn("wormhole.DialRelay parse failed", zap.Error(err), zap.String("relay_addr", MaskRelayAddr(relayAddr)))
 		return nil, err
 	}
-	conn, err := net.Dial("tcp", addr)
+	addr := ep.addr
+	conn, err := ep.dial()
 	if err != nil {
-		logger.Warn("wormhole.DialRelay dial failed", zap.Error(err), zap.String("addr", addr), zap.String("code", code))
+		logger.Warn("wormhole.DialRelay dial failed", zap.Error(err), zap.String("addr", addr), zap.String("scheme", ep.scheme), zap.String("room_id", roomID))
 		return nil, err
 	}
-	id := RoomID(code)
-	if _, err := conn.Write(id[:]); err != nil {
+	if err := writeRelayHeader(conn, ep.token, roomID, role, mailbox); err != nil {
 		conn.Close()
-		logger.Warn("wormhole.DialRelay write room_id failed", zap.Error(err))
+		logger.Warn("wormhole.DialRelay write header failed", zap.Error(err))
 		return nil, err
 	}
-	if _, err := conn.Write([]byte{byte(role)}); err != nil {
+	if err := readRelayStatus(conn); err != nil {
 		conn.Close()
-		logger.Warn("wormhole.DialRelay write role failed", zap.Error(err))
+		logger.Warn("wormhole.DialRelay refused", zap.Error(err), zap.String("addr", addr))
 		return nil, err
 	}
 	logger.Info("wormhole.DialRelay done", logger.Context("result", map[string]any{
@@ -75,23 +67,310 @@ func DialRelay(relayAddr, code string, isSender bool) (net.Conn, error) {
 	return conn, nil
 }
 
-// SendFile sends a file through the wormhole.
-func SendFile(relayAddr, code, filePath string, onProgress func(int64, int64)) error {
-	logger.Info("wormhole.SendFile start", logger.Context("params", map[string]any{
-		"relay_addr": relayAddr, "code": code, "file_path": filePath, "has_progress_cb": onProgress != nil,
-	})...)
-	conn, err := DialRelay(relayAddr, code, true)
-	if err != nil {
+// readRelayStatus reads the relay's one-byte admission status.
+func readRelayStatus(conn net.Conn) error {
+	var st [1]byte
+	if _, err := io.ReadFull(conn, st[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("wormhole: relay closed the connection before admitting it (relay older than this client?)")
+		}
 		return err
 	}
-	defer conn.Close()
+	switch st[0] {
+	case relayStatusOK:
+		return nil
+	case relayStatusUnauthorized:
+		return ErrRelayAuth
+	case relayStatusRoomLimit:
+		return ErrRelayRoomLimit
+	case relayStatusBusy:
+		return ErrRelayBusy
+	case relayStatusNoMailbox:
+		return ErrRelayNoMailbox
+	case relayStatusRoleTaken:
+		return ErrRelayRoleTaken
+	default:
+		return fmt.Errorf("wormhole: unknown relay status %d", st[0])
+	}
+}
+
+// TransferOptions holds optional settings for file and text transfers.
+type TransferOptions struct {
+	OnProgress func(current, total int64) // Overall payload bytes
+	OnFile     func(FileProgress)         // Per-file progress for multi-file payloads
+	OnPath     func(PathInfo)             // Called once the session is direct or relayed
+	NoDirect   bool                       // Stay on the relay even when a LAN path exists
+	Output     io.Writer                  // Receive: write file, stream and text bodies here instead of outDir
+	OnOffer    func(Offer) OfferDecision  // Receive: asked before anything is accepted; nil accepts
+	NoClobber  bool                       // Receive: decline offers that would overwrite existing files
+	NoCompress bool                       // Send: never offer compression
+	OnWire     func(wire int64)           // Compressed body bytes sent or received so far
+	Limit      *Limiter                   // Bandwidth cap for the session; may change while running
+	OnSAS      func(SAS)                  // Called with the session's short authentication string
+	ConfirmSAS func(SAS) bool             // Asks the user whether both sides show the same SAS
+	VerifySAS  bool                       // Require ConfirmSAS to return true before any payload moves
+	MailboxTTL time.Duration              // Mailbox: how long the relay keeps the payload; 0 = relay default
+}
+
+// Offer previews an incoming payload before the receiver accepts it.
+type Offer struct {
+	Type      PayloadType
+	Name      string // Name proposed by the sender (file, stream or bundle root)
+	Size      int64  // Total bytes, -1 for streams
+	Hash      string // Sender's SHA-256 (single files)
+	Exists    bool   // Name already exists in the output directory
+	Renamable bool   // OfferDecision.Name is honoured (files and streams saved to disk)
+}
+
+// OfferDecision is the receiver's answer to an Offer.
+type OfferDecision struct {
+	Accept bool
+	Name   string // Save under this name instead (renamable offers only)
+	Reason string // Sent to the sender when declining
+}
+
+// FileProgress reports progress of one entry inside a multi-file payload.
+type FileProgress struct {
+	Name    string // Relative path of the entry
+	Index   int    // 1-based position among regular files
+	Count   int    // Number of regular files in the payload
+	Current int64  // Bytes of this file transferred so far
+	Total   int64  // Size of this file
+}
+
+func (o *TransferOptions) progress(current, total int64) {
+	if o != nil && o.OnProgress != nil {
+		o.OnProgress(current, total)
+	}
+}
+
+func (o *TransferOptions) file(p FileProgress) {
+	if o != nil && o.OnFile != nil {
+		o.OnFile(p)
+	}
+}
+
+func (o *TransferOptions) path(p PathInfo) {
+	if o != nil && o.OnPath != nil {
+		o.OnPath(p)
+	}
+}
+
+func (o *TransferOptions) mailboxTTL() time.Duration {
+	if o == nil {
+		return 0
+	}
+	return o.MailboxTTL
+}
+
+func (o *TransferOptions) limiter() *Limiter {
+	if o == nil {
+		return nil
+	}
+	return o.Limit
+}
+
+// checkSAS reports sas and, when VerifySAS is set, requires confirmation.
+func (o *TransferOptions) checkSAS(sas SAS) error {
+	if o == nil {
+		return nil
+	}
+	if o.OnSAS != nil {
+		o.OnSAS(sas)
+	}
+	return confirmSAS(sas, o.VerifySAS, o.ConfirmSAS)
+}
+
+// confirmSAS returns ErrSASRejected unless verification is off or confirm accepts sas.
+func confirmSAS(sas SAS, verify bool, confirm func(SAS) bool) error {
+	if !verify {
+		return nil
+	}
+	if confirm == nil {
+		return fmt.Errorf("%w (no terminal to confirm it on)", ErrSASRejected)
+	}
+	if !confirm(sas) {
+		logger.Warn("wormhole.confirmSAS rejected by user")
+		return ErrSASRejected
+	}
+	logger.Info("wormhole.confirmSAS confirmed by user")
+	return nil
+}
+
+func (o *TransferOptions) noDirect() bool {
+	return o != nil && o.NoDirect
+}
+
+func (o *TransferOptions) wire(n int64) {
+	if o != nil && o.OnWire != nil {
+		o.OnWire(n)
+	}
+}
+
+func (o *TransferOptions) noClobber() bool {
+	return o != nil && o.NoClobber
+}
+
+func (o *TransferOptions) offer(of Offer) OfferDecision {
+	if o == nil || o.OnOffer == nil {
+		return OfferDecision{Accept: true}
+	}
+	return o.OnOffer(of)
+}
+
+func (o *TransferOptions) output() io.Writer {
+	if o == nil {
+		return nil
+	}
+	return o.Output
+}
+
+// openTransfer opens a session for a transfer, applies the bandwidth limit,
+// reports its path and SAS to opts and, with VerifySAS, waits for the user to
+// confirm the SAS before returning.
+func openTransfer(relayAddr, code string, isSender bool, opts *TransferOptions) (*SecureConn, error) {
+	secure, path, err := openSession(relayAddr, code, code, isSender, opts.noDirect())
+	if err != nil {
+		return nil, err
+	}
+	secure.SetLimiter(opts.limiter())
+	opts.path(path)
+	if err := opts.checkSAS(secure.SAS()); err != nil {
+		secure.Close()
+		return nil, err
+	}
+	return secure, nil
+}
+
+// readAck reads the receiver's AckHeader, turning a rejection into ErrRejected.
+func readAck(r io.Reader) (*AckHeader, error) {
+	ack, err := ReadAckHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if ack.Reject {
+		if ack.Reason != "" {
+			return nil, fmt.Errorf("%w: %s", ErrRejected, ack.Reason)
+		}
+		return nil, ErrRejected
+	}
+	return ack, nil
+}
+
+// decideOffer shows the offer to opts and applies a rename to h. On decline it
+// tells the sender and returns ErrDeclined, or ErrExists when NoClobber refused.
+func decideOffer(w io.Writer, outDir string, h *MetaHeader, opts *TransferOptions) error {
+	toOutput := opts.output() != nil
+	o := Offer{
+		Type:      h.Type,
+		Name:      h.Name,
+		Size:      h.Size,
+		Hash:      h.Hash,
+		Renamable: !toOutput && (h.Type == TypeFile || h.Type == TypeStream),
+	}
+	if !toOutput {
+		o.Exists = offerExists(outDir, h)
+	}
+	d := opts.offer(o)
+	if d.Accept && d.Name != "" && o.Renamable {
+		if path.Base(d.Name) != d.Name || !filepath.IsLocal(d.Name) {
+			return reject(w, "invalid name", fmt.Errorf("%w: %q", ErrUnsafePath, d.Name))
+		}
+		logger.Info("wormhole.Receive offer renamed", logger.Context("params", map[string]any{"from": h.Name, "to": d.Name})...)
+		h.Name = d.Name
+		o.Exists = offerExists(outDir, h)
+	}
+	if !d.Accept {
+		reason := d.Reason
+		if reason == "" {
+			reason = "declined by receiver"
+		}
+		return reject(w, reason, ErrDeclined)
+	}
+	if o.Exists && opts.noClobber() {
+		return reject(w, h.Name+" already exists on the receiver", fmt.Errorf("%w: %s", ErrExists, h.Name))
+	}
+	return nil
+}
+
+// reject sends a rejecting AckHeader and returns err.
+func reject(w io.Writer, reason string, err error) error {
+	logger.Info("wormhole.Receive offer rejected", logger.Context("params", map[string]any{"reason": reason})...)
+	if wErr := WriteAckHeader(w, &AckHeader{Reject: true, Reason: reason}); wErr != nil {
+		return wErr
+	}
+	return err
+}
+
+// offerExists reports whether accepting h would replace something in outDir.
+// For a bundle only its top-level name is known here ("N items" for several
+// paths); receiveBundle checks every entry once the manifest arrives.
+func offerExists(outDir string, h *MetaHeader) bool {
+	name := h.Name
+	switch h.Type {
+	case TypeText:
+		return false
+	case TypeFile:
+		if name == "" {
+			name = "received"
+		}
+	case TypeStream:
+		if name == "" {
+			name = "stream"
+		}
+	}
+	if name == "" || path.Base(name) != name {
+		return false
+	}
+	_, err := os.Lstat(filepath.Join(outDir, name))
+	return err == nil
+}
 
-	secure, err := UpgradeConn(conn, code, true)
+// copyBody copies exactly n bytes from src to dst. onChunk, if non-nil, receives
+// the running count after each chunk. A short source is reported as io.ErrUnexpectedEOF.
+func copyBody(dst io.Writer, src io.Reader, n int64, onChunk func(done int64)) error {
+	buf := GetBuffer()
+	defer PutBuffer(buf)
+	var done int64
+	for done < n {
+		chunk := buf
+		if remain := n - done; remain < int64(len(chunk)) {
+			chunk = chunk[:remain]
+		}
+		rn, err := io.ReadFull(src, chunk)
+		if rn > 0 {
+			if _, wErr := dst.Write(chunk[:rn]); wErr != nil {
+				return wErr
+			}
+			done += int64(rn)
+			if onChunk != nil {
+				onChunk(done)
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// SendFile sends a file through the wormhole. opts may be nil.
+func SendFile(relayAddr, code, filePath string, opts *TransferOptions) error {
+	logger.Info("wormhole.SendFile start", logger.Context("params", map[string]any{
+		"relay_addr": MaskRelayAddr(relayAddr), "code": code, "file_path": filePath, "has_opts": opts != nil,
+	})...)
+	secure, err := openTransfer(relayAddr, code, true, opts)
 	if err != nil {
-		logger.Warn("wormhole.SendFile upgrade failed", zap.Error(err), zap.String("relay_addr", relayAddr), zap.String("code", code))
+		logger.Warn("wormhole.SendFile open session failed", zap.Error(err), zap.String("relay_addr", MaskRelayAddr(relayAddr)), zap.String("code", code))
 		return err
 	}
 	defer secure.Close()
+	if err := secure.Capabilities().requireType(TypeFile); err != nil {
+		return err
+	}
 	logger.Debug("wormhole.SendFile secure connection established")
 
 	info, err := os.Stat(filePath)
@@ -104,68 +383,141 @@ func SendFile(relayAddr, code, filePath string, onProgress func(int64, int64)) e
 		mode = uint32(info.Mode().Perm())
 	}
 
+	hash, err := hashFile(filePath)
+	if err != nil {
+		return err
+	}
+
 	h := &MetaHeader{
 		Type: TypeFile,
 		Name: name,
 		Size: info.Size(),
 		Mode: mode,
+		Hash: hash,
+		Comp: offerComp(opts, secure.Capabilities(), fileLooksCompressed(filePath)),
 	}
 	if err := WriteMetaHeader(secure, h); err != nil {
 		return err
 	}
 	logger.Info("wormhole.SendFile meta header sent", logger.Context("meta", map[string]any{
-		"type": int(h.Type), "name": name, "size": info.Size(), "mode": mode,
+		"type": int(h.Type), "name": name, "size": info.Size(), "mode": mode, "hash": hash, "comp": h.Comp,
 	})...)
 
+	ack, err := readAck(secure)
+	if err != nil {
+		logger.Warn("wormhole.SendFile read ack failed", zap.Error(err))
+		return err
+	}
+	if ack.Offset < 0 || ack.Offset > info.Size() {
+		return fmt.Errorf("wormhole: peer requested invalid resume offset %d (size %d)", ack.Offset, info.Size())
+	}
+
 	f, err := os.Open(filePath)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
+	// Hashing the prefix the receiver already has also positions f at the offset,
+	// so the trailer covers the whole file even when resuming.
+	hasher := sha256.New()
+	if _, err := io.CopyN(hasher, f, ack.Offset); err != nil {
+		return err
+	}
+	if ack.Offset > 0 {
+		logger.Info("wormhole.SendFile resuming", logger.Context("params", map[string]any{
+			"offset": ack.Offset, "total_size": info.Size(),
+		})...)
+	}
 
-	var written int64
-	buf := GetBuffer()
-	defer PutBuffer(buf)
-	for {
-		n, err := f.Read(buf)
-		if n > 0 {
-			if _, wErr := secure.Write(buf[:n]); wErr != nil {
-				return wErr
-			}
-			written += int64(n)
-			if onProgress != nil {
-				onProgress(written, info.Size())
-			}
-		}
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
+	total := info.Size()
+	comp := agreedComp(h.Comp, ack)
+	body := newBodyWriter(secure, comp, opts.wire)
+	opts.progress(ack.Offset, total)
+	if err := copyBody(body, io.TeeReader(f, hasher), total-ack.Offset, func(done int64) {
+		opts.progress(ack.Offset+done, total)
+	}); err != nil {
+		return err
+	}
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	if err := WriteTrailer(body, &Trailer{Hash: sum}); err != nil {
+		return err
+	}
+	if err := body.Close(); err != nil {
+		return err
 	}
 	logger.Info("wormhole.SendFile done", logger.Context("result", map[string]any{
-		"file_path": filePath, "bytes_written": written, "total_size": info.Size(),
+		"file_path": filePath, "bytes_written": total - ack.Offset, "resumed_from": ack.Offset, "total_size": total, "sha256": sum, "comp": comp,
 	})...)
 	return nil
 }
 
-// SendText sends text through the wormhole.
-func SendText(relayAddr, code, text string) error {
-	logger.Info("wormhole.SendText start", logger.Context("params", map[string]any{
-		"relay_addr": relayAddr, "code": code, "text_len": len(text),
+// SendFiles sends files and directories as one TypeDir bundle, preserving relative
+// paths, modes and symlinks. Bundles are not resumable. opts may be nil.
+func SendFiles(relayAddr, code string, paths []string, opts *TransferOptions) error {
+	logger.Info("wormhole.SendFiles start", logger.Context("params", map[string]any{
+		"relay_addr": MaskRelayAddr(relayAddr), "code": code, "paths": paths, "has_opts": opts != nil,
 	})...)
-	conn, err := DialRelay(relayAddr, code, true)
+	sources, total, err := buildBundle(paths)
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
 
-	secure, err := UpgradeConn(conn, code, true)
+	secure, err := openTransfer(relayAddr, code, true, opts)
+	if err != nil {
+		logger.Warn("wormhole.SendFiles open session failed", zap.Error(err), zap.String("relay_addr", MaskRelayAddr(relayAddr)), zap.String("code", code))
+		return err
+	}
+	defer secure.Close()
+	if err := secure.Capabilities().requireType(TypeDir); err != nil {
+		return err
+	}
+
+	h := &MetaHeader{
+		Type: TypeDir,
+		Name: bundleName(paths),
+		Size: total,
+		Comp: offerComp(opts, secure.Capabilities(), bundleLooksCompressed(sources, total)),
+	}
+	if err := WriteMetaHeader(secure, h); err != nil {
+		return err
+	}
+	ack, err := readAck(secure)
+	if err != nil {
+		logger.Warn("wormhole.SendFiles read ack failed", zap.Error(err))
+		return err
+	}
+	comp := agreedComp(h.Comp, ack)
+	logger.Info("wormhole.SendFiles meta header sent", logger.Context("meta", map[string]any{
+		"name": h.Name, "entries": len(sources), "size": total, "comp": comp,
+	})...)
+
+	body := newBodyWriter(secure, comp, opts.wire)
+	if err := sendBundle(body, sources, total, opts); err != nil {
+		logger.Warn("wormhole.SendFiles stream failed", zap.Error(err))
+		return err
+	}
+	if err := body.Close(); err != nil {
+		return err
+	}
+	logger.Info("wormhole.SendFiles done", logger.Context("result", map[string]any{
+		"name": h.Name, "entries": len(sources), "total_size": total,
+	})...)
+	return nil
+}
+
+// SendText sends text through the wormhole. opts may be nil.
+func SendText(relayAddr, code, text string, opts *TransferOptions) error {
+	logger.Info("wormhole.SendText start", logger.Context("params", map[string]any{
+		"relay_addr": MaskRelayAddr(relayAddr), "code": code, "text_len": len(text),
+	})...)
+	secure, err := openTransfer(relayAddr, code, true, opts)
 	if err != nil {
 		return err
 	}
 	defer secure.Close()
+	if err := secure.Capabilities().requireType(TypeText); err != nil {
+		return err
+	}
 
 	h := &MetaHeader{
 		Type: TypeText,
@@ -174,6 +526,10 @@ func SendText(relayAddr, code, text string) error {
 	if err := WriteMetaHeader(secure, h); err != nil {
 		return err
 	}
+	if _, err := readAck(secure); err != nil {
+		logger.Warn("wormhole.SendText read ack failed", zap.Error(err))
+		return err
+	}
 	logger.Debug("wormhole.SendText meta header sent, writing body")
 	_, err = secure.Write([]byte(text))
 	if err != nil {
@@ -184,33 +540,114 @@ func SendText(relayAddr, code, text string) error {
 	return nil
 }
 
+// SendStream sends r as a TypeStream payload until it returns io.EOF, for data
+// of unknown length such as stdin. Progress reports a total of -1. Streams are
+// not resumable. name is offered to receivers that save to disk. opts may be nil.
+func SendStream(relayAddr, code string, r io.Reader, name string, opts *TransferOptions) error {
+	logger.Info("wormhole.SendStream start", logger.Context("params", map[string]any{
+		"relay_addr": MaskRelayAddr(relayAddr), "code": code, "name": name, "has_opts": opts != nil,
+	})...)
+	secure, err := openTransfer(relayAddr, code, true, opts)
+	if err != nil {
+		logger.Warn("wormhole.SendStream open session failed", zap.Error(err), zap.String("relay_addr", MaskRelayAddr(relayAddr)), zap.String("code", code))
+		return err
+	}
+	defer secure.Close()
+	if err := secure.Capabilities().requireType(TypeStream); err != nil {
+		return err
+	}
+
+	// Peek at the first bytes so already-compressed input (e.g. tar | gzip) is sent as is.
+	br := bufio.NewReaderSize(r, sniffLen)
+	head, _ := br.Peek(sniffLen)
+	r = br
+	h := &MetaHeader{
+		Type: TypeStream,
+		Name: name,
+		Size: -1,
+		Comp: offerComp(opts, secure.Capabilities(), looksCompressed(name, head)),
+	}
+	if err := WriteMetaHeader(secure, h); err != nil {
+		return err
+	}
+	ack, err := readAck(secure)
+	if err != nil {
+		logger.Warn("wormhole.SendStream read ack failed", zap.Error(err))
+		return err
+	}
+
+	hasher := sha256.New()
+	body := newBodyWriter(secure, agreedComp(h.Comp, ack), opts.wire)
+	cw := &chunkWriter{w: body}
+	buf := GetBuffer()
+	defer PutBuffer(buf)
+	var done int64
+	opts.progress(0, -1)
+	for {
+		n, rErr := r.Read(buf)
+		if n > 0 {
+			hasher.Write(buf[:n])
+			if _, err := cw.Write(buf[:n]); err != nil {
+				return err
+			}
+			done += int64(n)
+			opts.progress(done, -1)
+		}
+		if rErr == io.EOF {
+			break
+		}
+		if rErr != nil {
+			return rErr
+		}
+	}
+	if err := cw.Close(); err != nil {
+		return err
+	}
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	if err := WriteTrailer(body, &Trailer{Hash: sum}); err != nil {
+		return err
+	}
+	if err := body.Close(); err != nil {
+		return err
+	}
+	logger.Info("wormhole.SendStream done", logger.Context("result", map[string]any{
+		"name": name, "bytes_written": done, "sha256": sum, "comp": h.Comp,
+	})...)
+	return nil
+}
+
 // ReceiveResult holds what was received (one of file or text per connection).
 type ReceiveResult struct {
-	FilePath string // set when TypeFile (saved path)
-	Text     string // set when TypeText
+	FilePath    string   // set when TypeFile (saved path)
+	Text        string   // set when TypeText
+	ResumedFrom int64    // bytes already on disk from an earlier interrupted transfer
+	Hash        string   // verified hex SHA-256 (TypeFile)
+	Files       []string // set when TypeDir (saved paths of regular files)
+	Skipped     []string // TypeDir entries refused as unsafe (e.g. escaping symlinks)
+	Written     int64    // bytes written to TransferOptions.Output (file or stream body)
+	PartPath    string   // TypeFile receive that failed midway: the part file a re-run resumes
 }
 
-// Receive receives data from the wormhole (file or text).
+// Receive receives data from the wormhole (file, directory bundle or text). opts may be nil.
 // If textResult is non-nil and payload is text, the received text is stored there.
-// If result is non-nil, FilePath or Text is set so caller can show success info.
-func Receive(relayAddr, code, outDir string, onProgress func(int64, int64), textResult *string, result *ReceiveResult) error {
+// If result is non-nil, FilePath, Files or Text is set so caller can show success info.
+func Receive(relayAddr, code, outDir string, opts *TransferOptions, textResult *string, result *ReceiveResult) error {
 	logger.Info("wormhole.Receive start", logger.Context("params", map[string]any{
-		"relay_addr": relayAddr, "code": code, "out_dir": outDir, "has_progress_cb": onProgress != nil,
+		"relay_addr": MaskRelayAddr(relayAddr), "code": code, "out_dir": outDir, "has_opts": opts != nil,
 	})...)
-	conn, err := DialRelay(relayAddr, code, false)
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-
-	secure, err := UpgradeConn(conn, code, false)
+	secure, err := openTransfer(relayAddr, code, false, opts)
 	if err != nil {
 		return err
 	}
 	defer secure.Close()
 	logger.Debug("wormhole.Receive secure connection established")
+	return receivePayload(secure, outDir, opts, textResult, result)
+}
 
-	h, err := ReadMetaHeader(secure)
+// receivePayload reads a MetaHeader and its body from rw, answering the sender
+// on rw, and saves or returns the payload as Receive documents.
+func receivePayload(rw io.ReadWriter, outDir string, opts *TransferOptions, textResult *string, result *ReceiveResult) error {
+	h, err := ReadMetaHeader(rw)
 	if err != nil {
 		logger.Warn("wormhole.Receive read meta failed", zap.Error(err))
 		return err
@@ -219,55 +656,154 @@ func Receive(relayAddr, code, outDir string, onProgress func(int64, int64), text
 		"type": int(h.Type), "name": h.Name, "size": h.Size, "mode": h.Mode,
 	})...)
 
+	if err := decideOffer(rw, outDir, h, opts); err != nil {
+		return err
+	}
+	// Everything after the ack is read through body, which undoes compression.
+	comp := ""
+	if h.Type != TypeText {
+		comp = acceptComp(h.Comp)
+	}
+	body := newBodyReader(rw, comp, opts.wire)
+	if out := opts.output(); out != nil {
+		return receiveToWriter(rw, body, comp, h, out, opts, textResult, result)
+	}
+
 	switch h.Type {
 	case TypeFile:
-		outPath := filepath.Join(outDir, h.Name)
-		if h.Name == "" {
-			outPath = filepath.Join(outDir, "received")
+		outPath := filepath.Join(outDir, "received")
+		if h.Name != "" {
+			if path.Base(h.Name) != h.Name {
+				return fmt.Errorf("%w: %q", ErrUnsafePath, h.Name)
+			}
+			if outPath, err = safeJoin(outDir, h.Name); err != nil {
+				return err
+			}
+		}
+		// Incoming bytes go to a part file keyed by name/size/hash; it is only
+		// renamed into place when complete, so a dropped connection can resume.
+		part := partPath(outDir, h)
+		offset := int64(0)
+		if h.Hash != "" {
+			offset = resumeOffset(part, h.Size)
 		}
-		f, err := os.OpenFile(outPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(h.Mode))
+		f, err := os.OpenFile(part, os.O_CREATE|os.O_RDWR, 0600)
 		if err != nil {
 			return err
 		}
 		defer f.Close()
-
-		var read int64
-		buf := GetBuffer()
-		defer PutBuffer(buf)
-		for read < h.Size {
-			toRead := int64(len(buf))
-			if remain := h.Size - read; remain < toRead {
-				toRead = remain
-			}
-			n, err := io.ReadFull(secure, buf[:toRead])
-			if n > 0 {
-				if _, wErr := f.Write(buf[:n]); wErr != nil {
-					return wErr
-				}
-				read += int64(n)
-				if onProgress != nil {
-					onProgress(read, h.Size)
+		if result != nil && h.Hash != "" {
+			// Only offers with a hash resume, and only once bytes arrived.
+			defer func() {
+				if result.FilePath == "" && resumeOffset(part, h.Size) > 0 {
+					result.PartPath = part
 				}
-			}
-			if err != nil {
-				if err == io.EOF && read == h.Size {
-					break
-				}
-				return err
-			}
+			}()
+		}
+		if err := f.Truncate(offset); err != nil {
+			return err
+		}
+		// Hash the bytes kept from an earlier attempt; this leaves f at offset.
+		hasher := sha256.New()
+		if _, err := io.CopyN(hasher, f, offset); err != nil {
+			return err
+		}
+		if err := WriteAckHeader(rw, &AckHeader{Offset: offset, Comp: comp}); err != nil {
+			return err
+		}
+		if offset > 0 {
+			logger.Info("wormhole.Receive resuming", logger.Context("params", map[string]any{
+				"part": part, "offset": offset, "total_size": h.Size,
+			})...)
+		}
+
+		opts.progress(offset, h.Size)
+		if err := copyBody(io.MultiWriter(f, hasher), body, h.Size-offset, func(done int64) {
+			opts.progress(offset+done, h.Size)
+		}); err != nil {
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		sum, err := verifyTrailer(body, hasher)
+		if err == nil {
+			err = body.finish()
+		}
+		if errors.Is(err, ErrHashMismatch) {
+			os.Remove(part)
+			logger.Warn("wormhole.Receive hash mismatch, part file removed", logger.Context("params", map[string]any{
+				"part": part, "error": err.Error(),
+			})...)
+		}
+		if err != nil {
+			return err
+		}
+		perm := os.FileMode(h.Mode)
+		if perm == 0 {
+			perm = 0644
+		}
+		if err := os.Chmod(part, perm); err != nil {
+			return err
+		}
+		if err := os.Rename(part, outPath); err != nil {
+			return err
 		}
 		logger.Info("wormhole.Receive file done", logger.Context("result", map[string]any{
-			"out_path": outPath, "bytes_read": read, "total_size": h.Size,
+			"out_path": outPath, "bytes_read": h.Size - offset, "resumed_from": offset, "total_size": h.Size, "sha256": sum,
 		})...)
 		if result != nil {
 			result.FilePath = outPath
+			result.ResumedFrom = offset
+			result.Hash = sum
+		}
+		return nil
+
+	case TypeDir:
+		if err := WriteAckHeader(rw, &AckHeader{Comp: comp}); err != nil {
+			return err
+		}
+		files, skipped, err := receiveBundle(body, outDir, h, opts)
+		if err == nil {
+			err = body.finish()
+		}
+		if err != nil {
+			logger.Warn("wormhole.Receive bundle failed", zap.Error(err))
+			return err
+		}
+		logger.Info("wormhole.Receive bundle done", logger.Context("result", map[string]any{
+			"name": h.Name, "files": len(files), "skipped": skipped, "total_size": h.Size,
+		})...)
+		if result != nil {
+			result.Files = files
+			result.Skipped = skipped
+		}
+		return nil
+
+	case TypeStream:
+		if err := WriteAckHeader(rw, &AckHeader{Comp: comp}); err != nil {
+			return err
+		}
+		outPath, sum, n, err := receiveStreamFile(body, outDir, h, opts)
+		if err != nil {
+			logger.Warn("wormhole.Receive stream failed", zap.Error(err))
+			return err
+		}
+		logger.Info("wormhole.Receive stream done", logger.Context("result", map[string]any{
+			"out_path": outPath, "bytes_read": n, "sha256": sum,
+		})...)
+		if result != nil {
+			result.FilePath = outPath
+			result.Hash = sum
 		}
 		return nil
 
 	case TypeText:
-		logger.Debug("wormhole.Receive reading text body", logger.Context("params", map[string]any{"size": h.Size})...)
-		data := make([]byte, h.Size)
-		if _, err := io.ReadFull(secure, data); err != nil {
+		if err := WriteAckHeader(rw, &AckHeader{}); err != nil {
+			return err
+		}
+		data, err := readText(rw, h)
+		if err != nil {
 			return err
 		}
 		logger.Info("wormhole.Receive text done", logger.Context("result", map[string]any{"bytes": len(data)})...)
@@ -293,16 +829,141 @@ func Receive(relayAddr, code, outDir string, onProgress func(int64, int64), text
 	}
 }
 
-// GenerateCode creates a random 4-character alphanumeric code.
-func GenerateCode() string {
-	const chars = "abcdefghijklmnopqrstuvwxyz0123456789"
-	b := make([]byte, 4)
-	for i := range b {
-		b[i] = chars[i%len(chars)]
+// readText reads a TypeText body of h.Size bytes.
+func readText(r io.Reader, h *MetaHeader) ([]byte, error) {
+	logger.Debug("wormhole.Receive reading text body", logger.Context("params", map[string]any{"size": h.Size})...)
+	if h.Size < 0 {
+		return nil, fmt.Errorf("wormhole: invalid text size %d", h.Size)
 	}
-	rand.Read(b)
-	for i := range b {
-		b[i] = chars[int(b[i])%len(chars)]
+	data := make([]byte, h.Size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
 	}
-	return string(b)
+	return data, nil
+}
+
+// copyStream copies a TypeStream body from body to dst and verifies the
+// trailer. It returns the verified hash and the byte count.
+func copyStream(dst io.Writer, body *bodyReader, opts *TransferOptions) (string, int64, error) {
+	hasher := sha256.New()
+	buf := GetBuffer()
+	defer PutBuffer(buf)
+	cr := &chunkReader{r: body}
+	var done int64
+	opts.progress(0, -1)
+	for {
+		n, rErr := cr.Read(buf)
+		if n > 0 {
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return "", done, err
+			}
+			hasher.Write(buf[:n])
+			done += int64(n)
+			opts.progress(done, -1)
+		}
+		if rErr == io.EOF {
+			break
+		}
+		if rErr != nil {
+			return "", done, rErr
+		}
+	}
+	sum, err := verifyTrailer(body, hasher)
+	if err == nil {
+		err = body.finish()
+	}
+	return sum, done, err
+}
+
+// receiveStreamFile saves a TypeStream body under outDir. Bytes go to a temporary
+// file that is renamed into place only after the trailer verifies.
+func receiveStreamFile(body *bodyReader, outDir string, h *MetaHeader, opts *TransferOptions) (string, string, int64, error) {
+	name := h.Name
+	if name == "" {
+		name = "stream"
+	}
+	if path.Base(name) != name {
+		return "", "", 0, fmt.Errorf("%w: %q", ErrUnsafePath, name)
+	}
+	outPath, err := safeJoin(outDir, name)
+	if err != nil {
+		return "", "", 0, err
+	}
+	f, err := os.CreateTemp(outDir, "."+name+".*"+partSuffix)
+	if err != nil {
+		return "", "", 0, err
+	}
+	tmp := f.Name()
+	sum, n, err := copyStream(f, body, opts)
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, outPath)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", "", n, err
+	}
+	return outPath, sum, n, nil
+}
+
+// receiveToWriter handles Receive when TransferOptions.Output is set: file and
+// stream bodies and text are written to out as they arrive, never resumed.
+// Directory bundles cannot be flattened into one stream and are refused.
+func receiveToWriter(w io.Writer, body *bodyReader, comp string, h *MetaHeader, out io.Writer, opts *TransferOptions, textResult *string, result *ReceiveResult) error {
+	if h.Type == TypeDir {
+		return fmt.Errorf("wormhole: peer sent a directory bundle (%q), which cannot be written to a single output; receive it into a directory instead", h.Name)
+	}
+	if h.Type != TypeFile && h.Type != TypeStream && h.Type != TypeText {
+		return fmt.Errorf("unknown payload type: %d", h.Type)
+	}
+	if err := WriteAckHeader(w, &AckHeader{Comp: comp}); err != nil {
+		return err
+	}
+
+	var sum string
+	var n int64
+	var err error
+	switch h.Type {
+	case TypeFile:
+		hasher := sha256.New()
+		opts.progress(0, h.Size)
+		err = copyBody(io.MultiWriter(out, hasher), body, h.Size, func(done int64) {
+			opts.progress(done, h.Size)
+		})
+		if err == nil {
+			sum, err = verifyTrailer(body, hasher)
+		}
+		if err == nil {
+			err = body.finish()
+		}
+		n = h.Size
+	case TypeStream:
+		sum, n, err = copyStream(out, body, opts)
+	case TypeText:
+		var data []byte
+		if data, err = readText(body, h); err == nil {
+			_, err = out.Write(data)
+			n = int64(len(data))
+			if textResult != nil {
+				*textResult = string(data)
+			}
+		}
+	}
+	if err != nil {
+		logger.Warn("wormhole.Receive output failed", zap.Error(err), zap.Int64("bytes", n))
+		return err
+	}
+	logger.Info("wormhole.Receive output done", logger.Context("result", map[string]any{
+		"type": int(h.Type), "name": h.Name, "bytes": n, "sha256": sum,
+	})...)
+	if result != nil {
+		result.Written = n
+		result.Hash = sum
+	}
+	return nil
 }
@@ -0,0 +1,700 @@
+package wormhole
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startRelay runs a RelayServer on a loopback port and returns its address.
+func startRelay(t *testing.T) string {
+	t.Helper()
+	return serveRelay(t, NewRelayServer(5*time.Second, nil))
+}
+
+// serveRelay accepts loopback connections into srv and returns its address.
+func serveRelay(t *testing.T, srv *RelayServer) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	return acceptRelay(t, srv, ln)
+}
+
+// acceptRelay serves srv on ln until the test ends and returns its tcp:// address.
+func acceptRelay(t *testing.T, srv *RelayServer, ln net.Listener) string {
+	t.Helper()
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.HandleConn(conn)
+		}
+	}()
+	return "tcp://" + ln.Addr().String()
+}
+
+// transfer runs SendFile and Receive against relay and returns the receive result.
+func transfer(t *testing.T, relay, code, src, outDir string) *ReceiveResult {
+	t.Helper()
+	var result ReceiveResult
+	errCh := make(chan error, 1)
+	go func() { errCh <- SendFile(relay, code, src, nil) }()
+	if err := Receive(relay, code, outDir, nil, nil, &result); err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("SendFile() error = %v", err)
+	}
+	return &result
+}
+
+func writeRandomFile(t *testing.T, dir, name string, size int) []byte {
+	t.Helper()
+	data := make([]byte, size)
+	rand.Read(data)
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestSendReceiveFile(t *testing.T) {
+	relay := startRelay(t)
+	srcDir, outDir := t.TempDir(), t.TempDir()
+	data := writeRandomFile(t, srcDir, "data.bin", 200*1024)
+
+	result := transfer(t, relay, "t001", filepath.Join(srcDir, "data.bin"), outDir)
+
+	got, err := os.ReadFile(result.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("received content differs from sent content")
+	}
+	if result.ResumedFrom != 0 {
+		t.Errorf("ResumedFrom = %d, want 0", result.ResumedFrom)
+	}
+	if want, _ := hashFile(filepath.Join(srcDir, "data.bin")); result.Hash != want {
+		t.Errorf("Hash = %s, want %s", result.Hash, want)
+	}
+}
+
+func TestReceiveRejectsHashMismatch(t *testing.T) {
+	relay := startRelay(t)
+	outDir := t.TempDir()
+	body := []byte("payload the sender claims differently")
+	h := &MetaHeader{Type: TypeFile, Name: "x.txt", Size: int64(len(body)), Mode: 0644, Hash: "00"}
+
+	go func() {
+		secure, _, err := openSession(relay, "t005", "t005", true, true)
+		if err != nil {
+			return
+		}
+		defer secure.Close()
+		WriteMetaHeader(secure, h)
+		ReadAckHeader(secure)
+		secure.Write(body)
+		WriteTrailer(secure, &Trailer{Hash: "deadbeef"})
+	}()
+
+	var result ReceiveResult
+	err := Receive(relay, "t005", outDir, nil, nil, &result)
+	if !errors.Is(err, ErrHashMismatch) {
+		t.Fatalf("Receive() error = %v, want ErrHashMismatch", err)
+	}
+	if result.PartPath != "" {
+		t.Errorf("PartPath = %q after the part file was removed", result.PartPath)
+	}
+	entries, _ := os.ReadDir(outDir)
+	if len(entries) != 0 {
+		t.Errorf("outDir should be empty after a failed verification, got %d entries", len(entries))
+	}
+}
+
+func TestReceiveResumesPartialFile(t *testing.T) {
+	relay := startRelay(t)
+	srcDir, outDir := t.TempDir(), t.TempDir()
+	src := filepath.Join(srcDir, "data.bin")
+	data := writeRandomFile(t, srcDir, "data.bin", 300*1024)
+
+	hash, err := hashFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &MetaHeader{Type: TypeFile, Name: "data.bin", Size: int64(len(data)), Hash: hash}
+	const have = 123 * 1024
+	if err := os.WriteFile(partPath(outDir, h), data[:have], 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	result := transfer(t, relay, "t002", src, outDir)
+
+	if result.ResumedFrom != have {
+		t.Errorf("ResumedFrom = %d, want %d", result.ResumedFrom, have)
+	}
+	got, err := os.ReadFile(result.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("resumed content differs from sent content")
+	}
+	if _, err := os.Stat(partPath(outDir, h)); !os.IsNotExist(err) {
+		t.Error("part file should be renamed away after completion")
+	}
+}
+
+func TestReceiveReportsPartFile(t *testing.T) {
+	relay := startRelay(t)
+	outDir := t.TempDir()
+	body := make([]byte, 64*1024)
+	h := &MetaHeader{Type: TypeFile, Name: "x.bin", Size: int64(len(body)), Hash: "ab12"}
+
+	// The sender drops halfway through the body.
+	go func() {
+		secure, _, err := openSession(relay, "t036", "t036", true, true)
+		if err != nil {
+			return
+		}
+		defer secure.Close()
+		WriteMetaHeader(secure, h)
+		ReadAckHeader(secure)
+		secure.Write(body[:len(body)/2])
+	}()
+
+	var result ReceiveResult
+	if err := Receive(relay, "t036", outDir, nil, nil, &result); err == nil {
+		t.Fatal("Receive() succeeded on a truncated body")
+	}
+	if result.PartPath != partPath(outDir, h) {
+		t.Errorf("PartPath = %q, want %q", result.PartPath, partPath(outDir, h))
+	}
+
+	// A text transfer leaves nothing to resume.
+	go func() {
+		secure, _, err := openSession(relay, "t037", "t037", true, true)
+		if err != nil {
+			return
+		}
+		defer secure.Close()
+		WriteMetaHeader(secure, &MetaHeader{Type: TypeText, Size: 100})
+		ReadAckHeader(secure)
+		secure.Write([]byte("cut"))
+	}()
+	result = ReceiveResult{}
+	var text string
+	if err := Receive(relay, "t037", outDir, nil, &text, &result); err == nil || result.PartPath != "" {
+		t.Errorf("Receive() = %v, PartPath %q, want an error and no part file", err, result.PartPath)
+	}
+}
+
+func TestSendReceiveText(t *testing.T) {
+	relay := startRelay(t)
+	var text string
+	errCh := make(chan error, 1)
+	go func() { errCh <- SendText(relay, "t003", "hello wormhole", nil) }()
+	if err := Receive(relay, "t003", t.TempDir(), nil, &text, nil); err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("SendText() error = %v", err)
+	}
+	if text != "hello wormhole" {
+		t.Errorf("text = %q", text)
+	}
+}
+
+func TestReceiverDeclinesOffer(t *testing.T) {
+	relay := startRelay(t)
+	srcDir, outDir := t.TempDir(), t.TempDir()
+	writeRandomFile(t, srcDir, "secret.bin", 4096)
+
+	var seen Offer
+	opts := &TransferOptions{OnOffer: func(o Offer) OfferDecision {
+		seen = o
+		return OfferDecision{Reason: "not expecting files"}
+	}}
+	errCh := make(chan error, 1)
+	go func() { errCh <- SendFile(relay, "t014", filepath.Join(srcDir, "secret.bin"), nil) }()
+	if err := Receive(relay, "t014", outDir, opts, nil, nil); !errors.Is(err, ErrDeclined) {
+		t.Fatalf("Receive() error = %v, want ErrDeclined", err)
+	}
+	err := <-errCh
+	if !errors.Is(err, ErrRejected) || !strings.Contains(err.Error(), "not expecting files") {
+		t.Fatalf("SendFile() error = %v, want ErrRejected with reason", err)
+	}
+	if seen.Type != TypeFile || seen.Name != "secret.bin" || seen.Size != 4096 || seen.Hash == "" || !seen.Renamable {
+		t.Errorf("offer = %+v", seen)
+	}
+	if entries, _ := os.ReadDir(outDir); len(entries) != 0 {
+		t.Errorf("declined offer left %d entries in outDir", len(entries))
+	}
+}
+
+func TestReceiverRenameAndNoClobber(t *testing.T) {
+	relay := startRelay(t)
+	srcDir, outDir := t.TempDir(), t.TempDir()
+	data := writeRandomFile(t, srcDir, "report.pdf", 2048)
+	src := filepath.Join(srcDir, "report.pdf")
+	if err := os.WriteFile(filepath.Join(outDir, "report.pdf"), []byte("mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- SendFile(relay, "t015", src, nil) }()
+	if err := Receive(relay, "t015", outDir, &TransferOptions{NoClobber: true}, nil, nil); !errors.Is(err, ErrExists) {
+		t.Fatalf("Receive() error = %v, want ErrExists", err)
+	}
+	if err := <-errCh; !errors.Is(err, ErrRejected) {
+		t.Fatalf("SendFile() error = %v, want ErrRejected", err)
+	}
+
+	opts := &TransferOptions{NoClobber: true, OnOffer: func(o Offer) OfferDecision {
+		if !o.Exists {
+			t.Error("offer should report the existing file")
+		}
+		return OfferDecision{Accept: true, Name: "report-2.pdf"}
+	}}
+	go func() { errCh <- SendFile(relay, "t016", src, nil) }()
+	var result ReceiveResult
+	if err := Receive(relay, "t016", outDir, opts, nil, &result); err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("SendFile() error = %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(outDir, "report-2.pdf"))
+	if err != nil || !bytes.Equal(got, data) || result.FilePath != filepath.Join(outDir, "report-2.pdf") {
+		t.Fatalf("renamed file: err %v, path %q", err, result.FilePath)
+	}
+	if mine, _ := os.ReadFile(filepath.Join(outDir, "report.pdf")); string(mine) != "mine" {
+		t.Error("existing file was overwritten")
+	}
+}
+
+func TestSendReceiveStream(t *testing.T) {
+	relay := startRelay(t)
+	data := make([]byte, 300*1024+7)
+	rand.Read(data)
+
+	// To an output writer, as receive --stdout does.
+	var out bytes.Buffer
+	var result ReceiveResult
+	var totals []int64
+	errCh := make(chan error, 1)
+	go func() { errCh <- SendStream(relay, "t012", bytes.NewReader(data), "dump.tar", nil) }()
+	opts := &TransferOptions{Output: &out, OnProgress: func(_, total int64) { totals = append(totals, total) }}
+	if err := Receive(relay, "t012", t.TempDir(), opts, nil, &result); err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("SendStream() error = %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatalf("output differs: got %d bytes, want %d", out.Len(), len(data))
+	}
+	if result.Written != int64(len(data)) || result.Hash == "" {
+		t.Errorf("result = %+v", result)
+	}
+	if len(totals) == 0 || totals[len(totals)-1] != -1 {
+		t.Errorf("stream progress totals = %v, want -1", totals)
+	}
+
+	// To disk under the offered name.
+	outDir := t.TempDir()
+	go func() { errCh <- SendStream(relay, "t013", bytes.NewReader(data), "dump.tar", nil) }()
+	result = ReceiveResult{}
+	if err := Receive(relay, "t013", outDir, nil, nil, &result); err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("SendStream() error = %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(outDir, "dump.tar"))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("saved stream differs (err %v)", err)
+	}
+	if result.FilePath != filepath.Join(outDir, "dump.tar") {
+		t.Errorf("FilePath = %q", result.FilePath)
+	}
+}
+
+func TestChunkReaderDetectsTruncation(t *testing.T) {
+	var buf bytes.Buffer
+	cw := &chunkWriter{w: &buf}
+	cw.Write([]byte("hello"))
+	cw.Write([]byte("world"))
+
+	// Without the end-of-stream marker the body is incomplete.
+	if _, err := io.ReadAll(&chunkReader{r: bytes.NewReader(buf.Bytes())}); err != io.ErrUnexpectedEOF {
+		t.Fatalf("unterminated stream: err = %v, want io.ErrUnexpectedEOF", err)
+	}
+	cw.Close()
+	got, err := io.ReadAll(&chunkReader{r: &buf})
+	if err != nil || string(got) != "helloworld" {
+		t.Fatalf("ReadAll = %q, %v", got, err)
+	}
+}
+
+func TestSendReceiveBundle(t *testing.T) {
+	relay := startRelay(t)
+	srcDir, outDir := t.TempDir(), t.TempDir()
+	tree := filepath.Join(srcDir, "build")
+	if err := os.MkdirAll(filepath.Join(tree, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	a := writeRandomFile(t, tree, "a.bin", 70*1024)
+	b := writeRandomFile(t, filepath.Join(tree, "sub"), "b.bin", 10)
+	if err := os.Symlink("sub/b.bin", filepath.Join(tree, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../../etc/passwd", filepath.Join(tree, "evil")); err != nil {
+		t.Fatal(err)
+	}
+	extra := writeRandomFile(t, srcDir, "notes.txt", 5)
+
+	var result ReceiveResult
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- SendFiles(relay, "t004", []string{tree, filepath.Join(srcDir, "notes.txt")}, nil)
+	}()
+	if err := Receive(relay, "t004", outDir, nil, nil, &result); err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("SendFiles() error = %v", err)
+	}
+
+	for rel, want := range map[string][]byte{"build/a.bin": a, "build/sub/b.bin": b, "build/link": b, "notes.txt": extra} {
+		got, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(rel)))
+		if err != nil {
+			t.Errorf("%s: %v", rel, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: content mismatch", rel)
+		}
+	}
+	if len(result.Files) != 3 {
+		t.Errorf("Files = %v, want 3 entries", result.Files)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0] != "build/evil" {
+		t.Errorf("Skipped = %v, want [build/evil]", result.Skipped)
+	}
+	if _, err := os.Lstat(filepath.Join(outDir, "build", "evil")); !os.IsNotExist(err) {
+		t.Error("escaping symlink should not be created")
+	}
+}
+
+func TestReceiveBundleNoClobber(t *testing.T) {
+	relay := startRelay(t)
+	srcDir, outDir := t.TempDir(), t.TempDir()
+	writeRandomFile(t, srcDir, "a.txt", 10)
+	writeRandomFile(t, srcDir, "b.txt", 10)
+	if err := os.Symlink("a.txt", filepath.Join(srcDir, "c")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"b.txt", "c"} {
+		if err := os.WriteFile(filepath.Join(outDir, name), []byte("mine"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	paths := []string{filepath.Join(srcDir, "a.txt"), filepath.Join(srcDir, "b.txt")}
+
+	for _, tc := range []struct {
+		code  string
+		paths []string
+	}{
+		{"t017", paths},
+		{"t018", []string{paths[0], filepath.Join(srcDir, "c")}},
+	} {
+		errCh := make(chan error, 1)
+		go func() { errCh <- SendFiles(relay, tc.code, tc.paths, nil) }()
+		if err := Receive(relay, tc.code, outDir, &TransferOptions{NoClobber: true}, nil, nil); !errors.Is(err, ErrExists) {
+			t.Errorf("%s: Receive() error = %v, want ErrExists", tc.code, err)
+		}
+		<-errCh
+	}
+	for _, name := range []string{"b.txt", "c"} {
+		if mine, _ := os.ReadFile(filepath.Join(outDir, name)); string(mine) != "mine" {
+			t.Errorf("existing %s was overwritten", name)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(outDir, "a.txt")); !os.IsNotExist(err) {
+		t.Error("nothing should be written when the bundle is refused")
+	}
+}
+
+func TestReceiveBundleSymlinkChain(t *testing.T) {
+	// Each link passes a lexical check, but top/t resolves through top/s to
+	// outside outDir.
+	var buf bytes.Buffer
+	if err := WriteManifest(&buf, &Manifest{Entries: []ManifestEntry{
+		{Path: "top", Kind: EntryDir},
+		{Path: "top/s", Kind: EntrySymlink, Link: ".."},
+		{Path: "top/t", Kind: EntrySymlink, Link: "s/../../etc"},
+		{Path: "top/u", Kind: EntrySymlink, Link: "../top/./v"},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	outDir := t.TempDir()
+	_, skipped, err := receiveBundle(&buf, outDir, &MetaHeader{Type: TypeDir}, nil)
+	if err != nil {
+		t.Fatalf("receiveBundle() error = %v", err)
+	}
+	if len(skipped) != 1 || skipped[0] != "top/t" {
+		t.Errorf("skipped = %v, want [top/t]", skipped)
+	}
+	if _, err := os.Lstat(filepath.Join(outDir, "top", "t")); !os.IsNotExist(err) {
+		t.Error("chained symlink should not be created")
+	}
+	for _, name := range []string{"s", "u"} {
+		if _, err := os.Lstat(filepath.Join(outDir, "top", name)); err != nil {
+			t.Errorf("top/%s: %v", name, err)
+		}
+	}
+}
+
+func TestReceiveBundleDirSymlink(t *testing.T) {
+	// outDir/foo is a symlink to a directory outside; a dir entry "foo" with a
+	// mode must not chmod through it.
+	outside, outDir := t.TempDir(), t.TempDir()
+	if err := os.Chmod(outside, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(outDir, "foo")); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteManifest(&buf, &Manifest{Entries: []ManifestEntry{
+		{Path: "foo", Kind: EntryDir, Mode: 0777},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := receiveBundle(&buf, outDir, &MetaHeader{Type: TypeDir}, nil); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("receiveBundle() error = %v, want ErrUnsafePath", err)
+	}
+	if info, err := os.Stat(outside); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("outside dir mode = %v (%v), want 0700", info.Mode().Perm(), err)
+	}
+}
+
+func TestSafeJoin(t *testing.T) {
+	root := t.TempDir()
+	for _, rel := range []string{"a", "a/b/c.txt", "dir/./x"} {
+		if _, err := safeJoin(root, rel); err != nil {
+			t.Errorf("safeJoin(%q) error = %v", rel, err)
+		}
+	}
+	for _, rel := range []string{"", "/etc/passwd", "../x", "a/../../x", "a\\..\\x", ".."} {
+		if _, err := safeJoin(root, rel); err == nil {
+			t.Errorf("safeJoin(%q) should fail", rel)
+		}
+	}
+}
+
+func TestRelayMetrics(t *testing.T) {
+	srv := NewRelayServer(5*time.Second, nil)
+	relay := serveRelay(t, srv)
+	srcDir := t.TempDir()
+	writeRandomFile(t, srcDir, "data.bin", 40*1024)
+	opts := &TransferOptions{NoDirect: true}
+	errCh := make(chan error, 1)
+	go func() { errCh <- SendFile(relay, "t006", filepath.Join(srcDir, "data.bin"), opts) }()
+	if err := Receive(relay, "t006", t.TempDir(), opts, nil, nil); err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("SendFile() error = %v", err)
+	}
+
+	st := srv.Status()
+	if st.PairsMatched != 1 || st.ConnsAccepted != 2 {
+		t.Errorf("PairsMatched = %d, ConnsAccepted = %d, want 1, 2", st.PairsMatched, st.ConnsAccepted)
+	}
+	if st.BytesToReceiver < 40*1024 || st.BytesToSender == 0 {
+		t.Errorf("bytes = %d/%d, want >= 40KiB to receiver and some back", st.BytesToReceiver, st.BytesToSender)
+	}
+
+	admin := httptest.NewServer(srv.AdminHandler())
+	defer admin.Close()
+	resp, err := admin.Client().Get(admin.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	for _, want := range []string{"wormhole_relay_pairs_matched_total 1", `wormhole_relay_bytes_total{direction="sender_to_receiver"}`} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("/metrics missing %q", want)
+		}
+	}
+}
+
+func TestRelayHeaderTimeout(t *testing.T) {
+	srv := NewRelayServer(5*time.Second, nil)
+	srv.headerTimeout = 200 * time.Millisecond
+	conn, err := net.Dial("tcp", strings.TrimPrefix(serveRelay(t, srv), "tcp://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// A client that never sends its header is dropped.
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Read() error = %v, want EOF from the relay", err)
+	}
+}
+
+func TestRelayTokenAndRoomLimit(t *testing.T) {
+	srv := NewRelayServer(5*time.Second, &RelayOptions{Tokens: []string{"s3cret"}, MaxRoomsPerIP: 1})
+	relay := serveRelay(t, srv)
+	bare := strings.TrimPrefix(relay, "tcp://")
+
+	if _, err := DialRelay(relay, "1-a-b", true); !errors.Is(err, ErrRelayAuth) {
+		t.Errorf("DialRelay() without token error = %v, want ErrRelayAuth", err)
+	}
+	if _, err := DialRelay("tcp://wrong@"+bare, "1-a-b", true); !errors.Is(err, ErrRelayAuth) {
+		t.Errorf("DialRelay() with wrong token error = %v, want ErrRelayAuth", err)
+	}
+
+	withToken := "tcp://s3cret@" + bare
+	c, err := DialRelay(withToken, "1-a-b", true)
+	if err != nil {
+		t.Fatalf("DialRelay() with token error = %v", err)
+	}
+	defer c.Close()
+	if _, err := DialRelay(withToken, "2-a-b", true); !errors.Is(err, ErrRelayRoomLimit) {
+		t.Errorf("second waiting room error = %v, want ErrRelayRoomLimit", err)
+	}
+	if _, err := DialRelay(withToken, "1-c-d", true); !errors.Is(err, ErrRelayRoleTaken) {
+		t.Errorf("second sender in room error = %v, want ErrRelayRoleTaken", err)
+	}
+	if st := srv.Status(); st.AuthFailures != 2 || st.LimitRejections != 1 {
+		t.Errorf("AuthFailures = %d, LimitRejections = %d, want 2, 1", st.AuthFailures, st.LimitRejections)
+	}
+
+	// Pairing into the existing room is still allowed.
+	peer, err := DialRelay(withToken, "1-a-b", false)
+	if err != nil {
+		t.Fatalf("DialRelay() peer error = %v", err)
+	}
+	peer.Close()
+}
+
+func TestMaskRelayAddr(t *testing.T) {
+	for in, want := range map[string]string{
+		"tcp://s3cret@relay:9000": "tcp://***@relay:9000",
+		"tok@relay:9000":          "***@relay:9000",
+		"tcp://relay:9000":        "tcp://relay:9000",
+	} {
+		if got := MaskRelayAddr(in); got != want {
+			t.Errorf("MaskRelayAddr(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSendReceiveOverPinnedTLS(t *testing.T) {
+	dir := t.TempDir()
+	cert, err := LoadOrCreateRelayCert(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", RelayTLSConfig(cert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := strings.TrimPrefix(acceptRelay(t, NewRelayServer(5*time.Second, nil), ln), "tcp://")
+	relay := "tls://" + addr + "?pin=" + CertPin(leaf)
+
+	var text string
+	errCh := make(chan error, 1)
+	go func() { errCh <- SendText(relay, "t008", "over tls", nil) }()
+	if err := Receive(relay, "t008", t.TempDir(), nil, &text, nil); err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("SendText() error = %v", err)
+	}
+	if text != "over tls" {
+		t.Errorf("text = %q", text)
+	}
+
+	if _, err := DialRelay("tls://"+addr+"?pin="+strings.Repeat("0", 64), "t008", true); err == nil || !strings.Contains(err.Error(), "pin mismatch") {
+		t.Errorf("DialRelay() with wrong pin error = %v, want pin mismatch", err)
+	}
+	if _, err := DialRelay("tls://"+addr, "t008", true); err == nil {
+		t.Error("DialRelay() without pin should fail certificate verification")
+	}
+}
+
+func TestSendReceiveOverWebSocket(t *testing.T) {
+	srv := NewRelayServer(5*time.Second, nil)
+	tcpRelay := serveRelay(t, srv)
+	ws := httptest.NewServer(srv.WebSocketHandler())
+	defer ws.Close()
+	wsRelay := "ws://" + strings.TrimPrefix(ws.URL, "http://")
+
+	srcDir, outDir := t.TempDir(), t.TempDir()
+	data := writeRandomFile(t, srcDir, "data.bin", 100*1024)
+
+	// The sender goes through WebSocket, the receiver through plain TCP.
+	var result ReceiveResult
+	errCh := make(chan error, 1)
+	go func() { errCh <- SendFile(wsRelay, "t009", filepath.Join(srcDir, "data.bin"), nil) }()
+	if err := Receive(tcpRelay, "t009", outDir, nil, nil, &result); err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("SendFile() error = %v", err)
+	}
+	got, err := os.ReadFile(result.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("received content differs from sent content")
+	}
+}
+
+func TestParseRelayEndpoint(t *testing.T) {
+	for in, want := range map[string]relayEndpoint{
+		"relay:9000":                   {scheme: SchemeTCP, addr: "relay:9000"},
+		"tcp://tok@relay:9000":         {scheme: SchemeTCP, addr: "relay:9000", token: "tok"},
+		"tls://relay:443?pin=AB":       {scheme: SchemeTLS, addr: "relay:443", pin: "ab"},
+		"ws://relay:8080":              {scheme: SchemeWS, addr: "relay:8080", path: DefaultWebSocketPath},
+		"wss://tok@relay/custom?pin=1": {scheme: SchemeWSS, addr: "relay", path: "/custom", token: "tok", pin: "1"},
+	} {
+		ep, err := parseRelayEndpoint(in)
+		if err != nil || *ep != want {
+			t.Errorf("parseRelayEndpoint(%q) = %+v, %v, want %+v", in, ep, err, want)
+		}
+	}
+	for _, in := range []string{"udp://relay:9000", "tcp://relay:9000?pin=ab", "tcp://"} {
+		if _, err := parseRelayEndpoint(in); err == nil {
+			t.Errorf("parseRelayEndpoint(%q) should fail", in)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package wormhole
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultCodeWords is the number of words in a generated code: 24 bits of
+	// secret, more than the numeric codes they replaced.
+	DefaultCodeWords = 3
+	// codeChannelMax bounds the numeric channel (room ID) of generated codes.
+	// Seven digits keep concurrent pairings on a busy relay from landing in
+	// the same room, more room IDs than the old 4-character numeric codes had.
+	codeChannelMax = 9_999_999
+	// maxRoomIDLen caps the room ID sent to the relay (one length byte on the wire).
+	maxRoomIDLen = 64
+)
+
+// GenerateCode creates a code like "4817203-guitar-sunset-maple" with DefaultCodeWords words.
+func GenerateCode() string {
+	return GenerateCodeWords(DefaultCodeWords)
+}
+
+// GenerateCodeWords creates "<channel>-<word>-...-<word>" with n words from the
+// built-in wordlist. The channel is the relay room ID; the whole phrase is the
+// PAKE password, so the relay never learns the secret words.
+func GenerateCodeWords(n int) string {
+	if n < 1 {
+		n = 1
+	}
+	parts := make([]string, 0, n+1)
+	parts = append(parts, strconv.FormatInt(randInt(codeChannelMax)+1, 10))
+	for i := 0; i < n; i++ {
+		parts = append(parts, codeWords[randInt(int64(len(codeWords)))])
+	}
+	return strings.Join(parts, "-")
+}
+
+func randInt(max int64) int64 {
+	n, err := rand.Int(rand.Reader, big.NewInt(max))
+	if err != nil {
+		panic("wormhole: crypto/rand failed: " + err.Error())
+	}
+	return n.Int64()
+}
+
+// NormalizeCode lowercases a typed code and accepts spaces as word separators.
+func NormalizeCode(code string) string {
+	return strings.Join(strings.Fields(strings.ToLower(code)), "-")
+}
+
+// RoomID returns the relay room for a code: the numeric channel of a word code
+// ("7-guitar-sunset" -> "7"), or the whole code for legacy free-form codes.
+func RoomID(code string) string {
+	if i := strings.IndexByte(code, '-'); i > 0 && isDigits(code[:i]) {
+		return code[:i]
+	}
+	if len(code) > maxRoomIDLen {
+		return code[:maxRoomIDLen]
+	}
+	return code
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// CompleteCode returns shell completions for a partially typed word code:
+// the typed prefix plus every wordlist entry matching its last word.
+func CompleteCode(partial string) []string {
+	i := strings.LastIndexByte(partial, '-')
+	if i < 0 || !isDigits(partial[:strings.IndexByte(partial, '-')]) {
+		return nil
+	}
+	prefix, last := partial[:i+1], strings.ToLower(partial[i+1:])
+	var out []string
+	for _, w := range codeWords {
+		if strings.HasPrefix(w, last) {
+			out = append(out, prefix+w)
+		}
+	}
+	return out
+}
@@ -0,0 +1,124 @@
+package wormhole
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGenerateCode(t *testing.T) {
+	re := regexp.MustCompile(`^[1-9][0-9]{0,6}-[a-z]+-[a-z]+-[a-z]+$`)
+	for i := 0; i < 50; i++ {
+		code := GenerateCode()
+		if !re.MatchString(code) {
+			t.Fatalf("GenerateCode() = %q, want <channel>-<word>-<word>-<word>", code)
+		}
+	}
+}
+
+func TestGenerateCodeRoomSpace(t *testing.T) {
+	// At least as many rooms as the old 4-character codes (36^4), so busy
+	// relays rarely pair strangers.
+	if codeChannelMax < 36*36*36*36 {
+		t.Fatalf("codeChannelMax = %d, want at least %d", codeChannelMax, 36*36*36*36)
+	}
+	rooms := map[string]bool{}
+	wide := false
+	for i := 0; i < 200; i++ {
+		room := RoomID(GenerateCode())
+		rooms[room] = true
+		wide = wide || len(room) >= 6
+	}
+	if len(rooms) < 199 || !wide {
+		t.Errorf("200 codes used %d rooms (wide %v), want them spread over the channel space", len(rooms), wide)
+	}
+}
+
+func TestRoomID(t *testing.T) {
+	tests := map[string]string{
+		"7-guitar-sunset":  "7",
+		"1234-amber-otter": "1234",
+		"abc1":             "abc1",
+		"abc-123":          "abc-123",
+		"-guitar":          "-guitar",
+	}
+	for code, want := range tests {
+		if got := RoomID(code); got != want {
+			t.Errorf("RoomID(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+func TestNormalizeCode(t *testing.T) {
+	if got := NormalizeCode("  7 Guitar  SUNSET "); got != "7-guitar-sunset" {
+		t.Errorf("NormalizeCode() = %q", got)
+	}
+}
+
+func TestCompleteCode(t *testing.T) {
+	got := CompleteCode("7-guitar-su")
+	if len(got) == 0 {
+		t.Fatal("expected completions for 7-guitar-su")
+	}
+	for _, c := range got {
+		if !strings.HasPrefix(c, "7-guitar-su") {
+			t.Errorf("completion %q does not extend the prefix", c)
+		}
+	}
+	if CompleteCode("abc") != nil {
+		t.Error("free-form codes should not complete")
+	}
+}
+
+func TestRelayHeaderRoundTrip(t *testing.T) {
+	open := func(string) error { return nil }
+	var buf bytes.Buffer
+	if err := writeRelayHeader(&buf, "", "7", RoleReceiver, false); err != nil {
+		t.Fatal(err)
+	}
+	h, err := readRelayHeader(&buf, open)
+	if err != nil || h.roomID != "7" || h.role != RoleReceiver || h.legacy {
+		t.Errorf("readRelayHeader() = %+v, %v", h, err)
+	}
+
+	buf.Reset()
+	if err := writeRelayHeader(&buf, "s3cret", "42", RoleSender, false); err != nil {
+		t.Fatal(err)
+	}
+	var seen string
+	h, err = readRelayHeader(&buf, func(tok string) error { seen = tok; return nil })
+	if err != nil || seen != "s3cret" || h.roomID != "42" {
+		t.Errorf("readRelayHeader() with token = %+v, %q, %v", h, seen, err)
+	}
+
+	legacy := bytes.NewReader([]byte{'a', 'b', 'c', '1', RoleSender})
+	h, err = readRelayHeader(legacy, open)
+	if err != nil || h.roomID != "abc1" || h.role != RoleSender || !h.legacy {
+		t.Errorf("legacy readRelayHeader() = %+v, %v", h, err)
+	}
+}
+
+func TestRelayPairsLegacyClients(t *testing.T) {
+	addr := strings.TrimPrefix(startRelay(t), "tcp://")
+	dial := func(role byte) net.Conn {
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Write([]byte{'o', 'l', 'd', '1', role})
+		return c
+	}
+	a := dial(RoleSender)
+	defer a.Close()
+	b := dial(RoleReceiver)
+	defer b.Close()
+
+	a.Write([]byte("hi"))
+	got := make([]byte, 2)
+	if _, err := io.ReadFull(b, got); err != nil || string(got) != "hi" {
+		t.Errorf("piped %q, %v", got, err)
+	}
+}
@@ -0,0 +1,233 @@
+package wormhole
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// CompGzip is the only body compression offered today. The sender proposes it
+// in MetaHeader.Comp and uses it only if the receiver echoes it in AckHeader.Comp,
+// so peers that predate compression keep receiving raw bodies.
+const CompGzip = "gzip"
+
+// sniffLen is how many leading bytes are checked for compressed-format magic.
+const sniffLen = 512
+
+// compressedExts are extensions of formats that gzip cannot shrink further.
+var compressedExts = map[string]bool{
+	".gz": true, ".tgz": true, ".zip": true, ".zst": true, ".xz": true, ".bz2": true,
+	".7z": true, ".rar": true, ".lz4": true, ".br": true, ".jar": true, ".apk": true,
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true,
+	".mp3": true, ".aac": true, ".ogg": true, ".flac": true, ".opus": true,
+	".mp4": true, ".mkv": true, ".mov": true, ".webm": true, ".avi": true,
+	".docx": true, ".xlsx": true, ".pptx": true, ".odt": true, ".epub": true,
+}
+
+// compressedMagic are leading bytes of compressed formats.
+var compressedMagic = [][]byte{
+	{0x1f, 0x8b},                       // gzip
+	{'P', 'K', 0x03, 0x04},             // zip and zip-based (docx, jar, apk)
+	{0x28, 0xb5, 0x2f, 0xfd},           // zstd
+	{0xfd, '7', 'z', 'X', 'Z', 0x00},   // xz
+	{'B', 'Z', 'h'},                    // bzip2
+	{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}, // 7z
+	{0x04, 0x22, 0x4d, 0x18},           // lz4
+	{0x89, 'P', 'N', 'G'},              // png
+	{0xff, 0xd8, 0xff},                 // jpeg
+	{'G', 'I', 'F', '8'},               // gif
+	{'O', 'g', 'g', 'S'},               // ogg
+	{'f', 'L', 'a', 'C'},               // flac
+	{'I', 'D', '3'},                    // mp3 with ID3 tag
+	{0x1a, 0x45, 0xdf, 0xa3},           // matroska / webm
+	{'R', 'a', 'r', '!', 0x1a, 0x07},   // rar
+}
+
+// looksCompressed reports whether name or the leading bytes head indicate
+// already-compressed content.
+func looksCompressed(name string, head []byte) bool {
+	if compressedExts[strings.ToLower(filepath.Ext(name))] {
+		return true
+	}
+	for _, m := range compressedMagic {
+		if bytes.HasPrefix(head, m) {
+			return true
+		}
+	}
+	// ISO base media (mp4, mov, heic): "ftyp" at offset 4; RIFF WebP/AVI.
+	if len(head) >= 12 && (string(head[4:8]) == "ftyp" ||
+		string(head[:4]) == "RIFF" && (string(head[8:12]) == "WEBP" || string(head[8:12]) == "AVI ")) {
+		return true
+	}
+	return false
+}
+
+// fileLooksCompressed checks the extension and magic bytes of the file at p.
+func fileLooksCompressed(p string) bool {
+	if compressedExts[strings.ToLower(filepath.Ext(p))] {
+		return true
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, sniffLen)
+	n, _ := io.ReadFull(f, head)
+	return looksCompressed(p, head[:n])
+}
+
+// bundleLooksCompressed reports whether most of a bundle's bytes are in
+// already-compressed files, judged by extension.
+func bundleLooksCompressed(sources []bundleSource, total int64) bool {
+	var packed int64
+	for _, s := range sources {
+		if s.entry.Kind == EntryFile && compressedExts[strings.ToLower(path.Ext(s.entry.Path))] {
+			packed += s.entry.Size
+		}
+	}
+	return total > 0 && packed*2 > total
+}
+
+// offerComp returns the compression to propose, or "" when disabled by opts,
+// when the peer cannot decode it, or when the content is already compressed.
+func offerComp(opts *TransferOptions, caps Capabilities, compressed bool) string {
+	if (opts != nil && opts.NoCompress) || !caps.hasComp(CompGzip) || compressed {
+		return ""
+	}
+	return CompGzip
+}
+
+// acceptComp returns the compression the receiver agrees to for an offer.
+func acceptComp(offered string) string {
+	if offered == CompGzip {
+		return CompGzip
+	}
+	return ""
+}
+
+// agreedComp is what the sender uses after the ack: the offer only if echoed.
+func agreedComp(offered string, ack *AckHeader) string {
+	if offered != "" && ack.Comp == offered {
+		return offered
+	}
+	return ""
+}
+
+// wireCounter counts bytes passing through and reports the running total.
+type wireCounter struct {
+	w      io.Writer
+	r      io.Reader
+	n      int64
+	report func(int64)
+}
+
+func (c *wireCounter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.add(n)
+	return n, err
+}
+
+func (c *wireCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.add(n)
+	return n, err
+}
+
+func (c *wireCounter) add(n int) {
+	c.n += int64(n)
+	if n > 0 && c.report != nil {
+		c.report(c.n)
+	}
+}
+
+// nopWriteCloser is a body writer for uncompressed payloads.
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// gzipBody is a compressed body writer: gzip over chunkWriter framing.
+type gzipBody struct {
+	zw *gzip.Writer
+	cw *chunkWriter
+}
+
+func (b *gzipBody) Write(p []byte) (int, error) { return b.zw.Write(p) }
+
+// Close flushes the gzip stream and writes the end-of-stream chunk.
+func (b *gzipBody) Close() error {
+	if err := b.zw.Close(); err != nil {
+		return err
+	}
+	return b.cw.Close()
+}
+
+// newBodyWriter wraps w for everything the sender writes after the ack (body,
+// manifest, trailers). With comp set, that is gzip'd and carried in chunks since
+// its length is unknown; Close must be called to end it. onWire receives the
+// compressed byte count.
+func newBodyWriter(w io.Writer, comp string, onWire func(int64)) io.WriteCloser {
+	if comp == "" {
+		return nopWriteCloser{w}
+	}
+	cw := &chunkWriter{w: w}
+	zw, _ := gzip.NewWriterLevel(&wireCounter{w: cw, report: onWire}, gzip.BestSpeed) // level is valid
+	return &gzipBody{zw: zw, cw: cw}
+}
+
+// bodyReader is the receiving side of newBodyWriter.
+type bodyReader struct {
+	io.Reader
+	cr *chunkReader
+}
+
+// newBodyReader wraps r to read what newBodyWriter wrote. finish must be called
+// after the last trailer; it checks the compressed body ended where expected.
+func newBodyReader(r io.Reader, comp string, onWire func(int64)) *bodyReader {
+	if comp == "" {
+		return &bodyReader{Reader: r}
+	}
+	cr := &chunkReader{r: r}
+	return &bodyReader{Reader: &lazyGzip{src: &wireCounter{r: cr, report: onWire}}, cr: cr}
+}
+
+// finish drains the end of a compressed body: the gzip footer and the
+// end-of-stream chunk. Leftover data means the peer sent more than it declared.
+func (b *bodyReader) finish() error {
+	if b.cr == nil {
+		return nil
+	}
+	if n, err := io.Copy(io.Discard, b.Reader); err != nil {
+		return err
+	} else if n > 0 {
+		return ErrInvalidFrameSize
+	}
+	_, err := io.Copy(io.Discard, b.cr)
+	return err
+}
+
+// lazyGzip opens the gzip reader on first Read, so constructing a body reader
+// never blocks waiting for the sender's gzip header.
+type lazyGzip struct {
+	src io.Reader
+	zr  *gzip.Reader
+}
+
+func (l *lazyGzip) Read(p []byte) (int, error) {
+	if l.zr == nil {
+		zr, err := gzip.NewReader(l.src)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		zr.Multistream(false)
+		l.zr = zr
+	}
+	return l.zr.Read(p)
+}
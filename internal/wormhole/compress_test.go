@@ -0,0 +1,84 @@
+package wormhole
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLooksCompressed(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("hello"))
+	zw.Close()
+
+	tests := []struct {
+		name string
+		head []byte
+		want bool
+	}{
+		{"app.log", []byte("2024-01-01 INFO started"), false},
+		{"dump.json", []byte(`{"a":1}`), false},
+		{"photo.JPG", nil, true},
+		{"backup.tar.gz", nil, true},
+		{"stdin", gz.Bytes(), true},
+		{"noext", []byte("PK\x03\x04rest"), true},
+		{"clip", []byte("\x00\x00\x00\x18ftypmp42"), true},
+	}
+	for _, tt := range tests {
+		if got := looksCompressed(tt.name, tt.head); got != tt.want {
+			t.Errorf("looksCompressed(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCompressedTransfer(t *testing.T) {
+	relay := startRelay(t)
+	srcDir, outDir := t.TempDir(), t.TempDir()
+	data := []byte(strings.Repeat(`{"level":"info","msg":"request served","status":200}`+"\n", 20000))
+	src := filepath.Join(srcDir, "app.json")
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var sentWire, recvWire int64
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- SendFile(relay, "t017", src, &TransferOptions{OnWire: func(n int64) { sentWire = n }})
+	}()
+	var result ReceiveResult
+	if err := Receive(relay, "t017", outDir, &TransferOptions{OnWire: func(n int64) { recvWire = n }}, nil, &result); err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("SendFile() error = %v", err)
+	}
+	got, err := os.ReadFile(result.FilePath)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("received file differs (err %v)", err)
+	}
+	if recvWire == 0 || recvWire != sentWire || recvWire*10 > int64(len(data)) {
+		t.Errorf("wire bytes sent %d, received %d for %d logical; want equal and <10%%", sentWire, recvWire, len(data))
+	}
+
+	// Already-compressed input is sent raw.
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(data)
+	zw.Close()
+	go func() { errCh <- SendStream(relay, "t018", bytes.NewReader(gz.Bytes()), "logs.gz", nil) }()
+	recvWire = 0
+	var out bytes.Buffer
+	if err := Receive(relay, "t018", outDir, &TransferOptions{Output: &out, OnWire: func(n int64) { recvWire = n }}, nil, nil); err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("SendStream() error = %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), gz.Bytes()) || recvWire != 0 {
+		t.Errorf("gzip stream: equal %v, wire %d (want raw)", bytes.Equal(out.Bytes(), gz.Bytes()), recvWire)
+	}
+}
@@ -1,6 +1,9 @@
 package wormhole
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 const (
 	// MagicVerify is sent after handshake to verify the channel is secure.
@@ -19,12 +22,53 @@ const (
 type PayloadType uint8
 
 const (
-	TypeFile PayloadType = 1
-	TypeText PayloadType = 2
+	TypeFile   PayloadType = 1
+	TypeText   PayloadType = 2
+	TypeDir    PayloadType = 3 // Manifest + concatenated file bodies (directories, multiple files)
+	TypeStream PayloadType = 4 // Chunked body of unknown length (stdin); see chunkWriter
+)
+
+func (t PayloadType) String() string {
+	switch t {
+	case TypeFile:
+		return "file"
+	case TypeText:
+		return "text"
+	case TypeDir:
+		return "bundle"
+	case TypeStream:
+		return "stream"
+	}
+	return fmt.Sprintf("type %d", uint8(t))
+}
+
+// Manifest entry kinds for TypeDir payloads.
+const (
+	EntryFile    = "f"
+	EntryDir     = "d"
+	EntrySymlink = "l"
 )
 
 var (
 	ErrHandshakeFailed  = errors.New("wormhole: handshake failed")
 	ErrVerifyFailed     = errors.New("wormhole: verification failed (magic mismatch)")
 	ErrInvalidFrameSize = errors.New("wormhole: invalid frame size")
+	ErrUnsafePath       = errors.New("wormhole: unsafe path in manifest")
+	ErrRecordAuth       = errors.New("wormhole: record authentication failed (data tampered or corrupted in transit)")
+	ErrTruncated        = errors.New("wormhole: stream truncated (connection closed without end-of-stream record)")
+	ErrLegacyPeer       = errors.New("wormhole: peer uses legacy unauthenticated AES-CTR; upgrade both sides")
+	ErrHashMismatch     = errors.New("wormhole: content hash mismatch, received data discarded")
+	ErrRelayAuth        = errors.New("wormhole: relay rejected the token (set it in the relay URL, e.g. tcp://TOKEN@host:9000)")
+	ErrRelayRoomLimit   = errors.New("wormhole: relay refused: too many waiting rooms from this address")
+	ErrRelayBusy        = errors.New("wormhole: relay refused: too many active transfers, try again later")
+	ErrRelayRoleTaken   = errors.New("wormhole: relay refused: someone with the same role is already waiting on this code (is it in use?)")
+	ErrRelayNoMailbox   = errors.New("wormhole: relay has no mailbox (start it with --mailbox-dir)")
+	ErrMailboxEmpty     = errors.New("wormhole: nothing in the mailbox for this code (wrong code, already collected or expired)")
+	ErrMailboxFull      = errors.New("wormhole: relay mailbox is full, the payload exceeds its quota")
+	ErrRejected         = errors.New("wormhole: transfer rejected by peer")
+	ErrDeclined         = errors.New("wormhole: offer declined")
+	ErrExists           = errors.New("wormhole: refusing to overwrite existing file")
+	ErrIncompatiblePeer = errors.New("wormhole: incompatible peer")
+	ErrSASRejected      = errors.New("wormhole: security code not confirmed; session closed before any data was sent")
+	ErrPeerClosedVerify = errors.New("wormhole: peer closed during verification (wrong code, or peer runs an older version without authenticated encryption)")
 )
@@ -0,0 +1,271 @@
+package wormhole
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/A-Flex-Box/cli/internal/logger"
+)
+
+const (
+	// directDialTimeout bounds the direct attempt (dial + PAKE) before the
+	// session stays on the relay.
+	directDialTimeout = 2 * time.Second
+	// maxCandidates caps the local addresses offered to the peer.
+	maxCandidates = 8
+)
+
+// PathInfo tells how a session's bytes travel between the peers.
+type PathInfo struct {
+	Direct bool   // true: peer-to-peer TCP on the local network
+	Remote string // peer address (direct) or relay address (relayed)
+}
+
+func (p PathInfo) String() string {
+	if p.Direct {
+		return "direct (" + p.Remote + ")"
+	}
+	return "relayed via " + p.Remote
+}
+
+// localCandidates lists this host's LAN addresses with port. A variable so
+// tests can offer loopback, which is excluded for real peers.
+var localCandidates = interfaceCandidates
+
+// interfaceCandidates returns up, non-loopback unicast addresses (IPv4 first)
+// joined with port. Link-local IPv6 needs a zone and is skipped.
+func interfaceCandidates(port int) []string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var v4, v6 []string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok || !ipnet.IP.IsGlobalUnicast() {
+				continue
+			}
+			hostport := net.JoinHostPort(ipnet.IP.String(), strconv.Itoa(port))
+			if ipnet.IP.To4() != nil {
+				v4 = append(v4, hostport)
+			} else {
+				v6 = append(v6, hostport)
+			}
+		}
+	}
+	out := append(v4, v6...)
+	if len(out) > maxCandidates {
+		out = out[:maxCandidates]
+	}
+	return out
+}
+
+// openSession dials the relay, runs PAKE, agrees on a protocol version with
+// the peer (exchangeHello), then tries to move the session onto a direct LAN
+// connection. The returned SecureConn owns its transport (relay or direct);
+// close it when done. noDirect skips the direct attempt but still runs the
+// exchange so both sides agree. code picks the relay room and password is the
+// PAKE password: the code itself, or a tunnel's rejoin secret.
+func openSession(relayAddr, code, password string, isSender, noDirect bool) (*SecureConn, PathInfo, error) {
+	conn, err := DialRelay(relayAddr, code, isSender)
+	if err != nil {
+		return nil, PathInfo{}, err
+	}
+	secure, err := UpgradeConn(conn, password, isSender)
+	if err != nil {
+		conn.Close()
+		return nil, PathInfo{}, err
+	}
+	caps, err := exchangeHello(secure, isSender)
+	if err != nil {
+		secure.Close()
+		return nil, PathInfo{}, err
+	}
+	secure.caps = caps
+	relayed := PathInfo{Remote: MaskRelayAddr(relayAddr)}
+
+	var direct *SecureConn
+	var addr string
+	if isSender {
+		direct, addr, err = negotiateSender(secure, noDirect)
+	} else {
+		direct, addr, err = negotiateReceiver(secure, noDirect)
+	}
+	if err != nil {
+		secure.Close()
+		return nil, PathInfo{}, err
+	}
+	if direct == nil {
+		logger.Info("wormhole.openSession relayed", logger.Context("result", map[string]any{"relay": relayed.Remote})...)
+		return secure, relayed, nil
+	}
+	// The direct PAKE used a secret sent inside the relay session; the code
+	// itself was only proven there, so that is the SAS users compare.
+	direct.sas = secure.sas
+	direct.caps = secure.caps
+	direct.rejoin = secure.rejoin
+	secure.Close()
+	logger.Info("wormhole.openSession direct", logger.Context("result", map[string]any{"addr": addr})...)
+	return direct, PathInfo{Direct: true, Remote: addr}, nil
+}
+
+// negotiateSender reads the receiver's candidates, races TCP dials to them and
+// upgrades the first that connects. It always reports the outcome to the receiver.
+func negotiateSender(relay *SecureConn, noDirect bool) (*SecureConn, string, error) {
+	c, err := ReadCandidates(relay)
+	if err != nil {
+		return nil, "", err
+	}
+	var direct *SecureConn
+	var addr string
+	if !noDirect && len(c.Addrs) > 0 && c.Secret != "" {
+		direct, addr = dialDirect(c.Addrs, c.Secret)
+	}
+	if err := WritePathDecision(relay, &PathDecision{Direct: direct != nil, Addr: addr}); err != nil {
+		if direct != nil {
+			direct.Close()
+		}
+		return nil, "", err
+	}
+	return direct, addr, nil
+}
+
+// dialDirect dials all candidates at once and runs PAKE on the first TCP
+// connection to succeed. Losers are closed. Returns nil if nothing verifies in time.
+func dialDirect(addrs []string, secret string) (*SecureConn, string) {
+	type dialed struct {
+		conn net.Conn
+		addr string
+	}
+	deadline := time.Now().Add(directDialTimeout)
+	won := make(chan dialed, len(addrs))
+	var wg sync.WaitGroup
+	for _, a := range addrs {
+		wg.Add(1)
+		go func(a string) {
+			defer wg.Done()
+			conn, err := net.DialTimeout("tcp", a, time.Until(deadline))
+			if err != nil {
+				return
+			}
+			won <- dialed{conn, a}
+		}(a)
+	}
+	go func() {
+		wg.Wait()
+		close(won)
+	}()
+
+	first, ok := <-won
+	// Close every later connection; the receiver discards them when PAKE fails.
+	go func() {
+		for d := range won {
+			d.conn.Close()
+		}
+	}()
+	if !ok {
+		logger.Info("wormhole.dialDirect no candidate reachable", logger.Context("params", map[string]any{"candidates": addrs})...)
+		return nil, ""
+	}
+	first.conn.SetDeadline(deadline.Add(directDialTimeout))
+	s, err := Upgrade(first.conn, secret, true, nil, nil)
+	if err != nil {
+		first.conn.Close()
+		logger.Warn("wormhole.dialDirect upgrade failed", logger.Context("params", map[string]any{"addr": first.addr, "error": err.Error()})...)
+		return nil, ""
+	}
+	first.conn.SetDeadline(time.Time{})
+	return s, first.addr
+}
+
+// negotiateReceiver listens on an ephemeral port, offers its LAN addresses with
+// a fresh secret, and accepts the sender's direct connection if it chooses one.
+func negotiateReceiver(relay *SecureConn, noDirect bool) (*SecureConn, string, error) {
+	var ln net.Listener
+	offer := &Candidates{}
+	if !noDirect {
+		var err error
+		ln, err = net.Listen("tcp", ":0")
+		if err != nil {
+			logger.Warn("wormhole.negotiateReceiver listen failed", logger.Context("params", map[string]any{"error": err.Error()})...)
+		} else {
+			defer ln.Close()
+			offer.Addrs = localCandidates(ln.Addr().(*net.TCPAddr).Port)
+			offer.Secret = randomSecret()
+		}
+	}
+	if err := WriteCandidates(relay, offer); err != nil {
+		return nil, "", err
+	}
+
+	got := make(chan *SecureConn)
+	stop := make(chan struct{})
+	defer close(stop)
+	if ln != nil && len(offer.Addrs) > 0 {
+		go acceptDirect(ln, offer.Secret, got, stop)
+	}
+
+	d, err := ReadPathDecision(relay)
+	if err != nil {
+		return nil, "", err
+	}
+	if !d.Direct {
+		return nil, "", nil
+	}
+	if ln == nil {
+		return nil, "", fmt.Errorf("wormhole: peer chose a direct path that was not offered")
+	}
+	select {
+	case s := <-got:
+		return s, s.RemoteAddr().String(), nil
+	case <-time.After(directDialTimeout):
+		return nil, "", fmt.Errorf("wormhole: peer reported a direct connection this side never verified")
+	}
+}
+
+// acceptDirect upgrades incoming connections until one verifies with secret,
+// delivering it on got. Connections that fail PAKE are dropped.
+func acceptDirect(ln net.Listener, secret string, got chan<- *SecureConn, stop <-chan struct{}) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			conn.SetDeadline(time.Now().Add(2 * directDialTimeout))
+			s, err := Upgrade(conn, secret, false, nil, nil)
+			if err != nil {
+				conn.Close()
+				return
+			}
+			conn.SetDeadline(time.Time{})
+			select {
+			case got <- s:
+			case <-stop:
+				s.Close()
+			}
+		}()
+	}
+}
+
+// randomSecret returns 128 random bits as hex.
+func randomSecret() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("wormhole: crypto/rand failed: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,77 @@
+package wormhole
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// loopbackCandidates lets both peers of a test find each other directly.
+func loopbackCandidates(t *testing.T) {
+	t.Helper()
+	prev := localCandidates
+	localCandidates = func(port int) []string {
+		return []string{net.JoinHostPort("127.0.0.1", strconv.Itoa(port))}
+	}
+	t.Cleanup(func() { localCandidates = prev })
+}
+
+func TestTransferGoesDirect(t *testing.T) {
+	loopbackCandidates(t)
+	srv := NewRelayServer(5*time.Second, nil)
+	relay := serveRelay(t, srv)
+	srcDir, outDir := t.TempDir(), t.TempDir()
+	data := writeRandomFile(t, srcDir, "data.bin", 256*1024)
+
+	var sendPath, recvPath PathInfo
+	var result ReceiveResult
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- SendFile(relay, "t010", filepath.Join(srcDir, "data.bin"), &TransferOptions{OnPath: func(p PathInfo) { sendPath = p }})
+	}()
+	if err := Receive(relay, "t010", outDir, &TransferOptions{OnPath: func(p PathInfo) { recvPath = p }}, nil, &result); err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("SendFile() error = %v", err)
+	}
+
+	if !sendPath.Direct || !recvPath.Direct {
+		t.Errorf("paths = %v / %v, want direct on both sides", sendPath, recvPath)
+	}
+	got, err := os.ReadFile(result.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("received content differs from sent content")
+	}
+	if st := srv.Status(); st.BytesToReceiver >= int64(len(data)) {
+		t.Errorf("relay carried %d bytes; the body should have gone direct", st.BytesToReceiver)
+	}
+}
+
+func TestNoDirectStaysRelayed(t *testing.T) {
+	loopbackCandidates(t)
+	relay := startRelay(t)
+
+	var sendPath, recvPath PathInfo
+	var text string
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- SendText(relay, "t011", "via relay", &TransferOptions{NoDirect: true, OnPath: func(p PathInfo) { sendPath = p }})
+	}()
+	if err := Receive(relay, "t011", t.TempDir(), &TransferOptions{OnPath: func(p PathInfo) { recvPath = p }}, &text, nil); err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("SendText() error = %v", err)
+	}
+	if sendPath.Direct || recvPath.Direct || text != "via relay" {
+		t.Errorf("paths = %v / %v, text = %q; want relayed on both sides", sendPath, recvPath, text)
+	}
+}
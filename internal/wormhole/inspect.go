@@ -0,0 +1,439 @@
+package wormhole
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// inspectBodyLimit is how much of each request and response body is kept.
+	inspectBodyLimit = 64 << 10
+	// tapQueue is how many reads a parser may fall behind before it gives up on
+	// the connection; the connection itself is never slowed down.
+	tapQueue = 64
+	// replayTimeout bounds a replayed exchange end to end.
+	replayTimeout = 30 * time.Second
+)
+
+// HTTPExchange is one request and its response, as seen on the expose side.
+// Bodies hold at most inspectBodyLimit bytes; the sizes are the full ones.
+type HTTPExchange struct {
+	Start    time.Time
+	Duration time.Duration // From the request headers to the end of the response
+	Target   string        // TunnelTarget.String() of the service that answered
+	Replayed bool          // Sent from the inspector rather than through the tunnel
+
+	Method    string
+	URL       string // Request URI, e.g. "/api/users?page=2"
+	Proto     string
+	Host      string
+	ReqHeader http.Header
+	ReqBody   []byte
+	ReqSize   int64
+
+	Status     int
+	StatusText string // e.g. "200 OK"
+	RespHeader http.Header
+	RespBody   []byte
+	RespSize   int64
+
+	Err string // Set when no complete response was seen
+
+	network, addr string // Where to replay it
+}
+
+// Summary renders the exchange on one line, e.g. "GET /api → 200 (12ms, 1.2 kB)".
+func (x *HTTPExchange) Summary() string {
+	s := x.Method + " " + x.URL + " → "
+	if x.Err != "" {
+		return s + x.Err
+	}
+	return s + fmt.Sprintf("%d (%s, %s)", x.Status, x.Duration.Round(time.Millisecond), formatBytes(x.RespSize))
+}
+
+// Replay sends the captured request to the target again, on a new connection,
+// and returns the new exchange. It fails when the request body was truncated.
+func (x *HTTPExchange) Replay() (*HTTPExchange, error) {
+	if x.ReqSize > int64(len(x.ReqBody)) {
+		return nil, fmt.Errorf("request body was %s, only the first %s were captured", formatBytes(x.ReqSize), formatBytes(int64(len(x.ReqBody))))
+	}
+	req, err := http.NewRequest(x.Method, x.URL, bytes.NewReader(x.ReqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Host = x.Host
+	req.Header = x.ReqHeader.Clone()
+	req.Close = true
+
+	conn, err := net.DialTimeout(x.network, x.addr, replayTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(replayTimeout))
+
+	r := &HTTPExchange{
+		Start: time.Now(), Target: x.Target, Replayed: true,
+		Method: x.Method, URL: x.URL, Proto: x.Proto, Host: x.Host,
+		ReqHeader: x.ReqHeader, ReqBody: x.ReqBody, ReqSize: x.ReqSize,
+		network: x.network, addr: x.addr,
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	resp, err := readFinalResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.setResponse(resp); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// setResponse records resp and reads its body.
+func (x *HTTPExchange) setResponse(resp *http.Response) error {
+	x.Status, x.StatusText, x.RespHeader = resp.StatusCode, resp.Status, resp.Header
+	var err error
+	x.RespBody, x.RespSize, err = readBody(resp.Body)
+	x.Duration = time.Since(x.Start)
+	return err
+}
+
+// readFinalResponse reads a response to req, skipping interim 1xx responses
+// other than 101 Switching Protocols.
+func readFinalResponse(br *bufio.Reader, req *http.Request) (*http.Response, error) {
+	for {
+		resp, err := http.ReadResponse(br, req)
+		if err != nil || resp.StatusCode >= 200 || resp.StatusCode == http.StatusSwitchingProtocols {
+			return resp, err
+		}
+	}
+}
+
+// readBody reads r to the end and keeps the first inspectBodyLimit bytes.
+func readBody(r io.Reader) ([]byte, int64, error) {
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(r, inspectBodyLimit))
+	if err == nil {
+		var rest int64
+		rest, err = io.Copy(io.Discard, r)
+		n += rest
+	}
+	return buf.Bytes(), n, err
+}
+
+// tapStream is a copy of one direction of a connection, fed without blocking:
+// if the parser falls behind by tapQueue reads, the copy ends early instead.
+type tapStream struct {
+	mu     sync.Mutex
+	ch     chan []byte
+	closed bool
+	buf    []byte
+}
+
+func newTapStream() *tapStream {
+	return &tapStream{ch: make(chan []byte, tapQueue)}
+}
+
+func (t *tapStream) write(p []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	select {
+	case t.ch <- bytes.Clone(p):
+	default:
+		t.closed = true
+		close(t.ch)
+	}
+}
+
+func (t *tapStream) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closed {
+		t.closed = true
+		close(t.ch)
+	}
+}
+
+// Read is the parser's side; it returns io.EOF once the copy has ended.
+func (t *tapStream) Read(p []byte) (int, error) {
+	if len(t.buf) == 0 {
+		b, ok := <-t.ch
+		if !ok {
+			return 0, io.EOF
+		}
+		t.buf = b
+	}
+	n := copy(p, t.buf)
+	t.buf = t.buf[n:]
+	return n, nil
+}
+
+// tapReader copies what it reads from r into a tapStream.
+type tapReader struct {
+	r   io.Reader
+	tap *tapStream
+}
+
+func (t *tapReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 {
+		t.tap.write(p[:n])
+	}
+	if err != nil {
+		t.tap.close()
+	}
+	return n, err
+}
+
+// httpTap parses the two directions of a forwarded connection as HTTP/1.x and
+// reports each exchange as an EventHTTP. Connections that turn out not to be
+// HTTP, or that switch protocols, are simply no longer parsed.
+type httpTap struct {
+	req, resp *tapStream
+}
+
+// newHTTPTap starts parsing for a connection to target.
+func newHTTPTap(target TunnelTarget, ev chan<- UIEvent) *httpTap {
+	t := &httpTap{req: newTapStream(), resp: newTapStream()}
+	pending := make(chan *pendingExchange, tapQueue)
+	go t.readRequests(target, pending)
+	go t.readResponses(pending, ev)
+	return t
+}
+
+// close ends both copies, e.g. when the connection is closed.
+func (t *httpTap) close() {
+	t.req.close()
+	t.resp.close()
+}
+
+// pendingExchange is a request waiting for its response. done is closed once
+// the request body has been read.
+type pendingExchange struct {
+	x    *HTTPExchange
+	req  *http.Request
+	done chan struct{}
+}
+
+// readRequests parses requests in order and queues each as soon as its headers
+// are in, so an interim response such as 100 Continue can be matched before the body.
+func (t *httpTap) readRequests(target TunnelTarget, pending chan<- *pendingExchange) {
+	defer close(pending)
+	br := bufio.NewReader(t.req)
+	for {
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		p := &pendingExchange{
+			x: &HTTPExchange{
+				Start: time.Now(), Target: target.String(),
+				Method: req.Method, URL: req.RequestURI, Proto: req.Proto, Host: req.Host, ReqHeader: req.Header,
+				network: target.Network, addr: target.Addr,
+			},
+			req:  req,
+			done: make(chan struct{}),
+		}
+		pending <- p
+		p.x.ReqBody, p.x.ReqSize, err = readBody(req.Body)
+		close(p.done)
+		if err != nil || req.Header.Get("Upgrade") != "" {
+			return
+		}
+	}
+}
+
+// readResponses matches responses to queued requests and reports them.
+func (t *httpTap) readResponses(pending <-chan *pendingExchange, ev chan<- UIEvent) {
+	br := bufio.NewReader(t.resp)
+	for p := range pending {
+		resp, err := readFinalResponse(br, p.req)
+		if err == nil {
+			err = p.x.setResponse(resp)
+		}
+		<-p.done
+		if err != nil && p.x.Status == 0 {
+			p.x.Err = "no response"
+			p.x.Duration = time.Since(p.x.Start)
+		}
+		sendEvent(ev, UIEvent{Type: EventHTTP, Msg: "[HTTP] " + p.x.Summary(), HTTP: p.x})
+		if err != nil || p.x.Status == http.StatusSwitchingProtocols {
+			// Leave the request parser to end when the connection closes.
+			for range pending {
+			}
+			return
+		}
+	}
+}
+
+// HAR 1.2 (http://www.softwareishard.com/blog/har-12-spec/), the subset the
+// inspector can fill in.
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	Cookies     []harNameValue `json:"cookies"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	Cookies     []harNameValue `json:"cookies"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"` // Not in HAR 1.2 for postData, but widely read
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// WriteHAR writes exchanges as a HAR 1.2 log, readable by browser dev tools.
+func WriteHAR(w io.Writer, exchanges []*HTTPExchange) error {
+	har := harFile{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "cli wormhole", Version: strings.TrimPrefix(software(), "cli ")},
+		Entries: make([]harEntry, 0, len(exchanges)),
+	}}
+	for _, x := range exchanges {
+		har.Log.Entries = append(har.Log.Entries, x.harEntry())
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(har)
+}
+
+func (x *HTTPExchange) harEntry() harEntry {
+	ms := float64(x.Duration) / float64(time.Millisecond)
+	e := harEntry{
+		StartedDateTime: x.Start.Format(time.RFC3339Nano),
+		Time:            ms,
+		Request: harRequest{
+			Method:      x.Method,
+			URL:         "http://" + x.Host + x.URL,
+			HTTPVersion: x.Proto,
+			Headers:     harHeaders(x.ReqHeader),
+			QueryString: []harNameValue{},
+			Cookies:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    x.ReqSize,
+		},
+		Response: harResponse{
+			Status:      x.Status,
+			StatusText:  strings.TrimSpace(strings.TrimPrefix(x.StatusText, fmt.Sprint(x.Status))),
+			HTTPVersion: x.Proto,
+			Headers:     harHeaders(x.RespHeader),
+			Cookies:     []harNameValue{},
+			Content:     harContent{Size: x.RespSize, MimeType: x.RespHeader.Get("Content-Type")},
+			RedirectURL: x.RespHeader.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    x.RespSize,
+		},
+		Timings: harTimings{Send: 0, Wait: ms, Receive: 0},
+		Comment: x.Err,
+	}
+	if u, err := http.NewRequest(x.Method, x.URL, nil); err == nil {
+		for k, vs := range u.URL.Query() {
+			for _, v := range vs {
+				e.Request.QueryString = append(e.Request.QueryString, harNameValue{k, v})
+			}
+		}
+	}
+	if x.ReqSize > 0 {
+		text, enc := harText(x.ReqBody)
+		e.Request.PostData = &harPostData{MimeType: x.ReqHeader.Get("Content-Type"), Text: text, Encoding: enc}
+	}
+	e.Response.Content.Text, e.Response.Content.Encoding = harText(x.RespBody)
+	if x.Replayed {
+		e.Comment = strings.TrimSpace("replayed " + e.Comment)
+	}
+	return e
+}
+
+func harHeaders(h http.Header) []harNameValue {
+	out := []harNameValue{}
+	for _, k := range slices.Sorted(maps.Keys(h)) {
+		for _, v := range h[k] {
+			out = append(out, harNameValue{k, v})
+		}
+	}
+	return out
+}
+
+// harText returns body as text, base64-encoded when it is not UTF-8.
+func harText(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
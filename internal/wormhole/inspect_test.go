@@ -0,0 +1,97 @@
+package wormhole
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestInspectHTTP(t *testing.T) {
+	relay := startRelay(t)
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+		}
+		fmt.Fprintf(w, "%s %s %s", r.Method, r.URL.Path, body)
+	}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	targets, err := ParseTunnelTargets("127.0.0.1:" + port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exposeEv, connectEv := make(chan UIEvent, 64), make(chan UIEvent, 64)
+	bind := freeAddr(t)
+	go ExposeTunnel(relay, "t025", targets, &TunnelOptions{Events: exposeEv, InspectHTTP: true})
+	go ConnectTunnel(relay, "t025", []TunnelBind{{Local: bind, Remote: port}}, &TunnelOptions{Events: connectEv})
+	waitEvent(t, connectEv, EventListen)
+
+	// Both requests share one keep-alive connection.
+	client := &http.Client{Transport: &http.Transport{MaxConnsPerHost: 1}}
+	defer client.CloseIdleConnections()
+	for _, req := range []struct{ method, path, body string }{{"GET", "/a?x=1", ""}, {"POST", "/b", "hello"}} {
+		r, _ := http.NewRequest(req.method, "http://"+bind+req.path, strings.NewReader(req.body))
+		resp, err := client.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	get, post := waitEvent(t, exposeEv, EventHTTP).HTTP, waitEvent(t, exposeEv, EventHTTP).HTTP
+	if get.Method != "GET" || get.URL != "/a?x=1" || get.Status != 200 || string(get.RespBody) != "GET /a " {
+		t.Errorf("GET exchange = %s %s → %d %q", get.Method, get.URL, get.Status, get.RespBody)
+	}
+	if post.Method != "POST" || string(post.ReqBody) != "hello" || post.Status != 201 || post.RespSize != int64(len("POST /b hello")) {
+		t.Errorf("POST exchange = %s %q → %d (%d bytes)", post.Method, post.ReqBody, post.Status, post.RespSize)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteHAR(&buf, []*HTTPExchange{get, post}); err != nil {
+		t.Fatal(err)
+	}
+	var har harFile
+	if err := json.Unmarshal(buf.Bytes(), &har); err != nil {
+		t.Fatalf("HAR is not JSON: %v", err)
+	}
+	if e := har.Log.Entries; len(e) != 2 || len(e[0].Request.QueryString) != 1 || e[1].Request.PostData == nil || e[1].Request.PostData.Text != "hello" {
+		t.Errorf("HAR entries = %+v", e)
+	}
+
+	replayed, err := post.Replay()
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if replayed.Status != 201 || string(replayed.RespBody) != "POST /b hello" || !replayed.Replayed || hits.Load() != 3 {
+		t.Errorf("replay = %d %q (hits %d)", replayed.Status, replayed.RespBody, hits.Load())
+	}
+}
+
+func TestInspectSkipsNonHTTP(t *testing.T) {
+	relay := startRelay(t)
+	port := startEcho(t, "raw:")
+	targets, _ := ParseTunnelTargets(port)
+	exposeEv, connectEv := make(chan UIEvent, 64), make(chan UIEvent, 64)
+	bind := freeAddr(t)
+	go ExposeTunnel(relay, "t026", targets, &TunnelOptions{Events: exposeEv, InspectHTTP: true})
+	go ConnectTunnel(relay, "t026", []TunnelBind{{Local: bind, Remote: port}}, &TunnelOptions{Events: connectEv})
+	waitEvent(t, connectEv, EventListen)
+
+	echoThrough(t, bind, "raw:", strings.Repeat("x", 100))
+	for len(exposeEv) > 0 {
+		if e := <-exposeEv; e.Type == EventHTTP {
+			t.Errorf("non-HTTP connection reported as %q", e.Msg)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package wormhole
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// exposeGate enforces the stream limits of an expose side across reconnects:
+// at most MaxStreams streams at once, a single one with OneShot, and none once
+// TTL has passed. done is closed when the tunnel must end.
+type exposeGate struct {
+	max     int
+	oneShot bool
+
+	mu     sync.Mutex
+	active int
+	used   bool // OneShot: a stream reached its target
+	done   chan struct{}
+	reason string // why done was closed
+}
+
+// newExposeGate returns the gate for opts, starting the TTL clock now. opts may
+// be nil.
+func newExposeGate(opts *TunnelOptions) *exposeGate {
+	g := &exposeGate{done: make(chan struct{})}
+	if opts == nil {
+		return g
+	}
+	g.max, g.oneShot = opts.MaxStreams, opts.OneShot
+	if opts.TTL > 0 {
+		time.AfterFunc(opts.TTL, func() { g.end("tunnel lifetime of " + opts.TTL.String() + " reached") })
+	}
+	return g
+}
+
+// admit reserves a slot for a new stream, or says why there is none. Every
+// admitted stream must be released. OneShot admits one stream at a time, so a
+// refused or failed one leaves the tunnel for the next.
+func (g *exposeGate) admit() (ok bool, why string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch {
+	case g.reason != "":
+		return false, g.reason
+	case g.oneShot && g.used:
+		return false, "one-shot tunnel already had its connection"
+	case g.oneShot && g.active > 0:
+		return false, "one-shot tunnel is busy with a connection"
+	case g.max > 0 && g.active >= g.max:
+		return false, fmt.Sprintf("stream limit of %d reached", g.max)
+	}
+	g.active++
+	return true, ""
+}
+
+// release frees the slot of a finished stream. With OneShot, a stream that
+// reached its target (joined) uses up the tunnel and ends it.
+func (g *exposeGate) release(joined bool) {
+	g.mu.Lock()
+	g.active--
+	if joined {
+		g.used = true
+	}
+	g.mu.Unlock()
+	if g.oneShot && joined {
+		g.end("one-shot connection finished")
+	}
+}
+
+// end closes done, recording why; later calls do nothing.
+func (g *exposeGate) end(reason string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.reason != "" {
+		return
+	}
+	g.reason = reason
+	close(g.done)
+}
+
+// ended returns why the tunnel must end, or "" while it may go on.
+func (g *exposeGate) ended() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.reason
+}
+
+// idleWatch calls onIdle once nothing has been read for timeout. Readers wrap
+// each direction of a stream so either one keeps it alive.
+type idleWatch struct {
+	timeout time.Duration
+	last    atomic.Int64 // UnixNano of the last read
+	timer   *time.Timer
+}
+
+func watchIdle(timeout time.Duration, onIdle func()) *idleWatch {
+	w := &idleWatch{timeout: timeout}
+	w.last.Store(time.Now().UnixNano())
+	w.timer = time.AfterFunc(timeout, func() {
+		// Reads do not touch the timer; it re-arms for what is left instead.
+		if left := w.timeout - time.Since(time.Unix(0, w.last.Load())); left > 0 {
+			w.timer.Reset(left)
+			return
+		}
+		onIdle()
+	})
+	return w
+}
+
+func (w *idleWatch) stop() {
+	w.timer.Stop()
+}
+
+// reader returns r with every read counted as activity.
+func (w *idleWatch) reader(r io.Reader) io.Reader {
+	return &activityReader{r: r, w: w}
+}
+
+type activityReader struct {
+	r io.Reader
+	w *idleWatch
+}
+
+func (a *activityReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	if n > 0 {
+		a.w.last.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
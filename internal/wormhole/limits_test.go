@@ -0,0 +1,229 @@
+package wormhole
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dialEcho opens a connection through the tunnel at addr and checks one echo,
+// leaving it open.
+func dialEcho(t *testing.T, addr, tag string) net.Conn {
+	t.Helper()
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	c.SetDeadline(time.Now().Add(10 * time.Second))
+	io.WriteString(c, "ping\n")
+	if got, err := bufio.NewReader(c).ReadString('\n'); err != nil || got != tag+"ping\n" {
+		t.Fatalf("echo = %q, %v", got, err)
+	}
+	return c
+}
+
+// waitClosed fails unless the peer closes c within a few seconds.
+func waitClosed(t *testing.T, c net.Conn) {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read = %v, want EOF", err)
+	}
+}
+
+func TestExposeMaxStreams(t *testing.T) {
+	relay := startRelay(t)
+	port := startEcho(t, "raw:")
+	targets, _ := ParseTunnelTargets(port)
+	exposeEv, connectEv := make(chan UIEvent, 64), make(chan UIEvent, 64)
+	bind := freeAddr(t)
+	go ExposeTunnel(relay, "t028", targets, &TunnelOptions{Events: exposeEv, MaxStreams: 1})
+	go ConnectTunnel(relay, "t028", []TunnelBind{{Local: bind, Remote: port}}, &TunnelOptions{Events: connectEv})
+	waitEvent(t, connectEv, EventListen)
+
+	first := dialEcho(t, bind, "raw:")
+	second, err := net.Dial("tcp", bind)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	io.WriteString(second, "ping\n")
+	waitClosed(t, second)
+	for !strings.HasPrefix(waitEvent(t, exposeEv, EventTraffic).Msg, "[DENY]") { // skip the sniffer's events
+	}
+
+	first.Close()
+	waitEvent(t, exposeEv, EventConnClose)
+	echoThrough(t, bind, "raw:", "again")
+}
+
+func TestExposeOneShot(t *testing.T) {
+	relay := startRelay(t)
+	port := startEcho(t, "raw:")
+	targets, _ := ParseTunnelTargets(port)
+	connectEv := make(chan UIEvent, 64)
+	bind := freeAddr(t)
+	done := make(chan error, 1)
+	go func() { done <- ExposeTunnel(relay, "t029", targets, &TunnelOptions{OneShot: true, Reconnect: true}) }()
+	go ConnectTunnel(relay, "t029", []TunnelBind{{Local: bind, Remote: port}}, &TunnelOptions{Events: connectEv})
+	waitEvent(t, connectEv, EventListen)
+
+	echoThrough(t, bind, "raw:", "only")
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("ExposeTunnel() = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("one-shot tunnel still open")
+	}
+}
+
+func TestExposeOneShotSkipsFailedStreams(t *testing.T) {
+	relay := startRelay(t)
+	port := startEcho(t, "raw:")
+	_, dead, _ := net.SplitHostPort(freeAddr(t)) // nothing listens there
+	exposeEv, connectEv := make(chan UIEvent, 64), make(chan UIEvent, 64)
+	deadBind, bind := freeAddr(t), freeAddr(t)
+	done := make(chan error, 1)
+	go func() {
+		done <- ExposeTunnel(relay, "t034", []TunnelTarget{localTarget(port), localTarget(dead)}, &TunnelOptions{Events: exposeEv, OneShot: true})
+	}()
+	go ConnectTunnel(relay, "t034", []TunnelBind{{Local: deadBind, Remote: dead}, {Local: bind, Remote: port}}, &TunnelOptions{Events: connectEv})
+	waitEvent(t, connectEv, EventListen)
+
+	c, err := net.Dial("tcp", deadBind)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	waitClosed(t, c)
+	for !strings.HasPrefix(waitEvent(t, exposeEv, EventTraffic).Msg, "[FAIL] dial") {
+	}
+
+	echoThrough(t, bind, "raw:", "only")
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("ExposeTunnel() = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("one-shot tunnel still open")
+	}
+}
+
+func TestExposeTTL(t *testing.T) {
+	relay := startRelay(t)
+	port := startEcho(t, "raw:")
+	targets, _ := ParseTunnelTargets(port)
+	connectEv := make(chan UIEvent, 64)
+	bind := freeAddr(t)
+	done := make(chan error, 1)
+	go func() { done <- ExposeTunnel(relay, "t030", targets, &TunnelOptions{TTL: 500 * time.Millisecond}) }()
+	go ConnectTunnel(relay, "t030", []TunnelBind{{Local: bind, Remote: port}}, &TunnelOptions{Events: connectEv})
+	waitEvent(t, connectEv, EventListen)
+
+	c := dialEcho(t, bind, "raw:")
+	waitClosed(t, c)
+	if err := <-done; err != nil {
+		t.Errorf("ExposeTunnel() = %v, want nil", err)
+	}
+}
+
+func TestExposeTTLDuringOutage(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln := &dropListener{Listener: inner}
+	relay := acceptRelay(t, NewRelayServer(300*time.Millisecond, nil), ln)
+	port := startEcho(t, "raw:")
+	targets, _ := ParseTunnelTargets(port)
+	exposeEv, connectEv := make(chan UIEvent, 64), make(chan UIEvent, 64)
+	bind := freeAddr(t)
+	done := make(chan error, 1)
+	go func() {
+		done <- ExposeTunnel(relay, "t033", targets, &TunnelOptions{Events: exposeEv, NoDirect: true, Reconnect: true, TTL: time.Second})
+	}()
+	go ConnectTunnel(relay, "t033", []TunnelBind{{Local: bind, Remote: port}}, &TunnelOptions{Events: connectEv, NoDirect: true})
+	waitEvent(t, connectEv, EventListen)
+
+	// The connect side never comes back, so expose is still redialing when
+	// the TTL runs out.
+	echoThrough(t, bind, "raw:", "before")
+	ln.drop()
+	waitEvent(t, exposeEv, EventLinkDown)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("ExposeTunnel() = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expose kept redialing after its TTL")
+	}
+}
+
+func TestConnectStopsWhenExposeEnds(t *testing.T) {
+	relay := startRelay(t)
+	port := startEcho(t, "raw:")
+	targets, _ := ParseTunnelTargets(port)
+	connectEv := make(chan UIEvent, 64)
+	bind := freeAddr(t)
+	go ExposeTunnel(relay, "t035", targets, &TunnelOptions{NoDirect: true, Reconnect: true, TTL: time.Second})
+	done := make(chan error, 1)
+	go func() {
+		done <- ConnectTunnel(relay, "t035", []TunnelBind{{Local: bind, Remote: port}}, &TunnelOptions{Events: connectEv, NoDirect: true, Reconnect: true})
+	}()
+	waitEvent(t, connectEv, EventListen)
+	echoThrough(t, bind, "raw:", "before")
+
+	// Nobody rejoins the room once the TTL ends it, so connect must not redial.
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("ConnectTunnel() = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("connect kept redialing after expose ended the tunnel")
+	}
+	if c, err := net.Dial("tcp", bind); err == nil {
+		c.Close()
+		t.Error("connect still listens after the tunnel ended")
+	}
+}
+
+func TestStreamIdleAndKill(t *testing.T) {
+	relay := startRelay(t)
+	port := startEcho(t, "raw:")
+	targets, _ := ParseTunnelTargets(port)
+	stats := NewTunnelStats()
+	connectEv := make(chan UIEvent, 64)
+	bind := freeAddr(t)
+	go ExposeTunnel(relay, "t031", targets, &TunnelOptions{IdleTimeout: 300 * time.Millisecond})
+	go ConnectTunnel(relay, "t031", []TunnelBind{{Local: bind, Remote: port}}, &TunnelOptions{Events: connectEv, Stats: stats})
+	waitEvent(t, connectEv, EventListen)
+
+	idle := dialEcho(t, bind, "raw:")
+	start := time.Now()
+	waitClosed(t, idle)
+	if d := time.Since(start); d > 3*time.Second {
+		t.Errorf("idle stream closed after %s", d)
+	}
+
+	killed := dialEcho(t, bind, "raw:")
+	active := stats.Sample().Active
+	if len(active) == 0 || !stats.Kill(active[len(active)-1].ID) {
+		t.Fatalf("active streams = %+v, want one to kill", active)
+	}
+	waitClosed(t, killed)
+	for len(stats.Sample().Active) > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats.Kill(active[len(active)-1].ID) {
+		t.Error("Kill() of a closed stream = true")
+	}
+}
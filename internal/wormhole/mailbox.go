@@ -0,0 +1,367 @@
+package wormhole
+
+import (
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/A-Flex-Box/cli/internal/logger"
+	"go.uber.org/zap"
+)
+
+// A mailbox transfer leaves the payload on the relay for a receiver that is not
+// online yet. There is no PAKE: both sides stretch the code with PBKDF2 into a
+// master key, from which they derive the mailbox ID the relay files the blob
+// under and the key that seals it. The relay only ever sees the ID and
+// ciphertext.
+//
+// After the relay header (relayFlagMailbox) and admission status:
+//
+//	store (RoleSender):   C→R uint32 TTL seconds (0 = relay default), blob in
+//	                      chunkWriter chunks; R→C status byte, int64 expiry
+//	                      (Unix seconds) when mailboxOK
+//	fetch (RoleReceiver): R→C status byte, uint64 size + blob when mailboxOK;
+//	                      C→R mailboxOK once the payload is saved, after which
+//	                      the relay deletes the blob
+//
+// The blob is mailboxMagic, a random salt and records (see record.go) sealed
+// with a key derived from the master key and the salt. The plaintext is what a
+// live session carries from the sender: MetaHeader, then the body as the
+// receiver reads it with no resume offset and no compression.
+const (
+	// MailboxCodePrefix marks codes of payloads left in a relay mailbox, so
+	// receive fetches them instead of waiting for a live sender.
+	MailboxCodePrefix = "box-"
+	// mailboxCodeWords is the number of words in a generated mailbox code. The
+	// relay holds the ciphertext and could guess codes offline, unlike live
+	// codes where PAKE allows one guess per attempt, so these are longer.
+	mailboxCodeWords = 6
+	mailboxKDFSalt   = "wormhole mailbox v1"
+	// mailboxIDLen is the length in bytes of the mailbox ID, sent hex-encoded as the room ID.
+	mailboxIDLen   = 16
+	mailboxMagic   = "WHMB\x01"
+	mailboxSaltLen = 16
+)
+
+// mailboxKDFIterations slows down offline guessing of mailbox codes. A
+// variable so tests can derive keys quickly.
+var mailboxKDFIterations = 600_000
+
+// Mailbox status bytes, sent by the relay after the admission status.
+const (
+	mailboxOK    = 0
+	mailboxEmpty = 1
+	mailboxFull  = 2
+	mailboxError = 3
+)
+
+// GenerateMailboxCode creates a code like "box-acid-...-zebra" with
+// mailboxCodeWords words. Unlike live codes it has no channel: the relay files
+// the payload under an ID derived from the whole code.
+func GenerateMailboxCode() string {
+	words := make([]string, mailboxCodeWords)
+	for i := range words {
+		words[i] = codeWords[randInt(int64(len(codeWords)))]
+	}
+	return MailboxCodePrefix + strings.Join(words, "-")
+}
+
+// IsMailboxCode reports whether code names a mailbox payload.
+func IsMailboxCode(code string) bool {
+	return strings.HasPrefix(code, MailboxCodePrefix)
+}
+
+// MailboxCode returns code with MailboxCodePrefix, adding it to custom codes.
+func MailboxCode(code string) string {
+	if IsMailboxCode(code) {
+		return code
+	}
+	return MailboxCodePrefix + code
+}
+
+// mailboxKeys derives the mailbox ID and the master key from a code.
+func mailboxKeys(code string) (id string, master []byte, err error) {
+	master, err = pbkdf2.Key(sha256.New, code, []byte(mailboxKDFSalt), mailboxKDFIterations, 32)
+	if err != nil {
+		return "", nil, err
+	}
+	raw, err := hkdf.Key(sha256.New, master, nil, "wormhole mailbox id", mailboxIDLen)
+	if err != nil {
+		return "", nil, err
+	}
+	return hex.EncodeToString(raw), master, nil
+}
+
+// mailboxAEAD returns the cipher for the blob with the given salt. A fresh salt
+// per blob keeps the record nonces from repeating under one key when a code is
+// reused.
+func mailboxAEAD(master, salt []byte) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, master, salt, "wormhole mailbox blob", 32)
+	if err != nil {
+		return nil, err
+	}
+	return newGCM(key, "wormhole aes-256-gcm mailbox")
+}
+
+// mailboxStatusError maps a mailbox status byte to an error, nil for mailboxOK.
+func mailboxStatusError(st byte) error {
+	switch st {
+	case mailboxOK:
+		return nil
+	case mailboxEmpty:
+		return ErrMailboxEmpty
+	case mailboxFull:
+		return ErrMailboxFull
+	case mailboxError:
+		return errors.New("wormhole: relay could not store or read the mailbox payload")
+	default:
+		return fmt.Errorf("wormhole: unknown mailbox status %d", st)
+	}
+}
+
+// readMailboxStatus reads one mailbox status byte from conn.
+func readMailboxStatus(conn net.Conn) error {
+	var st [1]byte
+	if _, err := io.ReadFull(conn, st[:]); err != nil {
+		return fmt.Errorf("wormhole: relay closed the mailbox connection: %w", err)
+	}
+	return mailboxStatusError(st[0])
+}
+
+// depositFailure explains a failed upload: the relay sends a status before it
+// hangs up (e.g. quota exceeded), which says more than the broken write.
+func depositFailure(conn net.Conn, err error) error {
+	conn.SetReadDeadline(time.Now().Add(closeTimeout))
+	var st [1]byte
+	if _, rErr := io.ReadFull(conn, st[:]); rErr == nil && st[0] != mailboxOK {
+		return mailboxStatusError(st[0])
+	}
+	return err
+}
+
+// deposit encrypts h and what body writes after it and stores the result in
+// the relay mailbox for code. It returns when the relay will delete the blob.
+func deposit(relayAddr, code string, h *MetaHeader, opts *TransferOptions, body func(w io.Writer) error) (time.Time, error) {
+	logger.Info("wormhole.deposit start", logger.Context("params", map[string]any{
+		"relay_addr": MaskRelayAddr(relayAddr), "type": int(h.Type), "name": h.Name, "size": h.Size, "ttl_sec": opts.mailboxTTL().Seconds(),
+	})...)
+	id, master, err := mailboxKeys(code)
+	if err != nil {
+		return time.Time{}, err
+	}
+	salt := make([]byte, mailboxSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return time.Time{}, err
+	}
+	aead, err := mailboxAEAD(master, salt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	conn, err := dialRelay(relayAddr, id, RoleSender, true)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer conn.Close()
+	opts.path(PathInfo{Remote: MaskRelayAddr(relayAddr)})
+
+	ttl := opts.mailboxTTL()
+	if err := binary.Write(conn, binary.BigEndian, uint32(min(ttl/time.Second, 1<<32-1))); err != nil {
+		return time.Time{}, err
+	}
+	up := &chunkWriter{w: conn}
+	if _, err := up.Write(append([]byte(mailboxMagic), salt...)); err != nil {
+		return time.Time{}, depositFailure(conn, err)
+	}
+	rec := newRecordWriter(&limitedWriter{w: up, lim: opts.limiter().writer()}, aead)
+	err = WriteMetaHeader(rec, h)
+	if err == nil {
+		err = body(rec)
+	}
+	if err == nil {
+		err = rec.closeWrite()
+	}
+	if err == nil {
+		err = up.Close()
+	}
+	if err != nil {
+		logger.Warn("wormhole.deposit upload failed", zap.Error(err))
+		return time.Time{}, depositFailure(conn, err)
+	}
+	if err := readMailboxStatus(conn); err != nil {
+		return time.Time{}, err
+	}
+	var expiry int64
+	if err := binary.Read(conn, binary.BigEndian, &expiry); err != nil {
+		return time.Time{}, err
+	}
+	logger.Info("wormhole.deposit done", logger.Context("result", map[string]any{
+		"mailbox_id": id, "name": h.Name, "expires": time.Unix(expiry, 0),
+	})...)
+	return time.Unix(expiry, 0), nil
+}
+
+// MailboxFile leaves a regular file in the relay mailbox for code, to be
+// fetched later with ReceiveMailbox. It returns when the relay will delete it.
+// opts may be nil.
+func MailboxFile(relayAddr, code, filePath string, opts *TransferOptions) (time.Time, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return time.Time{}, fmt.Errorf("wormhole: %s is not a regular file", filePath)
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+	h := &MetaHeader{
+		Type: TypeFile,
+		Name: filepath.Base(filePath),
+		Size: info.Size(),
+		Mode: uint32(info.Mode().Perm()),
+	}
+	return deposit(relayAddr, code, h, opts, func(w io.Writer) error {
+		hasher := sha256.New()
+		opts.progress(0, h.Size)
+		if err := copyBody(w, io.TeeReader(f, hasher), h.Size, func(done int64) {
+			opts.progress(done, h.Size)
+		}); err != nil {
+			return err
+		}
+		return WriteTrailer(w, &Trailer{Hash: hex.EncodeToString(hasher.Sum(nil))})
+	})
+}
+
+// MailboxFiles leaves files and directories in the relay mailbox as one
+// TypeDir bundle, as SendFiles sends them. opts may be nil.
+func MailboxFiles(relayAddr, code string, paths []string, opts *TransferOptions) (time.Time, error) {
+	sources, total, err := buildBundle(paths)
+	if err != nil {
+		return time.Time{}, err
+	}
+	h := &MetaHeader{Type: TypeDir, Name: bundleName(paths), Size: total}
+	return deposit(relayAddr, code, h, opts, func(w io.Writer) error {
+		return sendBundle(w, sources, total, opts)
+	})
+}
+
+// MailboxText leaves text in the relay mailbox for code. opts may be nil.
+func MailboxText(relayAddr, code, text string, opts *TransferOptions) (time.Time, error) {
+	h := &MetaHeader{Type: TypeText, Size: int64(len(text))}
+	return deposit(relayAddr, code, h, opts, func(w io.Writer) error {
+		_, err := io.WriteString(w, text)
+		return err
+	})
+}
+
+// MailboxStream leaves r, read until io.EOF, in the relay mailbox as a
+// TypeStream payload named name. opts may be nil.
+func MailboxStream(relayAddr, code string, r io.Reader, name string, opts *TransferOptions) (time.Time, error) {
+	h := &MetaHeader{Type: TypeStream, Name: name, Size: -1}
+	return deposit(relayAddr, code, h, opts, func(w io.Writer) error {
+		hasher := sha256.New()
+		cw := &chunkWriter{w: w}
+		buf := GetBuffer()
+		defer PutBuffer(buf)
+		var done int64
+		opts.progress(0, -1)
+		for {
+			n, rErr := r.Read(buf)
+			if n > 0 {
+				hasher.Write(buf[:n])
+				if _, err := cw.Write(buf[:n]); err != nil {
+					return err
+				}
+				done += int64(n)
+				opts.progress(done, -1)
+			}
+			if rErr == io.EOF {
+				break
+			}
+			if rErr != nil {
+				return rErr
+			}
+		}
+		if err := cw.Close(); err != nil {
+			return err
+		}
+		return WriteTrailer(w, &Trailer{Hash: hex.EncodeToString(hasher.Sum(nil))})
+	})
+}
+
+// ReceiveMailbox fetches and decrypts the payload left in the relay mailbox for
+// code, saving or returning it as Receive does. The relay deletes the blob only
+// once it has been saved, so a failed or declined fetch can be retried until
+// it expires. opts may be nil.
+func ReceiveMailbox(relayAddr, code, outDir string, opts *TransferOptions, textResult *string, result *ReceiveResult) error {
+	logger.Info("wormhole.ReceiveMailbox start", logger.Context("params", map[string]any{
+		"relay_addr": MaskRelayAddr(relayAddr), "out_dir": outDir,
+	})...)
+	id, master, err := mailboxKeys(code)
+	if err != nil {
+		return err
+	}
+	conn, err := dialRelay(relayAddr, id, RoleReceiver, true)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := readMailboxStatus(conn); err != nil {
+		return err
+	}
+	var size uint64
+	if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+		return err
+	}
+	opts.path(PathInfo{Remote: MaskRelayAddr(relayAddr)})
+
+	blob := io.LimitReader(&limitedReader{r: conn, lim: opts.limiter().reader()}, int64(size))
+	head := make([]byte, len(mailboxMagic)+mailboxSaltLen)
+	if _, err := io.ReadFull(blob, head); err != nil {
+		return ErrTruncated
+	}
+	if string(head[:len(mailboxMagic)]) != mailboxMagic {
+		return errors.New("wormhole: mailbox blob has an unknown format")
+	}
+	aead, err := mailboxAEAD(master, head[len(mailboxMagic):])
+	if err != nil {
+		return err
+	}
+	// Answers meant for a live sender (offer acks) have nobody to go to.
+	rr := newRecordReader(blob, aead)
+	if err := receivePayload(struct {
+		io.Reader
+		io.Writer
+	}{rr, io.Discard}, outDir, opts, textResult, result); err != nil {
+		logger.Warn("wormhole.ReceiveMailbox failed", zap.Error(err), zap.String("mailbox_id", id))
+		return err
+	}
+	// Only the final record proves nothing was cut off after the payload.
+	if n, err := io.Copy(io.Discard, rr); err != nil {
+		return err
+	} else if n > 0 {
+		return fmt.Errorf("wormhole: %d unexpected bytes after the mailbox payload", n)
+	}
+	if _, err := conn.Write([]byte{mailboxOK}); err != nil {
+		return err
+	}
+	// The relay hangs up once the blob is deleted; wait for that briefly.
+	conn.SetReadDeadline(time.Now().Add(closeTimeout))
+	io.Copy(io.Discard, conn)
+	logger.Info("wormhole.ReceiveMailbox done", logger.Context("result", map[string]any{"mailbox_id": id, "size": size})...)
+	return nil
+}
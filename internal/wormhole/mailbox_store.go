@@ -0,0 +1,250 @@
+package wormhole
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/A-Flex-Box/cli/internal/logger"
+)
+
+const (
+	// DefaultMailboxTTL is how long a relay keeps mailbox blobs when
+	// RelayOptions.MailboxTTL is zero.
+	DefaultMailboxTTL = 72 * time.Hour
+	mailboxBlobExt    = ".blob"
+)
+
+// mailboxStore keeps mailbox blobs as files named after their mailbox ID, with
+// the expiry as modification time so it survives relay restarts. Expired blobs
+// are swept before every store and fetch. The store never sees keys: blobs are
+// opaque bytes to it (see mailbox.go).
+type mailboxStore struct {
+	dir   string
+	ttl   time.Duration // longest a blob is kept, and the default
+	quota int64         // total bytes of stored and uploading blobs; 0 = none
+
+	mu      sync.Mutex
+	used    int64 // bytes of stored blobs
+	pending int64 // bytes of uploads in progress
+}
+
+func newMailboxStore(dir string, ttl time.Duration, quota int64) *mailboxStore {
+	if ttl <= 0 {
+		ttl = DefaultMailboxTTL
+	}
+	return &mailboxStore{dir: dir, ttl: ttl, quota: quota}
+}
+
+// validMailboxID reports whether id is a hex mailbox ID, so it is safe as a file name.
+func validMailboxID(id string) bool {
+	raw, err := hex.DecodeString(id)
+	return err == nil && len(raw) == mailboxIDLen && hex.EncodeToString(raw) == id
+}
+
+func (b *mailboxStore) path(id string) string {
+	return filepath.Join(b.dir, id+mailboxBlobExt)
+}
+
+// sweep deletes expired blobs and recounts the space the others use.
+func (b *mailboxStore) sweep() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	var used int64
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), mailboxBlobExt) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if !info.ModTime().After(now) {
+			os.Remove(filepath.Join(b.dir, e.Name()))
+			continue
+		}
+		used += info.Size()
+	}
+	b.used = used
+}
+
+// reserve accounts for n more uploaded bytes, or reports that the quota is spent.
+func (b *mailboxStore) reserve(n int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.quota > 0 && b.used+b.pending+n > b.quota {
+		return false
+	}
+	b.pending += n
+	return true
+}
+
+// put stores the blob uploaded on conn under id, replacing an older one, and
+// answers with the status and expiry. It returns the blob size.
+func (b *mailboxStore) put(conn net.Conn, id string) (int64, error) {
+	var secs uint32
+	if err := binary.Read(conn, binary.BigEndian, &secs); err != nil {
+		return 0, err
+	}
+	ttl := time.Duration(secs) * time.Second
+	if ttl <= 0 || ttl > b.ttl {
+		ttl = b.ttl
+	}
+	b.sweep()
+
+	tmp, err := os.CreateTemp(b.dir, id+".*.tmp")
+	if err != nil {
+		conn.Write([]byte{mailboxError})
+		return 0, err
+	}
+	var size int64
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		b.mu.Lock()
+		b.pending -= size
+		b.mu.Unlock()
+	}()
+	src := &chunkReader{r: conn}
+	buf := GetBuffer()
+	defer PutBuffer(buf)
+	for {
+		n, rErr := src.Read(buf)
+		if n > 0 {
+			if !b.reserve(int64(n)) {
+				conn.Write([]byte{mailboxFull})
+				return size, ErrMailboxFull
+			}
+			size += int64(n)
+			if _, err := tmp.Write(buf[:n]); err != nil {
+				conn.Write([]byte{mailboxError})
+				return size, err
+			}
+		}
+		if rErr == io.EOF {
+			break
+		}
+		if rErr != nil {
+			return size, rErr
+		}
+	}
+	expiry := time.Now().Add(ttl)
+	if err := tmp.Close(); err == nil {
+		err = os.Chtimes(tmp.Name(), time.Now(), expiry)
+	}
+	if err == nil {
+		err = b.commit(tmp.Name(), id, size)
+	}
+	if err != nil {
+		conn.Write([]byte{mailboxError})
+		return size, err
+	}
+	reply := binary.BigEndian.AppendUint64([]byte{mailboxOK}, uint64(expiry.Unix()))
+	_, err = conn.Write(reply)
+	return size, err
+}
+
+// commit moves a finished upload into place, counting it as stored.
+func (b *mailboxStore) commit(tmp, id string, size int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var old int64
+	if info, err := os.Stat(b.path(id)); err == nil {
+		old = info.Size()
+	}
+	if err := os.Rename(tmp, b.path(id)); err != nil {
+		return err
+	}
+	b.used += size - old
+	return nil
+}
+
+// get sends the blob stored under id and deletes it once the receiver
+// acknowledges it. It returns the blob size.
+func (b *mailboxStore) get(conn net.Conn, id string) (int64, error) {
+	b.sweep()
+	f, err := os.Open(b.path(id))
+	if err != nil {
+		conn.Write([]byte{mailboxEmpty})
+		return 0, ErrMailboxEmpty
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		conn.Write([]byte{mailboxError})
+		return 0, err
+	}
+	hdr := binary.BigEndian.AppendUint64([]byte{mailboxOK}, uint64(info.Size()))
+	if _, err := conn.Write(hdr); err != nil {
+		return 0, err
+	}
+	if _, err := io.CopyN(conn, f, info.Size()); err != nil {
+		return 0, err
+	}
+	// Receivers acknowledge only what they decrypted and saved; until then the
+	// blob stays for another try.
+	var ack [1]byte
+	if _, err := io.ReadFull(conn, ack[:]); err != nil || ack[0] != mailboxOK {
+		return info.Size(), errors.New("wormhole: mailbox fetch not acknowledged")
+	}
+	b.remove(id, info)
+	return info.Size(), nil
+}
+
+// remove deletes the blob under id if it is still the one described by info,
+// not a newer upload.
+func (b *mailboxStore) remove(id string, info os.FileInfo) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cur, err := os.Stat(b.path(id))
+	if err != nil || !os.SameFile(cur, info) {
+		return
+	}
+	if os.Remove(b.path(id)) == nil {
+		b.used -= info.Size()
+	}
+}
+
+// handleMailbox serves a connection whose header asked for the mailbox:
+// senders store a blob, receivers fetch one.
+func (r *RelayServer) handleMailbox(conn net.Conn, h *relayHeader) {
+	params := map[string]any{"remote": conn.RemoteAddr().String(), "mailbox_id": h.roomID, "role": h.role}
+	if r.mailbox == nil {
+		reply(conn, h, relayStatusNoMailbox)
+		logger.Warn("relay.handleMailbox mailbox disabled", logger.Context("params", params)...)
+		return
+	}
+	if !validMailboxID(h.roomID) || (h.role != RoleSender && h.role != RoleReceiver) {
+		r.metrics.headerErrors.Add(1)
+		logger.Warn("relay.handleMailbox invalid request", logger.Context("params", params)...)
+		return
+	}
+	reply(conn, h, relayStatusOK)
+
+	var size int64
+	var err error
+	if h.role == RoleSender {
+		size, err = r.mailbox.put(conn, h.roomID)
+	} else {
+		size, err = r.mailbox.get(conn, h.roomID)
+	}
+	params["size"] = size
+	if err != nil {
+		params["error"] = err.Error()
+		logger.Warn("relay.handleMailbox failed", logger.Context("params", params)...)
+		return
+	}
+	logger.Info("relay.handleMailbox done", logger.Context("params", params)...)
+}
@@ -0,0 +1,76 @@
+package wormhole
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func init() {
+	mailboxKDFIterations = 1000
+}
+
+func TestMailboxRoundTrip(t *testing.T) {
+	boxDir := t.TempDir()
+	relay := serveRelay(t, NewRelayServer(5*time.Second, &RelayOptions{MailboxDir: boxDir, MailboxTTL: time.Hour}))
+	srcDir, outDir := t.TempDir(), t.TempDir()
+	data := writeRandomFile(t, srcDir, "data.bin", 100*1024)
+	code := GenerateMailboxCode()
+
+	expiry, err := MailboxFile(relay, code, filepath.Join(srcDir, "data.bin"), &TransferOptions{MailboxTTL: 48 * time.Hour})
+	if err != nil {
+		t.Fatalf("MailboxFile() error = %v", err)
+	}
+	if d := time.Until(expiry); d <= 59*time.Minute || d > time.Hour {
+		t.Errorf("expiry in %s, want the relay's 1h cap", d)
+	}
+	blobs, _ := filepath.Glob(filepath.Join(boxDir, "*"+mailboxBlobExt))
+	if len(blobs) != 1 {
+		t.Fatalf("stored blobs = %v, want one", blobs)
+	}
+	// The relay holds ciphertext only: neither the data nor the name shows.
+	stored, _ := os.ReadFile(blobs[0])
+	if bytes.Contains(stored, data[:64]) || bytes.Contains(stored, []byte("data.bin")) {
+		t.Error("stored blob contains plaintext")
+	}
+
+	if err := ReceiveMailbox(relay, "box-wrong-code", outDir, nil, nil, nil); !errors.Is(err, ErrMailboxEmpty) {
+		t.Errorf("ReceiveMailbox() with wrong code error = %v, want ErrMailboxEmpty", err)
+	}
+	var result ReceiveResult
+	if err := ReceiveMailbox(relay, code, outDir, nil, nil, &result); err != nil {
+		t.Fatalf("ReceiveMailbox() error = %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(outDir, "data.bin"))
+	if err != nil || !bytes.Equal(got, data) || result.FilePath == "" {
+		t.Fatalf("received %d bytes (%v), result %+v", len(got), err, result)
+	}
+	if blobs, _ := filepath.Glob(filepath.Join(boxDir, "*"+mailboxBlobExt)); len(blobs) != 0 {
+		t.Errorf("blobs left after fetch = %v", blobs)
+	}
+	if err := ReceiveMailbox(relay, code, outDir, nil, nil, nil); !errors.Is(err, ErrMailboxEmpty) {
+		t.Errorf("second ReceiveMailbox() error = %v, want ErrMailboxEmpty", err)
+	}
+}
+
+func TestMailboxTextAndLimits(t *testing.T) {
+	if _, err := MailboxText(startRelay(t), "box-x", "hi", nil); !errors.Is(err, ErrRelayNoMailbox) {
+		t.Errorf("MailboxText() without mailbox error = %v, want ErrRelayNoMailbox", err)
+	}
+
+	relay := serveRelay(t, NewRelayServer(5*time.Second, &RelayOptions{MailboxDir: t.TempDir(), MailboxQuota: 4096}))
+	code := MailboxCode("t032")
+	if _, err := MailboxText(relay, code, string(make([]byte, 8192)), nil); !errors.Is(err, ErrMailboxFull) {
+		t.Errorf("MailboxText() over quota error = %v, want ErrMailboxFull", err)
+	}
+	if _, err := MailboxText(relay, code, "hello later", nil); err != nil {
+		t.Fatalf("MailboxText() error = %v", err)
+	}
+	var text string
+	if err := ReceiveMailbox(relay, code, t.TempDir(), nil, &text, nil); err != nil || text != "hello later" {
+		t.Errorf("ReceiveMailbox() = %q, %v", text, err)
+	}
+}
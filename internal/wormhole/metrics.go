@@ -0,0 +1,184 @@
+package wormhole
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// relayMetrics holds RelayServer counters. Gauges (rooms waiting, active pipes)
+// are derived from the server maps at scrape time.
+type relayMetrics struct {
+	connsAccepted      atomic.Int64
+	headerErrors       atomic.Int64
+	pairsMatched       atomic.Int64
+	pairingTimeouts    atomic.Int64
+	sameRoleRejections atomic.Int64
+	authFailures       atomic.Int64
+	limitRejections    atomic.Int64
+	bytesSenderToRecv  atomic.Int64
+	bytesRecvToSender  atomic.Int64
+}
+
+// pipeInfo tracks one live pipe for the status page.
+type pipeInfo struct {
+	roomID   string
+	sender   string
+	receiver string
+	started  time.Time
+	toRecv   atomic.Int64
+	toSender atomic.Int64
+}
+
+// countingWriter adds every written byte to one or more counters.
+type countingWriter struct {
+	w        io.Writer
+	counters []*atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	for _, ctr := range c.counters {
+		ctr.Add(int64(n))
+	}
+	return n, err
+}
+
+// RelayRoomStatus describes a room with one peer waiting.
+type RelayRoomStatus struct {
+	RoomID     string  `json:"room_id"`
+	Role       string  `json:"role"`
+	Remote     string  `json:"remote"`
+	WaitingSec float64 `json:"waiting_sec"`
+}
+
+// RelayPipeStatus describes an active pipe between a matched pair.
+type RelayPipeStatus struct {
+	RoomID          string  `json:"room_id"`
+	Sender          string  `json:"sender"`
+	Receiver        string  `json:"receiver"`
+	DurationSec     float64 `json:"duration_sec"`
+	BytesToReceiver int64   `json:"bytes_to_receiver"`
+	BytesToSender   int64   `json:"bytes_to_sender"`
+}
+
+// RelayStatus is a point-in-time snapshot of a RelayServer.
+type RelayStatus struct {
+	UptimeSec          float64           `json:"uptime_sec"`
+	TimeoutSec         float64           `json:"timeout_sec"`
+	ConnsAccepted      int64             `json:"conns_accepted"`
+	HeaderErrors       int64             `json:"header_errors"`
+	PairsMatched       int64             `json:"pairs_matched"`
+	PairingTimeouts    int64             `json:"pairing_timeouts"`
+	SameRoleRejections int64             `json:"same_role_rejections"`
+	AuthFailures       int64             `json:"auth_failures"`
+	LimitRejections    int64             `json:"limit_rejections"`
+	BytesToReceiver    int64             `json:"bytes_sender_to_receiver"`
+	BytesToSender      int64             `json:"bytes_receiver_to_sender"`
+	Rooms              []RelayRoomStatus `json:"rooms"`
+	Pipes              []RelayPipeStatus `json:"pipes"`
+}
+
+func roleName(role int) string {
+	switch role {
+	case RoleSender:
+		return "sender"
+	case RoleReceiver:
+		return "receiver"
+	default:
+		return fmt.Sprintf("unknown(%d)", role)
+	}
+}
+
+// Status returns a snapshot of counters, waiting rooms and active pipes.
+func (r *RelayServer) Status() RelayStatus {
+	now := time.Now()
+	st := RelayStatus{
+		UptimeSec:          now.Sub(r.started).Seconds(),
+		TimeoutSec:         r.timeout.Seconds(),
+		ConnsAccepted:      r.metrics.connsAccepted.Load(),
+		HeaderErrors:       r.metrics.headerErrors.Load(),
+		PairsMatched:       r.metrics.pairsMatched.Load(),
+		PairingTimeouts:    r.metrics.pairingTimeouts.Load(),
+		SameRoleRejections: r.metrics.sameRoleRejections.Load(),
+		AuthFailures:       r.metrics.authFailures.Load(),
+		LimitRejections:    r.metrics.limitRejections.Load(),
+		BytesToReceiver:    r.metrics.bytesSenderToRecv.Load(),
+		BytesToSender:      r.metrics.bytesRecvToSender.Load(),
+		Rooms:              []RelayRoomStatus{},
+		Pipes:              []RelayPipeStatus{},
+	}
+
+	r.mu.Lock()
+	for id, slot := range r.rooms {
+		st.Rooms = append(st.Rooms, RelayRoomStatus{
+			RoomID:     id,
+			Role:       roleName(slot.waitingRole),
+			Remote:     slot.remote,
+			WaitingSec: now.Sub(slot.since).Seconds(),
+		})
+	}
+	for _, p := range r.pipes {
+		st.Pipes = append(st.Pipes, RelayPipeStatus{
+			RoomID:          p.roomID,
+			Sender:          p.sender,
+			Receiver:        p.receiver,
+			DurationSec:     now.Sub(p.started).Seconds(),
+			BytesToReceiver: p.toRecv.Load(),
+			BytesToSender:   p.toSender.Load(),
+		})
+	}
+	r.mu.Unlock()
+
+	sort.Slice(st.Rooms, func(i, j int) bool { return st.Rooms[i].WaitingSec > st.Rooms[j].WaitingSec })
+	sort.Slice(st.Pipes, func(i, j int) bool { return st.Pipes[i].DurationSec > st.Pipes[j].DurationSec })
+	return st
+}
+
+// AdminHandler serves Prometheus metrics at /metrics and a JSON status page at /status.
+// It exposes room IDs and peer addresses, so bind it to a trusted interface.
+func (r *RelayServer) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writePrometheus(w, r.Status())
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(r.Status())
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/" {
+			http.NotFound(w, req)
+			return
+		}
+		http.Redirect(w, req, "/status", http.StatusFound)
+	})
+	return mux
+}
+
+// writePrometheus renders st in the Prometheus text exposition format.
+func writePrometheus(w io.Writer, st RelayStatus) {
+	metric := func(name, typ, help string, value any, labels string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s%s %v\n", name, help, name, typ, name, labels, value)
+	}
+	metric("wormhole_relay_uptime_seconds", "gauge", "Seconds since the relay started.", st.UptimeSec, "")
+	metric("wormhole_relay_rooms_waiting", "gauge", "Rooms with one peer waiting for its partner.", len(st.Rooms), "")
+	metric("wormhole_relay_active_pipes", "gauge", "Matched pairs currently being piped.", len(st.Pipes), "")
+	metric("wormhole_relay_connections_total", "counter", "Connections accepted by the relay.", st.ConnsAccepted, "")
+	metric("wormhole_relay_header_errors_total", "counter", "Connections dropped before a valid relay header.", st.HeaderErrors, "")
+	metric("wormhole_relay_pairs_matched_total", "counter", "Sender/receiver pairs matched.", st.PairsMatched, "")
+	metric("wormhole_relay_pairing_timeouts_total", "counter", "Waiting peers dropped after the pairing timeout.", st.PairingTimeouts, "")
+	metric("wormhole_relay_same_role_rejections_total", "counter", "Connections rejected because the room already had a peer of the same role.", st.SameRoleRejections, "")
+	metric("wormhole_relay_auth_failures_total", "counter", "Connections rejected for a missing or wrong access token.", st.AuthFailures, "")
+	metric("wormhole_relay_limit_rejections_total", "counter", "Connections rejected by the per-IP room or active pipe limit.", st.LimitRejections, "")
+	fmt.Fprintf(w, "# HELP wormhole_relay_bytes_total Bytes relayed per direction.\n# TYPE wormhole_relay_bytes_total counter\n")
+	fmt.Fprintf(w, "wormhole_relay_bytes_total{direction=\"sender_to_receiver\"} %d\n", st.BytesToReceiver)
+	fmt.Fprintf(w, "wormhole_relay_bytes_total{direction=\"receiver_to_sender\"} %d\n", st.BytesToSender)
+}
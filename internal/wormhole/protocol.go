@@ -3,6 +3,7 @@ package wormhole
 import (
 	"encoding/binary"
 	"encoding/json"
+	"fmt"
 	"io"
 )
 
@@ -10,8 +11,272 @@ import (
 type MetaHeader struct {
 	Type PayloadType `json:"t"`
 	Name string     `json:"n,omitempty"` // Filename (for files)
-	Size int64      `json:"s"`           // Total bytes
+	Size int64      `json:"s"`           // Total bytes (-1 for TypeStream: unknown)
 	Mode uint32     `json:"m,omitempty"` // File permission (e.g. 0644)
+	Hash string     `json:"h,omitempty"` // Hex SHA-256 of the content (files; keys resume state)
+	Comp string     `json:"c,omitempty"` // Offered body compression (CompGzip), used only if acked
+}
+
+// ManifestEntry describes one entry of a TypeDir payload. Paths are relative,
+// slash-separated and always start with the top-level name chosen by the sender.
+type ManifestEntry struct {
+	Path string `json:"p"`
+	Kind string `json:"k"`           // EntryFile, EntryDir or EntrySymlink
+	Size int64  `json:"s,omitempty"` // Body bytes (files only)
+	Mode uint32 `json:"m,omitempty"` // Permission bits
+	Link string `json:"l,omitempty"` // Symlink target (symlinks only)
+}
+
+// Manifest follows the AckHeader of a TypeDir payload. File bodies are then
+// streamed back to back in manifest order.
+type Manifest struct {
+	Entries []ManifestEntry `json:"e"`
+}
+
+// Trailer follows every file body and carries the SHA-256 the sender computed
+// while reading it, so the receiver can verify before moving the file into place.
+type Trailer struct {
+	Hash string `json:"h"` // Hex SHA-256 of the whole file
+}
+
+// AckHeader is the receiver's reply to a MetaHeader.
+type AckHeader struct {
+	Offset int64  `json:"o"`           // Bytes the receiver already has; sender seeks here
+	Reject bool   `json:"r,omitempty"` // Receiver declined the offer; nothing follows
+	Reason string `json:"y,omitempty"` // Why, shown in the sender's error
+	Comp   string `json:"c,omitempty"` // Accepted compression; empty means raw body
+}
+
+// Hello is the first frame after verification over the relay; each peer lists
+// what it speaks so both agree before anything else is sent. The receiver sends
+// first. Keys must not collide with Candidates or PathDecision, which is what a
+// peer from before the exchange sends in this slot (see negotiateHello).
+type Hello struct {
+	Version    int           `json:"v"`            // Highest protocol version spoken
+	MinVersion int           `json:"mv"`           // Oldest protocol version still accepted
+	Software   string        `json:"sw,omitempty"` // Build that sent it, for error messages
+	Ciphers    []string      `json:"ci,omitempty"` // Record ciphers, preferred first
+	Comp       []string      `json:"co,omitempty"` // Body compressions it can decode
+	Types      []PayloadType `json:"ty,omitempty"` // Payload types it can receive
+	Modes      []int         `json:"mo,omitempty"` // Session modes (ModeFile, ModeTunnel)
+}
+
+// TunnelPorts follows ModeTunnel from protocol v3. It lists the ports the expose
+// side forwards; each yamux stream then starts with a uint16 port header naming
+// one of them. A port identifies a target, which need not be on localhost.
+// With Socks, a stream may instead use port 0 followed by a destination the
+// expose side dials on the connect side's behalf (see socksHeader).
+type TunnelPorts struct {
+	Ports []string `json:"p"`
+	Names []string `json:"n,omitempty"` // What each port forwards to, for display (TunnelTarget.String)
+	Socks bool     `json:"s,omitempty"` // Expose side accepts SOCKS streams
+}
+
+// Candidates is the receiver's offer of a direct connection, sent right after
+// Upgrade over the relay. Addrs is empty when the receiver opts out.
+type Candidates struct {
+	Addrs  []string `json:"a,omitempty"` // host:port the receiver listens on
+	Secret string   `json:"k,omitempty"` // One-time PAKE password for the direct connection
+}
+
+// PathDecision is the sender's answer to Candidates.
+type PathDecision struct {
+	Direct bool   `json:"d"`           // true: continue on the direct connection
+	Addr   string `json:"a,omitempty"` // Candidate that won the race
+}
+
+// relayHeaderV2 starts a variable-length relay header. Legacy clients send a
+// fixed 4-byte room ID whose first byte is printable, so the marker is unambiguous.
+const relayHeaderV2 = 0xFE
+
+// Relay header flags.
+const (
+	relayFlagToken   = 0x01 // uint8 token length + token precede the room ID
+	relayFlagMailbox = 0x02 // Store or fetch a mailbox blob instead of pairing (see mailbox.go)
+)
+
+// Relay admission status, sent as one byte to v2 clients right after the header.
+const (
+	relayStatusOK           = 0
+	relayStatusUnauthorized = 1
+	relayStatusRoomLimit    = 2
+	relayStatusBusy         = 3
+	relayStatusNoMailbox    = 4
+	relayStatusRoleTaken    = 5 // a peer with the same role is already waiting in the room
+)
+
+// relayHeader is a parsed relay header.
+type relayHeader struct {
+	roomID  string
+	role    int
+	legacy  bool // 4-byte room ID + role, no flags, no status reply
+	mailbox bool // relayFlagMailbox: role says store (sender) or fetch (receiver)
+}
+
+// writeRelayHeader writes marker, flags, optional uint8 token length + token,
+// uint8 room ID length, room ID and role byte. With mailbox the relay stores or
+// fetches a mailbox blob for the room instead of pairing.
+func writeRelayHeader(w io.Writer, token, roomID string, role int, mailbox bool) error {
+	if len(roomID) == 0 || len(roomID) > maxRoomIDLen {
+		return fmt.Errorf("wormhole: room ID length %d out of range 1-%d", len(roomID), maxRoomIDLen)
+	}
+	if len(token) > 255 {
+		return fmt.Errorf("wormhole: relay token longer than 255 bytes")
+	}
+	var flags byte
+	if token != "" {
+		flags |= relayFlagToken
+	}
+	if mailbox {
+		flags |= relayFlagMailbox
+	}
+	buf := make([]byte, 0, 5+len(token)+len(roomID))
+	buf = append(buf, relayHeaderV2, flags)
+	if token != "" {
+		buf = append(buf, byte(len(token)))
+		buf = append(buf, token...)
+	}
+	buf = append(buf, byte(len(roomID)))
+	buf = append(buf, roomID...)
+	buf = append(buf, byte(role))
+	_, err := w.Write(buf)
+	return err
+}
+
+// readRelayHeader reads a v2 relay header, or a legacy 4-byte room ID + role.
+// authorize is called with the token (empty for legacy or tokenless clients)
+// before the room ID is read; a non-nil error aborts the read.
+func readRelayHeader(r io.Reader, authorize func(token string) error) (*relayHeader, error) {
+	var first [1]byte
+	if _, err := io.ReadFull(r, first[:]); err != nil {
+		return nil, err
+	}
+	if first[0] != relayHeaderV2 {
+		if err := authorize(""); err != nil {
+			return &relayHeader{legacy: true}, err
+		}
+		rest := make([]byte, 4)
+		if _, err := io.ReadFull(r, rest); err != nil {
+			return nil, err
+		}
+		return &relayHeader{roomID: string(first[0]) + string(rest[:3]), role: int(rest[3]), legacy: true}, nil
+	}
+	var flags [1]byte
+	if _, err := io.ReadFull(r, flags[:]); err != nil {
+		return nil, err
+	}
+	token := ""
+	if flags[0]&relayFlagToken != 0 {
+		t, err := readShortString(r)
+		if err != nil {
+			return nil, err
+		}
+		token = t
+	}
+	if err := authorize(token); err != nil {
+		return &relayHeader{}, err
+	}
+	roomID, err := readShortString(r)
+	if err != nil {
+		return nil, err
+	}
+	if roomID == "" || len(roomID) > maxRoomIDLen {
+		return nil, fmt.Errorf("wormhole: room ID length %d out of range", len(roomID))
+	}
+	var role [1]byte
+	if _, err := io.ReadFull(r, role[:]); err != nil {
+		return nil, err
+	}
+	return &relayHeader{roomID: roomID, role: int(role[0]), mailbox: flags[0]&relayFlagMailbox != 0}, nil
+}
+
+// readShortString reads a uint8 length followed by that many bytes.
+func readShortString(r io.Reader) (string, error) {
+	var n [1]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return "", err
+	}
+	buf := make([]byte, n[0])
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// maxStreamChunk bounds one TypeStream chunk so a bad length cannot force a huge read.
+const maxStreamChunk = 1024 * 1024
+
+// chunkWriter frames a TypeStream body: each Write becomes one chunk of
+// uint32(len) + data, and Close sends the empty chunk that marks end-of-stream.
+// The sender's Trailer follows the marker.
+type chunkWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (c *chunkWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > maxStreamChunk {
+			n = maxStreamChunk
+		}
+		// Length and data in one Write so each chunk fills whole records.
+		c.buf = binary.BigEndian.AppendUint32(c.buf[:0], uint32(n))
+		c.buf = append(c.buf, p[:n]...)
+		if _, err := c.w.Write(c.buf); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Close writes the end-of-stream marker. It does not close the underlying writer.
+func (c *chunkWriter) Close() error {
+	return sendFrame(c.w, nil)
+}
+
+// chunkReader reads a TypeStream body written by chunkWriter. It returns io.EOF
+// at the end-of-stream marker; a connection that ends before the marker is
+// io.ErrUnexpectedEOF, so truncated streams are never mistaken for complete ones.
+type chunkReader struct {
+	r      io.Reader
+	remain uint32
+	done   bool
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if c.done {
+		return 0, io.EOF
+	}
+	if c.remain == 0 {
+		var ln uint32
+		if err := binary.Read(c.r, binary.BigEndian, &ln); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		if ln == 0 {
+			c.done = true
+			return 0, io.EOF
+		}
+		if ln > maxStreamChunk {
+			return 0, ErrInvalidFrameSize
+		}
+		c.remain = ln
+	}
+	if uint32(len(p)) > c.remain {
+		p = p[:c.remain]
+	}
+	n, err := c.r.Read(p)
+	c.remain -= uint32(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
 }
 
 // FrameTransportImpl implements FrameTransport over io.ReadWriter.
@@ -85,3 +350,157 @@ func ReadMetaHeader(r io.Reader) (*MetaHeader, error) {
 	}
 	return &h, nil
 }
+
+// WriteAckHeader writes a length-prefixed JSON-encoded AckHeader.
+func WriteAckHeader(w io.Writer, a *AckHeader) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return sendFrame(w, data)
+}
+
+// ReadAckHeader reads a length-prefixed JSON-encoded AckHeader.
+func ReadAckHeader(r io.Reader) (*AckHeader, error) {
+	data, err := readFrame(r)
+	if err != nil {
+		return nil, err
+	}
+	var a AckHeader
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// WriteManifest writes a length-prefixed JSON-encoded Manifest.
+func WriteManifest(w io.Writer, m *Manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return sendFrame(w, data)
+}
+
+// ReadManifest reads a length-prefixed JSON-encoded Manifest.
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	data, err := readFrame(r)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// WriteTrailer writes a length-prefixed JSON-encoded Trailer.
+func WriteTrailer(w io.Writer, t *Trailer) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return sendFrame(w, data)
+}
+
+// ReadTrailer reads a length-prefixed JSON-encoded Trailer.
+func ReadTrailer(r io.Reader) (*Trailer, error) {
+	data, err := readFrame(r)
+	if err != nil {
+		return nil, err
+	}
+	var t Trailer
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// WriteCandidates writes a length-prefixed JSON-encoded Candidates.
+func WriteCandidates(w io.Writer, c *Candidates) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return sendFrame(w, data)
+}
+
+// ReadCandidates reads a length-prefixed JSON-encoded Candidates.
+func ReadCandidates(r io.Reader) (*Candidates, error) {
+	data, err := readFrame(r)
+	if err != nil {
+		return nil, err
+	}
+	var c Candidates
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// WritePathDecision writes a length-prefixed JSON-encoded PathDecision.
+func WritePathDecision(w io.Writer, d *PathDecision) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return sendFrame(w, data)
+}
+
+// ReadPathDecision reads a length-prefixed JSON-encoded PathDecision.
+func ReadPathDecision(r io.Reader) (*PathDecision, error) {
+	data, err := readFrame(r)
+	if err != nil {
+		return nil, err
+	}
+	var d PathDecision
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// WriteHello writes a length-prefixed JSON-encoded Hello.
+func WriteHello(w io.Writer, h *Hello) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	return sendFrame(w, data)
+}
+
+// ReadHello reads a length-prefixed JSON-encoded Hello.
+func ReadHello(r io.Reader) (*Hello, error) {
+	data, err := readFrame(r)
+	if err != nil {
+		return nil, err
+	}
+	var h Hello
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// WriteTunnelPorts writes a length-prefixed JSON-encoded TunnelPorts.
+func WriteTunnelPorts(w io.Writer, t *TunnelPorts) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return sendFrame(w, data)
+}
+
+// ReadTunnelPorts reads a length-prefixed JSON-encoded TunnelPorts.
+func ReadTunnelPorts(r io.Reader) (*TunnelPorts, error) {
+	data, err := readFrame(r)
+	if err != nil {
+		return nil, err
+	}
+	var t TunnelPorts
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
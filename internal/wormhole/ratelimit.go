@@ -0,0 +1,286 @@
+package wormhole
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket measured in bytes. A nil *rateLimiter, or one
+// with a zero rate, is unlimited.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter allowing bytesPerSec with a burst of the
+// larger of one record and 1/10 second of traffic, or nil when bytesPerSec <= 0.
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	l := &rateLimiter{}
+	l.setRate(bytesPerSec)
+	return l
+}
+
+// setRate changes the rate; tokens earned so far at the old rate are kept.
+// bytesPerSec <= 0 lifts the limit.
+func (l *rateLimiter) setRate(bytesPerSec int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if l.last.IsZero() {
+		l.tokens = -1 // filled to the new burst below
+	} else if l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+	}
+	l.last = now
+	if bytesPerSec < 0 {
+		bytesPerSec = 0
+	}
+	l.rate = float64(bytesPerSec)
+	l.burst = l.rate / 10
+	if l.burst < maxRecordPlain {
+		l.burst = maxRecordPlain
+	}
+	if l.tokens < 0 || l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+// chunk returns the largest write the limiter will admit at once, or 0 when unlimited.
+func (l *rateLimiter) chunk() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return 0
+	}
+	return int(l.burst)
+}
+
+// wait blocks until n bytes (n <= burst) may pass.
+func (l *rateLimiter) wait(n int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// limitedWriter throttles writes through a rateLimiter.
+type limitedWriter struct {
+	w   io.Writer
+	lim *rateLimiter
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	return writeLimited(lw.w, lw.lim, p)
+}
+
+// limitedReader throttles reads through a rateLimiter, holding the caller back
+// after each read until the bytes fit the rate.
+type limitedReader struct {
+	r   io.Reader
+	lim *rateLimiter
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		lr.lim.wait(n)
+	}
+	return n, err
+}
+
+// writeLimited writes p to w in pieces the limiter admits. The limit is re-read
+// per piece, so a rate changed mid-write applies at once.
+func writeLimited(w io.Writer, lim *rateLimiter, p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		max := lim.chunk()
+		if max <= 0 {
+			m, err := w.Write(p)
+			return n + m, err
+		}
+		c := p
+		if len(c) > max {
+			c = c[:max]
+		}
+		lim.wait(len(c))
+		m, err := w.Write(c)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		p = p[m:]
+	}
+	return n, nil
+}
+
+// Limiter caps a session's bandwidth, each direction on its own bucket, and
+// can be changed while the session runs. A zero rate or a nil *Limiter is unlimited.
+type Limiter struct {
+	in, out rateLimiter
+}
+
+// NewLimiter returns a Limiter at bytesPerSec (0 = unlimited).
+func NewLimiter(bytesPerSec int64) *Limiter {
+	l := &Limiter{}
+	l.SetRate(bytesPerSec)
+	return l
+}
+
+// SetRate changes the limit for both directions; 0 lifts it.
+func (l *Limiter) SetRate(bytesPerSec int64) {
+	if l == nil {
+		return
+	}
+	l.in.setRate(bytesPerSec)
+	l.out.setRate(bytesPerSec)
+}
+
+// Rate returns the current limit in bytes per second (0 = unlimited).
+func (l *Limiter) Rate() int64 {
+	if l == nil {
+		return 0
+	}
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	return int64(l.out.rate)
+}
+
+// reader returns the bucket for received bytes, nil when l is nil.
+func (l *Limiter) reader() *rateLimiter {
+	if l == nil {
+		return nil
+	}
+	return &l.in
+}
+
+// writer returns the bucket for sent bytes, nil when l is nil.
+func (l *Limiter) writer() *rateLimiter {
+	if l == nil {
+		return nil
+	}
+	return &l.out
+}
+
+// rateSteps are the limits the TUI's +/- keys move between; above the last is unlimited.
+var rateSteps = []int64{64e3, 128e3, 256e3, 512e3, 1e6, 2e6, 5e6, 10e6, 20e6, 50e6, 100e6}
+
+// StepRate returns the next limit above (up) or below bps on a fixed ladder.
+// Stepping up from the top lifts the limit; stepping down from unlimited
+// starts at the top. 0 means unlimited.
+func StepRate(bps int64, up bool) int64 {
+	if up {
+		if bps <= 0 {
+			return 0
+		}
+		for _, r := range rateSteps {
+			if r > bps {
+				return r
+			}
+		}
+		return 0
+	}
+	if bps <= 0 {
+		return rateSteps[len(rateSteps)-1]
+	}
+	for i := len(rateSteps) - 1; i >= 0; i-- {
+		if rateSteps[i] < bps {
+			return rateSteps[i]
+		}
+	}
+	return rateSteps[0]
+}
+
+// ParseRate parses a bandwidth like "5MB/s", "512KB", "1.5MiB/s" or "0" into
+// bytes per second, with the units of ParseSize. An empty string or 0 means
+// unlimited.
+func ParseRate(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	bps, err := ParseSize(strings.TrimSuffix(strings.TrimSuffix(s, "/s"), "ps"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q: %w", s, err)
+	}
+	return bps, nil
+}
+
+// ParseSize parses a size like "5GB", "512KB", "1.5MiB" or "0" into bytes.
+// Decimal units (KB, MB, GB) are powers of 1000, binary units (KiB, MiB, GiB)
+// powers of 1024. An empty string is 0.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	num, unit := s, ""
+	if i >= 0 {
+		num, unit = s[:i], strings.TrimSpace(s[i:])
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	mult, ok := sizeUnits[strings.ToLower(unit)]
+	if !ok {
+		return 0, fmt.Errorf("invalid size unit %q (use B, KB, MB, GB, KiB, MiB or GiB)", unit)
+	}
+	return int64(v * mult), nil
+}
+
+var sizeUnits = map[string]float64{
+	"": 1, "b": 1,
+	"k": 1e3, "kb": 1e3, "m": 1e6, "mb": 1e6, "g": 1e9, "gb": 1e9,
+	"kib": 1 << 10, "mib": 1 << 20, "gib": 1 << 30,
+}
+
+// FormatRate renders bytes per second the way ParseRate accepts it.
+func FormatRate(bps int64) string {
+	if bps <= 0 {
+		return "unlimited"
+	}
+	return FormatSize(bps) + "/s"
+}
+
+// FormatSize renders a byte count the way ParseSize accepts it.
+func FormatSize(n int64) string {
+	switch {
+	case n >= 1e9:
+		return strconv.FormatFloat(float64(n)/1e9, 'f', -1, 64) + "GB"
+	case n >= 1e6:
+		return strconv.FormatFloat(float64(n)/1e6, 'f', -1, 64) + "MB"
+	case n >= 1e3:
+		return strconv.FormatFloat(float64(n)/1e3, 'f', -1, 64) + "KB"
+	}
+	return strconv.FormatInt(n, 10) + "B"
+}
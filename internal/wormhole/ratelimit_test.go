@@ -0,0 +1,128 @@
+package wormhole
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	for in, want := range map[string]int64{
+		"":         0,
+		"0":        0,
+		"5MB/s":    5_000_000,
+		"512KB":    512_000,
+		"1.5MiB/s": 1_572_864,
+		"100":      100,
+		"2 gb/s":   2_000_000_000,
+	} {
+		got, err := ParseRate(in)
+		if err != nil || got != want {
+			t.Errorf("ParseRate(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"fast", "5XB/s", "-1MB"} {
+		if _, err := ParseRate(in); err == nil {
+			t.Errorf("ParseRate(%q) should fail", in)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for in, want := range map[string]int64{
+		"":       0,
+		"0":      0,
+		"5GB":    5_000_000_000,
+		"512 kb": 512_000,
+		"1.5MiB": 1_572_864,
+		"100":    100,
+	} {
+		got, err := ParseSize(in)
+		if err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"big", "5GB/s", "5MBps", "-1KB"} {
+		if _, err := ParseSize(in); err == nil {
+			t.Errorf("ParseSize(%q) should fail", in)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for n, want := range map[int64]string{0: "0B", 999: "999B", 1500: "1.5KB", 5_000_000_000: "5GB"} {
+		if got := FormatSize(n); got != want {
+			t.Errorf("FormatSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+	if got := FormatRate(2_000_000); got != "2MB/s" {
+		t.Errorf("FormatRate() = %q, want 2MB/s", got)
+	}
+}
+
+func TestLimitedWriter(t *testing.T) {
+	const rate = 200_000
+	var buf bytes.Buffer
+	w := &limitedWriter{w: &buf, lim: newRateLimiter(rate)}
+	start := time.Now()
+	// The first burst (1/10 s) is free; the rest must take about 0.4s.
+	if _, err := w.Write(make([]byte, rate/2)); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 300*time.Millisecond {
+		t.Errorf("wrote %d bytes at %d B/s in %v, want >= 300ms", rate/2, rate, d)
+	}
+	if buf.Len() != rate/2 {
+		t.Errorf("wrote %d bytes, want %d", buf.Len(), rate/2)
+	}
+}
+
+func TestLimiterSetRate(t *testing.T) {
+	l := NewLimiter(0)
+	var buf bytes.Buffer
+	start := time.Now()
+	if _, err := writeLimited(&buf, l.writer(), make([]byte, 1_000_000)); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("unlimited write took %v", d)
+	}
+
+	// Lowering the limit at runtime throttles the next write.
+	l.SetRate(200_000)
+	if l.Rate() != 200_000 {
+		t.Fatalf("Rate() = %d", l.Rate())
+	}
+	start = time.Now()
+	writeLimited(&buf, l.writer(), make([]byte, 100_000))
+	if d := time.Since(start); d < 300*time.Millisecond {
+		t.Errorf("wrote 100KB at 200KB/s in %v, want >= 300ms", d)
+	}
+
+	var nilLimiter *Limiter
+	nilLimiter.SetRate(5)
+	if nilLimiter.Rate() != 0 || nilLimiter.writer() != nil {
+		t.Error("nil Limiter should be unlimited")
+	}
+}
+
+func TestStepRate(t *testing.T) {
+	tests := []struct {
+		bps  int64
+		up   bool
+		want int64
+	}{
+		{5e6, true, 10e6},
+		{5e6, false, 2e6},
+		{5.5e6, false, 5e6},
+		{0, false, 100e6},
+		{100e6, true, 0},
+		{0, true, 0},
+		{64e3, false, 64e3},
+	}
+	for _, tt := range tests {
+		if got := StepRate(tt.bps, tt.up); got != tt.want {
+			t.Errorf("StepRate(%d, %v) = %d, want %d", tt.bps, tt.up, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package wormhole
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/A-Flex-Box/cli/internal/logger"
+	"github.com/hashicorp/yamux"
+)
+
+const (
+	// reconnectMinBackoff and reconnectMaxBackoff bound the wait between failed
+	// attempts to reopen a tunnel; it doubles after each failure.
+	reconnectMinBackoff = time.Second
+	reconnectMaxBackoff = 30 * time.Second
+	// reconnectQueueTimeout is how long a local connection accepted while the
+	// tunnel is down waits for it to come back before being closed.
+	reconnectQueueTimeout = 30 * time.Second
+	// rejoinLabel is the HKDF info for the tunnel rejoin secret.
+	rejoinLabel = "wormhole tunnel rejoin"
+	// tunnelEndedTimeout bounds how long an ending expose side waits for the
+	// connect side to acknowledge the end of the tunnel.
+	tunnelEndedTimeout = 2 * time.Second
+)
+
+// tunnelEnded is the one byte an expose side writes on a stream it opens
+// itself, the only one it ever does, to say it closes the session for good.
+const tunnelEnded = 0x01
+
+// errTunnelDown is returned to local connections that waited too long for a
+// reconnecting tunnel.
+var errTunnelDown = errors.New("wormhole: tunnel is down, reconnect did not finish in time")
+
+// errRedialStopped is returned by redialTunnel when its stop channel closes.
+var errRedialStopped = errors.New("wormhole: tunnel ended while reconnecting")
+
+// deriveRejoin derives the PAKE password for reconnecting a tunnel from the
+// first session's key. Only the two peers of that session know it, so whoever
+// else learns the code cannot take over the tunnel while it reconnects, and the
+// SAS confirmed for the first session still stands.
+func deriveRejoin(key []byte) string {
+	b, err := hkdf.Key(sha256.New, key, nil, rejoinLabel, 16)
+	if err != nil {
+		panic("wormhole: hkdf failed: " + err.Error()) // only on an invalid length
+	}
+	return hex.EncodeToString(b)
+}
+
+// redialTunnel reopens a dropped tunnel session in the same relay room, using
+// rejoin as the PAKE password, and runs setup (the mode byte) on it. It retries
+// with exponential backoff until it succeeds, the peer is incompatible or stop
+// closes (errRedialStopped; stop may be nil), and reports progress as
+// EventReconnecting and EventReconnected.
+func redialTunnel(relayAddr, code, rejoin string, isSender bool, opts *TunnelOptions, stop <-chan struct{}, setup func(*SecureConn) error) (*SecureConn, error) {
+	ev := evChan(opts)
+	down := time.Now()
+	backoff := reconnectMinBackoff
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-stop:
+			return nil, errRedialStopped
+		default:
+		}
+		sendEvent(ev, UIEvent{Type: EventReconnecting, Msg: fmt.Sprintf("Reconnecting (attempt %d)", attempt), Attempt: attempt, Since: down})
+		secure, path, err := openSession(relayAddr, code, rejoin, isSender, opts.NoDirect)
+		if err == nil {
+			if err = setup(secure); err != nil {
+				secure.Close()
+			}
+		}
+		if err == nil {
+			select {
+			case <-stop:
+				// Stopped while the attempt was waiting for the peer.
+				secure.Close()
+				return nil, errRedialStopped
+			default:
+			}
+			secure.SetLimiter(opts.Limit)
+			sendEvent(ev, UIEvent{Type: EventPath, Msg: path.String(), Path: &path})
+			sendEvent(ev, UIEvent{Type: EventReconnected, Msg: "Reconnected after " + time.Since(down).Round(time.Second).String(), Attempt: attempt, Since: down})
+			logger.Info("tunnel.redial reconnected", logger.Context("result", map[string]any{
+				"attempt": attempt, "downtime_sec": time.Since(down).Seconds(), "path": path.String(),
+			})...)
+			return secure, nil
+		}
+		if errors.Is(err, ErrIncompatiblePeer) {
+			return nil, err
+		}
+		logger.Warn("tunnel.redial attempt failed", logger.Context("params", map[string]any{
+			"attempt": attempt, "error": err.Error(), "retry_in_sec": backoff.Seconds(),
+		})...)
+		sendEvent(ev, UIEvent{Type: EventTraffic, Msg: fmt.Sprintf("[FAIL] reconnect attempt %d: %v (retrying in %s)", attempt, err, backoff)})
+		select {
+		case <-stop:
+			return nil, errRedialStopped
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, reconnectMaxBackoff)
+	}
+}
+
+// sendTunnelEnded tells the connect side that the tunnel ends with this
+// session, so it does not redial, and waits for it to close the stream.
+func sendTunnelEnded(session *yamux.Session) {
+	stream, err := session.Open()
+	if err != nil {
+		return
+	}
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(tunnelEndedTimeout))
+	if _, err := stream.Write([]byte{tunnelEnded}); err == nil {
+		io.Copy(io.Discard, stream)
+	}
+}
+
+// watchTunnelEnded returns a channel closed when the expose side says the
+// tunnel ends with session (see sendTunnelEnded).
+func watchTunnelEnded(session *yamux.Session) <-chan struct{} {
+	ended := make(chan struct{})
+	go func() {
+		stream, err := session.Accept()
+		if err != nil {
+			return
+		}
+		defer stream.Close()
+		b := make([]byte, 1)
+		if _, err := io.ReadFull(stream, b); err == nil && b[0] == tunnelEnded {
+			close(ended)
+		}
+	}()
+	return ended
+}
+
+// tunnelDown reports a dropped session before redialTunnel starts.
+func tunnelDown(ev chan<- UIEvent, cause error) {
+	msg := "Tunnel down: session closed"
+	if cause != nil {
+		msg = "Tunnel down: " + cause.Error()
+	}
+	logger.Warn("tunnel.down", logger.Context("params", map[string]any{"reason": msg})...)
+	sendEvent(ev, UIEvent{Type: EventLinkDown, Msg: msg, Since: time.Now()})
+}
+
+// tunnelLink holds the connect side's current yamux session. It is nil while
+// the tunnel reconnects, and up is closed whenever a session is set.
+type tunnelLink struct {
+	mu      sync.Mutex
+	session *yamux.Session
+	up      chan struct{}
+}
+
+func newTunnelLink() *tunnelLink {
+	return &tunnelLink{up: make(chan struct{})}
+}
+
+// set installs the current session, or nil when it dropped.
+func (l *tunnelLink) set(s *yamux.Session) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	was := l.session != nil
+	l.session = s
+	switch {
+	case s != nil && !was:
+		close(l.up)
+	case s == nil && was:
+		l.up = make(chan struct{})
+	}
+}
+
+func (l *tunnelLink) current() (*yamux.Session, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.session, l.up
+}
+
+// open opens a stream on the current session. While the link is down it waits
+// up to wait for a new session; with wait 0 it fails right away.
+func (l *tunnelLink) open(wait time.Duration) (net.Conn, error) {
+	s, up := l.current()
+	if s == nil {
+		select {
+		case <-up:
+		case <-time.After(wait):
+			return nil, errTunnelDown
+		}
+		if s, _ = l.current(); s == nil {
+			return nil, errTunnelDown
+		}
+	}
+	return s.Open()
+}
@@ -0,0 +1,195 @@
+package wormhole
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+const (
+	// maxRecordPlain caps the plaintext carried by one record.
+	maxRecordPlain = 16 * 1024
+	// recordHeaderLen is the uint32 header: final flag (top bit) + ciphertext length.
+	recordHeaderLen = 4
+	recordFinalFlag = 1 << 31
+)
+
+// GCMRecordCipher implements RecordCipher with AES-256-GCM. Each direction has
+// its own HKDF-derived key; nonces are implicit 64-bit record counters.
+type GCMRecordCipher struct{}
+
+// NewAEADs derives direction keys from the session key. Sender's seal matches receiver's open.
+func (c *GCMRecordCipher) NewAEADs(key []byte, isSender bool) (seal, open cipher.AEAD, err error) {
+	s2r, err := newGCM(key, "wormhole aes-256-gcm sender->receiver")
+	if err != nil {
+		return nil, nil, err
+	}
+	r2s, err := newGCM(key, "wormhole aes-256-gcm receiver->sender")
+	if err != nil {
+		return nil, nil, err
+	}
+	if isSender {
+		return s2r, r2s, nil
+	}
+	return r2s, s2r, nil
+}
+
+func newGCM(key []byte, label string) (cipher.AEAD, error) {
+	k, err := hkdf.Key(sha256.New, key, nil, label, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func recordNonce(aead cipher.AEAD, seq uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], seq)
+	return nonce
+}
+
+// recordWriter seals writes into records. Safe for concurrent use.
+type recordWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	aead   cipher.AEAD
+	seq    uint64
+	buf    []byte
+	closed bool
+}
+
+func newRecordWriter(w io.Writer, aead cipher.AEAD) *recordWriter {
+	return &recordWriter{w: w, aead: aead}
+}
+
+// Write splits p into records of at most maxRecordPlain bytes.
+func (rw *recordWriter) Write(p []byte) (int, error) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.closed {
+		return 0, io.ErrClosedPipe
+	}
+	n := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > maxRecordPlain {
+			chunk = chunk[:maxRecordPlain]
+		}
+		if err := rw.writeRecord(chunk, false); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// closeWrite sends the final record so the peer can tell a clean end from truncation.
+func (rw *recordWriter) closeWrite() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.closed {
+		return nil
+	}
+	rw.closed = true
+	return rw.writeRecord(nil, true)
+}
+
+func (rw *recordWriter) writeRecord(plain []byte, final bool) error {
+	ctLen := len(plain) + rw.aead.Overhead()
+	need := recordHeaderLen + ctLen
+	if cap(rw.buf) < need {
+		rw.buf = make([]byte, need, recordHeaderLen+maxRecordPlain+rw.aead.Overhead())
+	}
+	out := rw.buf[:recordHeaderLen]
+	hdr := uint32(ctLen)
+	if final {
+		hdr |= recordFinalFlag
+	}
+	binary.BigEndian.PutUint32(out, hdr)
+	// The header is authenticated as additional data so length and final flag cannot be forged.
+	out = rw.aead.Seal(out, recordNonce(rw.aead, rw.seq), plain, out[:recordHeaderLen])
+	rw.seq++
+	_, err := rw.w.Write(out)
+	return err
+}
+
+// recordReader opens records and serves their plaintext.
+type recordReader struct {
+	r     io.Reader
+	aead  cipher.AEAD
+	seq   uint64
+	plain []byte
+	pos   int
+	hdr   [recordHeaderLen]byte
+	ct    []byte
+	err   error
+}
+
+func newRecordReader(r io.Reader, aead cipher.AEAD) *recordReader {
+	return &recordReader{r: r, aead: aead}
+}
+
+// Read returns decrypted data. A missing final record is reported as ErrTruncated,
+// a failed authentication tag as ErrRecordAuth.
+func (rr *recordReader) Read(p []byte) (int, error) {
+	for rr.pos >= len(rr.plain) {
+		if rr.err != nil {
+			return 0, rr.err
+		}
+		rr.err = rr.next()
+	}
+	n := copy(p, rr.plain[rr.pos:])
+	rr.pos += n
+	return n, nil
+}
+
+func (rr *recordReader) next() error {
+	if _, err := io.ReadFull(rr.r, rr.hdr[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrTruncated
+		}
+		return err
+	}
+	hdr := binary.BigEndian.Uint32(rr.hdr[:])
+	ctLen := int(hdr &^ recordFinalFlag)
+	if ctLen < rr.aead.Overhead() || ctLen > maxRecordPlain+rr.aead.Overhead() {
+		return ErrRecordAuth
+	}
+	if cap(rr.ct) < ctLen {
+		rr.ct = make([]byte, maxRecordPlain+rr.aead.Overhead())
+	}
+	ct := rr.ct[:ctLen]
+	if _, err := io.ReadFull(rr.r, ct); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrTruncated
+		}
+		return err
+	}
+	return rr.open(rr.hdr[:], ct)
+}
+
+// open authenticates one record given its header and ciphertext.
+func (rr *recordReader) open(hdr, ct []byte) error {
+	plain, err := rr.aead.Open(rr.plain[:0], recordNonce(rr.aead, rr.seq), ct, hdr)
+	if err != nil {
+		return ErrRecordAuth
+	}
+	rr.seq++
+	rr.plain, rr.pos = plain, 0
+	if binary.BigEndian.Uint32(hdr)&recordFinalFlag != 0 {
+		if len(plain) != 0 {
+			return ErrRecordAuth
+		}
+		return io.EOF
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package wormhole
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// partSuffix marks an incomplete download kept for resuming.
+const partSuffix = ".part"
+
+// hashFile returns the hex SHA-256 of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	buf := GetBuffer()
+	defer PutBuffer(buf)
+	if _, err := io.CopyBuffer(h, f, buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyTrailer reads the sender's Trailer and compares it with the locally computed hash.
+func verifyTrailer(r io.Reader, h hash.Hash) (string, error) {
+	t, err := ReadTrailer(r)
+	if err != nil {
+		return "", err
+	}
+	got := hex.EncodeToString(h.Sum(nil))
+	if got != t.Hash {
+		return got, fmt.Errorf("%w (expected %s, got %s)", ErrHashMismatch, t.Hash, got)
+	}
+	return got, nil
+}
+
+// partPath returns the partial-download path for a file offer. It is keyed by
+// name, size and content hash so a changed source never resumes onto stale bytes.
+func partPath(outDir string, h *MetaHeader) string {
+	key := h.Hash
+	if len(key) > 16 {
+		key = key[:16]
+	}
+	name := filepath.Base(h.Name)
+	if h.Name == "" {
+		name = "received"
+	}
+	return filepath.Join(outDir, "."+name+"."+key+"."+strconv.FormatInt(h.Size, 10)+partSuffix)
+}
+
+// resumeOffset returns how many bytes of the offer are already on disk at part.
+// A part file larger than the offer is treated as corrupt and restarted.
+func resumeOffset(part string, size int64) int64 {
+	info, err := os.Stat(part)
+	if err != nil || !info.Mode().IsRegular() {
+		return 0
+	}
+	if info.Size() > size {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,65 @@
+package wormhole
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// sasLabel is the HKDF info for the short authentication string, distinct from
+// the record keys so showing it reveals nothing about them.
+const sasLabel = "wormhole short authentication string"
+
+// SAS is a short authentication string derived from the PAKE session key. Both
+// peers see the same one only if nobody relayed the handshake as a middle man,
+// so reading it aloud confirms the peer even when the code was guessable.
+type SAS [5]byte
+
+// sasEmoji are 64 emoji that are distinct at a glance and render on common
+// terminals without variation selectors. Each emoji carries 6 bits.
+var sasEmoji = [64]string{
+	"🐶", "🐱", "🦁", "🐴", "🦄", "🐷", "🐘", "🐰", "🐼", "🐔", "🐧", "🐢", "🐟", "🐙", "🦋", "🌷",
+	"🌳", "🌵", "🍄", "🌍", "🌙", "🔥", "🍌", "🍎", "🍓", "🌽", "🍕", "🎂", "😀", "🤖", "🎩", "👓",
+	"🔧", "🎅", "👍", "⌛", "⏰", "🎁", "💡", "📕", "📎", "🔒", "🔑", "🔨", "🏁", "🚂", "🚲", "🚀",
+	"🏆", "⚽", "🎸", "🎺", "🔔", "⚓", "🎧", "📁", "📌", "🍩", "🐝", "🌈", "🍒", "🦊", "🐳", "🍉",
+}
+
+// deriveSAS derives the SAS from a session key.
+func deriveSAS(key []byte) SAS {
+	var s SAS
+	b, err := hkdf.Key(sha256.New, key, nil, sasLabel, len(s))
+	if err != nil {
+		panic("wormhole: hkdf failed: " + err.Error()) // only on an invalid length
+	}
+	copy(s[:], b)
+	return s
+}
+
+// Emoji renders the SAS as 5 emoji (30 bits).
+func (s SAS) Emoji() string {
+	// Take 6-bit groups from the 40 bits, most significant first.
+	var v uint64
+	for _, b := range s {
+		v = v<<8 | uint64(b)
+	}
+	out := make([]string, 5)
+	for i := range out {
+		out[i] = sasEmoji[(v>>(34-6*i))&0x3f]
+	}
+	return strings.Join(out, " ")
+}
+
+// Words renders the SAS as 4 words from the pairing-code wordlist (32 bits).
+func (s SAS) Words() string {
+	out := make([]string, 4)
+	for i := range out {
+		out[i] = codeWords[s[i]]
+	}
+	return strings.Join(out, " ")
+}
+
+// String renders both forms, e.g. "🐶 🔥 ⚓ 🍕 🦊 (acorn delta ...)".
+func (s SAS) String() string {
+	return fmt.Sprintf("%s (%s)", s.Emoji(), s.Words())
+}
@@ -0,0 +1,76 @@
+package wormhole
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSASRendering(t *testing.T) {
+	seen := map[string]bool{}
+	for _, e := range sasEmoji {
+		if e == "" || seen[e] {
+			t.Fatalf("sasEmoji has empty or duplicate entry %q", e)
+		}
+		seen[e] = true
+	}
+
+	key := bytes.Repeat([]byte{0x42}, 32)
+	a, b := deriveSAS(key), deriveSAS(key)
+	if a != b {
+		t.Fatalf("deriveSAS is not deterministic: %v != %v", a, b)
+	}
+	if other := deriveSAS(bytes.Repeat([]byte{0x43}, 32)); other == a {
+		t.Errorf("different keys gave the same SAS %v", a)
+	}
+	if n := len(strings.Fields(a.Emoji())); n != 5 {
+		t.Errorf("Emoji() has %d symbols, want 5", n)
+	}
+	if n := len(strings.Fields(a.Words())); n != 4 {
+		t.Errorf("Words() has %d words, want 4", n)
+	}
+}
+
+func TestTransferSAS(t *testing.T) {
+	relay := startRelay(t)
+
+	var sentSAS, recvSAS SAS
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- SendText(relay, "t019", "hello", &TransferOptions{
+			OnSAS:      func(s SAS) { sentSAS = s },
+			VerifySAS:  true,
+			ConfirmSAS: func(SAS) bool { return true },
+		})
+	}()
+	var result ReceiveResult
+	if err := Receive(relay, "t019", t.TempDir(), &TransferOptions{OnSAS: func(s SAS) { recvSAS = s }}, nil, &result); err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("SendText() error = %v", err)
+	}
+	if sentSAS == (SAS{}) || sentSAS != recvSAS {
+		t.Errorf("SAS sent %v, received %v; want equal and non-zero", sentSAS, recvSAS)
+	}
+
+	// A mismatch reported by the sender aborts before anything is sent.
+	go func() {
+		errCh <- SendText(relay, "t020", "hello", &TransferOptions{
+			VerifySAS:  true,
+			ConfirmSAS: func(SAS) bool { return false },
+		})
+	}()
+	if err := Receive(relay, "t020", t.TempDir(), nil, nil, nil); err == nil {
+		t.Error("Receive() succeeded after the sender rejected the SAS")
+	}
+	if err := <-errCh; !errors.Is(err, ErrSASRejected) {
+		t.Errorf("SendText() error = %v, want ErrSASRejected", err)
+	}
+
+	// --verify without a way to confirm refuses rather than skipping the check.
+	if err := confirmSAS(sentSAS, true, nil); !errors.Is(err, ErrSASRejected) {
+		t.Errorf("confirmSAS(nil) error = %v, want ErrSASRejected", err)
+	}
+}
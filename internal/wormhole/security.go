@@ -71,7 +71,8 @@ func RunHandshake(conn io.ReadWriter, password string, isSender bool) ([]byte, e
 }
 
 // AESCTRCipher implements StreamCipher using AES-256-CTR.
-// IV is derived from SHA256 variants of the session key.
+// IV is derived from SHA256 variants of the session key. It is the pre-AEAD
+// wire format and is kept only so Upgrade can recognize and refuse legacy peers.
 type AESCTRCipher struct{}
 
 // NewDuplex returns enc/dec streams. Sender's enc and receiver's dec must use the same IV
@@ -98,5 +99,8 @@ func (c *AESCTRCipher) NewDuplex(key []byte, isSender bool) (encStream, decStrea
 // DefaultHandshaker is the default PAKE handshaker (injectable for tests).
 var DefaultHandshaker Handshaker = NewPAKEHandshaker()
 
-// DefaultStreamCipher is the default cipher (injectable for tests).
-var DefaultStreamCipher StreamCipher = &AESCTRCipher{}
+// DefaultRecordCipher is the default record cipher (injectable for tests).
+var DefaultRecordCipher RecordCipher = &GCMRecordCipher{}
+
+// legacyCipher decrypts the verification frame of pre-AEAD peers.
+var legacyCipher StreamCipher = &AESCTRCipher{}
@@ -1,37 +1,118 @@
 package wormhole
 
 import (
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/A-Flex-Box/cli/internal/logger"
 )
 
+// relayHeaderTimeout bounds how long a new connection may take to send its
+// token and header; until then it counts against no limit.
+const relayHeaderTimeout = 10 * time.Second
+
 // roomSlot holds a waiting connection by role (0=sender, 1=receiver).
 // Relay only pairs opposite roles to avoid PAKE "can't have its own role".
 type roomSlot struct {
 	waitingRole int
 	ch          chan net.Conn
+	remote      string
+	ip          string
+	since       time.Time
+}
+
+// RelayOptions holds optional access control and limits for a RelayServer.
+// Zero values mean open access and no limits.
+type RelayOptions struct {
+	Tokens        []string      // Accepted access tokens; empty = no token required
+	MaxRoomsPerIP int           // Concurrent waiting rooms per source IP
+	MaxPipes      int           // Concurrent active pipes
+	PerPipeLimit  int64         // Bytes per second, per direction of each pipe
+	MailboxDir    string        // Directory for store-and-forward blobs; empty = mailbox disabled
+	MailboxTTL    time.Duration // Longest a blob is kept, and the default; 0 = DefaultMailboxTTL
+	MailboxQuota  int64         // Total bytes of stored blobs; 0 = no quota
 }
 
 // RelayServer pairs connections by RoomID and role: sender only with receiver.
 type RelayServer struct {
-	timeout time.Duration
-	mu      sync.Mutex
-	rooms   map[string]*roomSlot
+	timeout       time.Duration
+	headerTimeout time.Duration
+	opts          RelayOptions
+	mu            sync.Mutex
+	rooms         map[string]*roomSlot
+	ipRooms       map[string]int
+	pipes         map[uint64]*pipeInfo
+	pipeSeq       uint64
+	started       time.Time
+	metrics       relayMetrics
+	mailbox       *mailboxStore // nil unless RelayOptions.MailboxDir is set
 }
 
-// NewRelayServer creates a relay server with the given pairing timeout.
-func NewRelayServer(timeout time.Duration) *RelayServer {
-	return &RelayServer{
-		timeout: timeout,
-		rooms:   make(map[string]*roomSlot),
+// NewRelayServer creates a relay server with the given pairing timeout. opts may be nil.
+func NewRelayServer(timeout time.Duration, opts *RelayOptions) *RelayServer {
+	r := &RelayServer{
+		timeout:       timeout,
+		headerTimeout: relayHeaderTimeout,
+		rooms:         make(map[string]*roomSlot),
+		ipRooms:       make(map[string]int),
+		pipes:         make(map[uint64]*pipeInfo),
+		started:       time.Now(),
+	}
+	if opts != nil {
+		r.opts = *opts
 	}
+	if r.opts.MailboxDir != "" {
+		r.mailbox = newMailboxStore(r.opts.MailboxDir, r.opts.MailboxTTL, r.opts.MailboxQuota)
+	}
+	return r
 }
 
-// HandleConn handles a single connection: read RoomID+role, match opposite role or wait, then pipe.
+// authorize checks a client token against the configured list in constant time.
+func (r *RelayServer) authorize(token string) error {
+	if len(r.opts.Tokens) == 0 {
+		return nil
+	}
+	ok := 0
+	for _, t := range r.opts.Tokens {
+		ok |= subtle.ConstantTimeCompare([]byte(t), []byte(token))
+	}
+	if ok != 1 {
+		return ErrRelayAuth
+	}
+	return nil
+}
+
+// remoteIP returns the host part of conn's remote address.
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+// releaseRoom forgets a waiting room and its per-IP count. Caller holds r.mu.
+func (r *RelayServer) releaseRoom(key string, slot *roomSlot) {
+	delete(r.rooms, key)
+	if r.ipRooms[slot.ip]--; r.ipRooms[slot.ip] <= 0 {
+		delete(r.ipRooms, slot.ip)
+	}
+}
+
+// reply sends the admission status to v2 clients; legacy clients get none.
+func reply(conn net.Conn, h *relayHeader, status byte) {
+	if h != nil && !h.legacy {
+		conn.Write([]byte{status})
+	}
+}
+
+// HandleConn handles a single connection: read relay header (RoomID+role), match opposite role or wait, then pipe.
 func (r *RelayServer) HandleConn(conn net.Conn) {
 	closeOnReturn := true
 	defer func() {
@@ -40,41 +121,64 @@ func (r *RelayServer) HandleConn(conn net.Conn) {
 		}
 	}()
 
-	if tcp, ok := conn.(*net.TCPConn); ok {
+	if tcp, ok := tcpConn(conn); ok {
 		tcp.SetNoDelay(true)
 	}
+	r.metrics.connsAccepted.Add(1)
 
-	roomID := make([]byte, roomIDLen)
-	if _, err := io.ReadFull(conn, roomID); err != nil {
-		logger.Warn("relay.HandleConn read room_id failed", logger.Context("params", map[string]any{"remote": conn.RemoteAddr().String(), "error": err.Error()})...)
-		return
-	}
-	roleBuf := make([]byte, 1)
-	if _, err := io.ReadFull(conn, roleBuf); err != nil {
-		logger.Warn("relay.HandleConn read role failed", logger.Context("params", map[string]any{"remote": conn.RemoteAddr().String(), "error": err.Error()})...)
+	conn.SetReadDeadline(time.Now().Add(r.headerTimeout))
+	h, err := readRelayHeader(conn, r.authorize)
+	if err != nil {
+		if errors.Is(err, ErrRelayAuth) {
+			r.metrics.authFailures.Add(1)
+			reply(conn, h, relayStatusUnauthorized)
+			logger.Warn("relay.HandleConn unauthorized", logger.Context("params", map[string]any{"remote": conn.RemoteAddr().String()})...)
+			return
+		}
+		r.metrics.headerErrors.Add(1)
+		logger.Warn("relay.HandleConn read header failed", logger.Context("params", map[string]any{"remote": conn.RemoteAddr().String(), "error": err.Error()})...)
 		return
 	}
-	role := int(roleBuf[0])
-	key := string(roomID)
+	conn.SetReadDeadline(time.Time{})
+	key, role := h.roomID, h.role
 	logger.Info("relay.HandleConn", logger.Context("params", map[string]any{
-		"remote": conn.RemoteAddr().String(), "room_id": key, "role": role,
+		"remote": conn.RemoteAddr().String(), "room_id": key, "role": role, "mailbox": h.mailbox,
 	})...)
+	if h.mailbox {
+		r.handleMailbox(conn, h)
+		return
+	}
 
+	ip := remoteIP(conn)
 	r.mu.Lock()
 	slot, exists := r.rooms[key]
 	if exists {
 		if slot.waitingRole == role {
 			// Same role (sender+sender or receiver+receiver) - reject to avoid PAKE error.
 			r.mu.Unlock()
+			r.metrics.sameRoleRejections.Add(1)
+			reply(conn, h, relayStatusRoleTaken)
 			logger.Warn("relay.HandleConn same role rejected", logger.Context("params", map[string]any{
 				"remote": conn.RemoteAddr().String(), "room_id": key, "role": role,
 			})...)
 			return
 		}
-		// Opposite role: second arrival, match.
-		delete(r.rooms, key)
+		if r.opts.MaxPipes > 0 && len(r.pipes) >= r.opts.MaxPipes {
+			r.mu.Unlock()
+			r.metrics.limitRejections.Add(1)
+			reply(conn, h, relayStatusBusy)
+			logger.Warn("relay.HandleConn pipe limit reached", logger.Context("params", map[string]any{
+				"remote": conn.RemoteAddr().String(), "room_id": key, "max_pipes": r.opts.MaxPipes,
+			})...)
+			return
+		}
+		// Opposite role: second arrival, match. Once the room is released the
+		// waiter no longer times out, so the sends below cannot race its exit.
+		r.releaseRoom(key, slot)
 		ch := slot.ch
 		r.mu.Unlock()
+		r.metrics.pairsMatched.Add(1)
+		reply(conn, h, relayStatusOK)
 		logger.Info("relay.HandleConn matched", logger.Context("params", map[string]any{"room_id": key, "remote": conn.RemoteAddr().String()})...)
 		ch <- conn
 		peer := <-ch
@@ -83,55 +187,112 @@ func (r *RelayServer) HandleConn(conn net.Conn) {
 		_ = peer
 		return
 	}
+	if r.opts.MaxRoomsPerIP > 0 && r.ipRooms[ip] >= r.opts.MaxRoomsPerIP {
+		r.mu.Unlock()
+		r.metrics.limitRejections.Add(1)
+		reply(conn, h, relayStatusRoomLimit)
+		logger.Warn("relay.HandleConn room limit reached", logger.Context("params", map[string]any{
+			"remote": conn.RemoteAddr().String(), "max_rooms_per_ip": r.opts.MaxRoomsPerIP,
+		})...)
+		return
+	}
 	ch := make(chan net.Conn, 1)
-	r.rooms[key] = &roomSlot{waitingRole: role, ch: ch}
+	slot = &roomSlot{waitingRole: role, ch: ch, remote: conn.RemoteAddr().String(), ip: ip, since: time.Now()}
+	r.rooms[key] = slot
+	r.ipRooms[ip]++
 	r.mu.Unlock()
+	reply(conn, h, relayStatusOK)
 
 	// First arrival: wait for opposite role.
 	logger.Info("relay.HandleConn waiting for peer", logger.Context("params", map[string]any{
 		"remote": conn.RemoteAddr().String(), "room_id": key, "role": role, "timeout_sec": r.timeout.Seconds(),
 	})...)
+	var peer net.Conn
 	select {
-	case peer := <-ch:
-		ch <- conn
-		closeOnReturn = false
-		logger.Info("relay.HandleConn piping", logger.Context("params", map[string]any{
-			"room_id": key, "a": conn.RemoteAddr().String(), "b": peer.RemoteAddr().String(),
-		})...)
-		r.pipe(conn, peer)
-		logger.Info("relay.HandleConn pipe closed", logger.Context("params", map[string]any{"room_id": key})...)
+	case peer = <-ch:
 	case <-time.After(r.timeout):
 		r.mu.Lock()
-		close(ch)
-		delete(r.rooms, key)
+		timedOut := r.rooms[key] == slot
+		if timedOut {
+			r.releaseRoom(key, slot)
+		}
 		r.mu.Unlock()
-		logger.Warn("relay.HandleConn pairing timeout", logger.Context("params", map[string]any{"remote": conn.RemoteAddr().String(), "room_id": key})...)
+		if timedOut {
+			r.metrics.pairingTimeouts.Add(1)
+			logger.Warn("relay.HandleConn pairing timeout", logger.Context("params", map[string]any{"remote": conn.RemoteAddr().String(), "room_id": key})...)
+			return
+		}
+		// A peer claimed the room as the timer fired; its conn is on the way.
+		peer = <-ch
 	}
+	ch <- conn
+	closeOnReturn = false
+	logger.Info("relay.HandleConn piping", logger.Context("params", map[string]any{
+		"room_id": key, "a": conn.RemoteAddr().String(), "b": peer.RemoteAddr().String(),
+	})...)
+	r.pipe(conn, peer, key, role)
+	logger.Info("relay.HandleConn pipe closed", logger.Context("params", map[string]any{"room_id": key})...)
 }
 
-func (r *RelayServer) pipe(a, b net.Conn) {
+// pipe copies between a (role aRole) and b until either side closes, counting
+// bytes per direction for metrics and the status page.
+func (r *RelayServer) pipe(a, b net.Conn, roomID string, aRole int) {
+	info := &pipeInfo{roomID: roomID, sender: a.RemoteAddr().String(), receiver: b.RemoteAddr().String(), started: time.Now()}
+	toA, toB := &info.toSender, &info.toRecv
+	globalToA, globalToB := &r.metrics.bytesRecvToSender, &r.metrics.bytesSenderToRecv
+	if aRole == RoleReceiver {
+		info.sender, info.receiver = info.receiver, info.sender
+		toA, toB = toB, toA
+		globalToA, globalToB = globalToB, globalToA
+	}
+	r.mu.Lock()
+	r.pipeSeq++
+	id := r.pipeSeq
+	r.pipes[id] = info
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.pipes, id)
+		r.mu.Unlock()
+	}()
+
 	// 使用独立 buffer，避免双向 copy 共享 buffer 导致数据损坏
 	bufA2B := GetBuffer()
 	bufB2A := GetBuffer()
 	defer PutBuffer(bufA2B)
 	defer PutBuffer(bufB2A)
 
+	wa := &countingWriter{w: &limitedWriter{w: a, lim: newRateLimiter(r.opts.PerPipeLimit)}, counters: []*atomic.Int64{toA, globalToA}}
+	wb := &countingWriter{w: &limitedWriter{w: b, lim: newRateLimiter(r.opts.PerPipeLimit)}, counters: []*atomic.Int64{toB, globalToB}}
+
 	done := make(chan struct{}, 1)
 	go func() {
-		io.CopyBuffer(a, b, bufA2B)
-		if tcp, ok := a.(*net.TCPConn); ok {
-			tcp.CloseWrite()
-		}
+		io.CopyBuffer(wa, b, bufA2B)
+		closeWrite(a)
 		done <- struct{}{}
 	}()
 	go func() {
-		io.CopyBuffer(b, a, bufB2A)
-		if tcp, ok := b.(*net.TCPConn); ok {
-			tcp.CloseWrite()
-		}
+		io.CopyBuffer(wb, a, bufB2A)
+		closeWrite(b)
 		done <- struct{}{}
 	}()
 	<-done
 	a.Close()
 	b.Close()
 }
+
+// tcpConn returns the TCP connection under conn, unwrapping TLS.
+func tcpConn(conn net.Conn) (*net.TCPConn, bool) {
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	tcp, ok := conn.(*net.TCPConn)
+	return tcp, ok
+}
+
+// closeWrite half-closes conn (TCP FIN, or TLS close_notify) so the peer sees EOF.
+func closeWrite(conn net.Conn) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	}
+}
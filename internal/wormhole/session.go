@@ -1,4 +1,4 @@
-// Package wormhole implements a secure P2P tunnel using PAKE + AES-256-CTR.
+// Package wormhole implements a secure P2P tunnel using PAKE + AES-256-GCM records.
 //
 // Usage example:
 //
@@ -7,7 +7,7 @@
 //	conn, _ := ln.Accept()
 //	secure, _ := wormhole.UpgradeDefault(conn, "shared-password", false)
 //	defer secure.Close()
-//	// secure.Read/Write are now encrypted
+//	// secure.Read/Write are now encrypted and authenticated
 //
 //	// Client (sender)
 //	conn, _ := net.Dial("tcp", "localhost:9999")
@@ -17,7 +17,7 @@
 package wormhole
 
 import (
-	"crypto/cipher"
+	"encoding/binary"
 	"io"
 	"net"
 	"time"
@@ -25,17 +25,21 @@ import (
 	"github.com/A-Flex-Box/cli/internal/logger"
 )
 
-// SecureConn wraps a net.Conn with transparent encryption/decryption.
+// SecureConn wraps a net.Conn with transparent authenticated encryption.
 // It implements net.Conn.
 type SecureConn struct {
 	conn   net.Conn
 	reader io.Reader
-	writer io.Writer
+	writer *recordWriter
+	limit  *Limiter     // optional bandwidth cap, see SetLimiter
+	sas    SAS          // derived from the PAKE key that authenticated the pairing code
+	caps   Capabilities // agreed in the Hello exchange; zero for bare Upgrade sessions
+	rejoin string       // PAKE password for reconnecting a tunnel, see redialTunnel
 }
 
 // Upgrade runs the handshake, verification, and returns a secured connection.
-// handshaker and streamCipher can be nil to use defaults.
-func Upgrade(conn net.Conn, password string, isSender bool, handshaker Handshaker, streamCipher StreamCipher) (*SecureConn, error) {
+// handshaker and recordCipher can be nil to use defaults.
+func Upgrade(conn net.Conn, password string, isSender bool, handshaker Handshaker, recordCipher RecordCipher) (*SecureConn, error) {
 	logger.Info("wormhole.Upgrade start", logger.Context("params", map[string]any{
 		"local": conn.LocalAddr().String(), "remote": conn.RemoteAddr().String(),
 		"is_sender": isSender, "password_len": len(password),
@@ -43,8 +47,8 @@ func Upgrade(conn net.Conn, password string, isSender bool, handshaker Handshake
 	if handshaker == nil {
 		handshaker = DefaultHandshaker
 	}
-	if streamCipher == nil {
-		streamCipher = DefaultStreamCipher
+	if recordCipher == nil {
+		recordCipher = DefaultRecordCipher
 	}
 
 	transport := NewFrameTransport(conn)
@@ -57,41 +61,74 @@ func Upgrade(conn net.Conn, password string, isSender bool, handshaker Handshake
 	}
 	logger.Debug("PAKE handshake completed")
 
-	encStream, decStream, err := streamCipher.NewDuplex(key, isSender)
+	seal, open, err := recordCipher.NewAEADs(key, isSender)
 	if err != nil {
 		return nil, err
 	}
+	rd := newRecordReader(conn, open)
+	wr := newRecordWriter(conn, seal)
 
-	// Phase 2: Ping-Pong verification
+	// Phase 2: mutual verification. Sender's first record carries MagicVerify;
+	// receiver answers with its own, so both sides confirm the key before any payload.
 	if isSender {
-		encrypted := make([]byte, len(MagicVerify))
-		encStream.XORKeyStream(encrypted, []byte(MagicVerify))
-		if err := transport.SendFrame(encrypted); err != nil {
+		if _, err := wr.Write([]byte(MagicVerify)); err != nil {
 			return nil, err
 		}
+		ack := make([]byte, len(MagicVerify))
+		if _, err := io.ReadFull(rd, ack); err != nil {
+			logger.Warn("wormhole.Upgrade verification ack failed", logger.Context("params", map[string]any{"error": err.Error()})...)
+			if err == ErrTruncated {
+				return nil, ErrPeerClosedVerify
+			}
+			if err == ErrRecordAuth {
+				return nil, ErrVerifyFailed
+			}
+			return nil, err
+		}
+		if string(ack) != MagicVerify {
+			return nil, ErrVerifyFailed
+		}
 	} else {
 		frame, err := transport.ReadFrame()
 		if err != nil {
 			return nil, err
 		}
-		decrypted := make([]byte, len(frame))
-		decStream.XORKeyStream(decrypted, frame)
-		if string(decrypted) != MagicVerify {
+		if isLegacyVerify(key, frame) {
+			logger.Warn("wormhole.Upgrade legacy AES-CTR peer refused")
+			return nil, ErrLegacyPeer
+		}
+		hdr := make([]byte, recordHeaderLen)
+		binary.BigEndian.PutUint32(hdr, uint32(len(frame)))
+		if err := rd.open(hdr, frame); err != nil || string(rd.plain) != MagicVerify {
 			logger.Warn("wormhole.Upgrade verification failed (magic mismatch)")
 			return nil, ErrVerifyFailed
 		}
+		rd.pos = len(rd.plain)
+		if _, err := wr.Write([]byte(MagicVerify)); err != nil {
+			return nil, err
+		}
 	}
 
 	logger.Debug("verification passed, secure tunnel ready")
-	// Phase 3: Transparent tunnel (no more framing; raw encrypted stream)
-	// encStream: our writes; decStream: our reads
-	rd := &cipher.StreamReader{S: decStream, R: conn}
-	wr := &cipher.StreamWriter{S: encStream, W: conn}
-
+	// Phase 3: Transparent tunnel of authenticated records.
 	logger.Info("wormhole.Upgrade done", logger.Context("result", map[string]any{
 		"local": conn.LocalAddr().String(), "remote": conn.RemoteAddr().String(),
 	})...)
-	return &SecureConn{conn: conn, reader: rd, writer: wr}, nil
+	return &SecureConn{conn: conn, reader: rd, writer: wr, sas: deriveSAS(key), rejoin: deriveRejoin(key)}, nil
+}
+
+// isLegacyVerify reports whether frame is a pre-AEAD peer's AES-CTR MagicVerify.
+func isLegacyVerify(key, frame []byte) bool {
+	if len(frame) != len(MagicVerify) {
+		return false
+	}
+	_, dec, err := legacyCipher.NewDuplex(key, false)
+	if err != nil {
+		return false
+	}
+	plain := make([]byte, len(frame))
+	dec.XORKeyStream(plain, frame)
+	return string(plain) == MagicVerify
 }
 
 // UpgradeDefault is a convenience that uses default handshaker and cipher.
@@ -99,18 +136,49 @@ func UpgradeDefault(conn net.Conn, password string, isSender bool) (*SecureConn,
 	return Upgrade(conn, password, isSender, nil, nil)
 }
 
-// Read decrypts data on the fly.
+// SAS returns the session's short authentication string. For a session moved to
+// a direct connection it is still the one from the code-authenticated relay PAKE.
+func (s *SecureConn) SAS() SAS {
+	return s.sas
+}
+
+// Capabilities returns what the peers agreed on in the Hello exchange of an
+// openSession session. It is the zero value for connections from bare Upgrade.
+func (s *SecureConn) Capabilities() Capabilities {
+	return s.caps
+}
+
+// SetLimiter caps the bandwidth of later reads and writes. l may be nil (unlimited)
+// and may be shared with a UI that changes its rate while the session runs.
+func (s *SecureConn) SetLimiter(l *Limiter) {
+	s.limit = l
+}
+
+// Read decrypts data on the fly. With a limiter, the caller is held back
+// after a read until the bytes fit the rate.
 func (s *SecureConn) Read(p []byte) (n int, err error) {
-	return s.reader.Read(p)
+	n, err = s.reader.Read(p)
+	if n > 0 {
+		s.limit.reader().wait(n)
+	}
+	return n, err
 }
 
 // Write encrypts data on the fly.
 func (s *SecureConn) Write(p []byte) (n int, err error) {
+	if w := s.limit.writer(); w != nil {
+		return writeLimited(s.writer, w, p)
+	}
 	return s.writer.Write(p)
 }
 
-// Close closes the underlying connection.
+// closeTimeout bounds how long Close waits to deliver the end-of-stream record.
+const closeTimeout = 2 * time.Second
+
+// Close sends the end-of-stream record and closes the underlying connection.
 func (s *SecureConn) Close() error {
+	s.conn.SetWriteDeadline(time.Now().Add(closeTimeout))
+	s.writer.closeWrite()
 	return s.conn.Close()
 }
 
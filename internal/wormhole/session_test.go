@@ -0,0 +1,118 @@
+package wormhole
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func newTestRecordPair(t *testing.T) (*recordWriter, func(io.Reader) *recordReader, *bytes.Buffer) {
+	t.Helper()
+	key := bytes.Repeat([]byte{0x42}, 32)
+	seal, _, err := DefaultRecordCipher.NewAEADs(key, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, open, err := DefaultRecordCipher.NewAEADs(key, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wire bytes.Buffer
+	return newRecordWriter(&wire, seal), func(r io.Reader) *recordReader { return newRecordReader(r, open) }, &wire
+}
+
+func TestRecordRoundTrip(t *testing.T) {
+	w, newReader, wire := newTestRecordPair(t)
+	msg := bytes.Repeat([]byte("wormhole"), 5000) // spans several records
+	if _, err := w.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.closeWrite(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(newReader(wire))
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Error("round trip mismatch")
+	}
+}
+
+func TestRecordDetectsTampering(t *testing.T) {
+	w, newReader, wire := newTestRecordPair(t)
+	w.Write([]byte("transfer 100 coins"))
+	w.closeWrite()
+	data := wire.Bytes()
+	data[recordHeaderLen+3] ^= 0x01
+
+	_, err := io.ReadAll(newReader(bytes.NewReader(data)))
+	if !errors.Is(err, ErrRecordAuth) {
+		t.Errorf("error = %v, want ErrRecordAuth", err)
+	}
+}
+
+func TestRecordDetectsTruncation(t *testing.T) {
+	w, newReader, wire := newTestRecordPair(t)
+	w.Write([]byte("first"))
+	w.Write([]byte("second"))
+	w.closeWrite()
+	// Drop the final record: a relay cutting the stream at a record boundary.
+	first := recordHeaderLen + len("first") + 16
+	data := wire.Bytes()[:first]
+
+	_, err := io.ReadAll(newReader(bytes.NewReader(data)))
+	if !errors.Is(err, ErrTruncated) {
+		t.Errorf("error = %v, want ErrTruncated", err)
+	}
+}
+
+func TestUpgradeRoundTrip(t *testing.T) {
+	a, b := net.Pipe()
+	errCh := make(chan error, 1)
+	go func() {
+		s, err := UpgradeDefault(a, "secret", true)
+		if err == nil {
+			_, err = s.Write([]byte("ping"))
+			s.Close()
+		}
+		errCh <- err
+	}()
+	s, err := UpgradeDefault(b, "secret", false)
+	if err != nil {
+		t.Fatalf("receiver Upgrade() error = %v", err)
+	}
+	got, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if string(got) != "ping" {
+		t.Errorf("got %q, want ping", got)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("sender error = %v", err)
+	}
+}
+
+func TestUpgradeRefusesLegacyPeer(t *testing.T) {
+	a, b := net.Pipe()
+	go func() {
+		// Pre-AEAD sender: PAKE, then an AES-CTR MagicVerify frame.
+		transport := NewFrameTransport(a)
+		key, err := DefaultHandshaker.Run(transport, "secret", true)
+		if err != nil {
+			return
+		}
+		enc, _, _ := (&AESCTRCipher{}).NewDuplex(key, true)
+		frame := make([]byte, len(MagicVerify))
+		enc.XORKeyStream(frame, []byte(MagicVerify))
+		transport.SendFrame(frame)
+		a.Close()
+	}()
+	_, err := UpgradeDefault(b, "secret", false)
+	if !errors.Is(err, ErrLegacyPeer) {
+		t.Errorf("error = %v, want ErrLegacyPeer", err)
+	}
+}
@@ -1,70 +1,38 @@
 package wormhole
 
 import (
-	"bufio"
-	"bytes"
 	"io"
-	"net/http"
-	"strings"
+
+	"github.com/A-Flex-Box/cli/internal/doctor/instrument"
 )
 
-const peekSize = 512
+const peekSize = instrument.MaxHeaderBytes
 
 // TrafficInfo holds parsed protocol info from sniffed bytes.
 type TrafficInfo struct {
-	Protocol string // "HTTP", "SSH", "TCP"
+	Protocol string // An instrument protocol: "HTTP", "TLS/SSL", "PostgreSQL", "TCP (Raw)", ...
 	Method   string // HTTP: GET, POST, etc.
 	Path     string // HTTP: /path
+	Detail   string // What the opening message revealed, e.g. "TLS 1.3, sni=example.com"
 	Raw      string // Short display string
 }
 
 // analyzeTraffic peeks at the first bytes and returns protocol info.
 func analyzeTraffic(peek []byte) TrafficInfo {
 	if len(peek) == 0 {
-		return TrafficInfo{Protocol: "TCP", Raw: "(no data)"}
+		return TrafficInfo{Protocol: instrument.ProtocolTCP, Raw: "(no data)"}
 	}
-
-	// SSH: starts with "SSH-"
-	if len(peek) >= 4 && string(peek[:4]) == "SSH-" {
-		return TrafficInfo{
-			Protocol: "SSH",
-			Raw:      "[SSH] connection",
-		}
+	d := instrument.Detect(peek)
+	info := TrafficInfo{Protocol: d.Protocol, Method: d.Method, Path: d.Path, Detail: d.Summary()}
+	switch {
+	case d.Protocol == instrument.ProtocolTCP:
+		info.Raw = "(binary stream)"
+	case info.Detail == "":
+		info.Raw = "[" + d.Protocol + "] connection"
+	default:
+		info.Raw = "[" + d.Protocol + "] " + info.Detail
 	}
-
-	// HTTP: method + space + path
-	if idx := bytes.IndexByte(peek, '\n'); idx >= 0 {
-		line := string(bytes.TrimSpace(peek[:idx]))
-		parts := strings.SplitN(line, " ", 3)
-		if len(parts) >= 2 {
-			method := strings.ToUpper(parts[0])
-			path := parts[1]
-			// Common HTTP methods
-			for _, m := range []string{"GET", "POST", "PUT", "DELETE", "PATCH", "HEAD", "OPTIONS"} {
-				if method == m {
-					return TrafficInfo{
-						Protocol: "HTTP",
-						Method:   method,
-						Path:     path,
-						Raw:      "[HTTP] " + method + " " + path,
-					}
-				}
-			}
-		}
-	}
-
-	// Try http parse as fallback
-	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(peek)))
-	if err == nil {
-		return TrafficInfo{
-			Protocol: "HTTP",
-			Method:   req.Method,
-			Path:     req.URL.Path,
-			Raw:      "[HTTP] " + req.Method + " " + req.URL.Path,
-		}
-	}
-
-	return TrafficInfo{Protocol: "TCP", Raw: "(binary stream)"}
+	return info
 }
 
 // SniffingReader wraps a reader, peeks at the first peekSize bytes, analyzes
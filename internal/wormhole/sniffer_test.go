@@ -0,0 +1,89 @@
+package wormhole
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// clientHello captures the first flight of a real TLS client.
+func clientHello(t *testing.T, cfg *tls.Config) []byte {
+	t.Helper()
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	go tls.Client(a, cfg).Handshake()
+	b.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, peekSize)
+	n, err := b.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf[:n]
+}
+
+func TestAnalyzeTraffic(t *testing.T) {
+	bson := func(pairs ...string) []byte {
+		var doc []byte
+		for i := 0; i < len(pairs); i += 2 {
+			doc = append(doc, 0x02)
+			doc = append(append(doc, pairs[i]...), 0)
+			doc = binary.LittleEndian.AppendUint32(doc, uint32(len(pairs[i+1])+1))
+			doc = append(append(doc, pairs[i+1]...), 0)
+		}
+		doc = append(doc, 0)
+		return append(binary.LittleEndian.AppendUint32(nil, uint32(len(doc)+4)), doc...)
+	}
+	opMsg := append([]byte{0, 0, 0, 0, 0}, bson("find", "users", "$db", "shop")...) // flags, body section
+	mongo := binary.LittleEndian.AppendUint32(nil, uint32(16+len(opMsg)))
+	mongo = binary.LittleEndian.AppendUint32(mongo, 1)
+	mongo = binary.LittleEndian.AppendUint32(mongo, 0)
+	mongo = append(binary.LittleEndian.AppendUint32(mongo, 2013), opMsg...)
+
+	startup := []byte("\x00\x03\x00\x00user\x00app\x00database\x00shop\x00\x00")
+	postgres := append(binary.BigEndian.AppendUint32(nil, uint32(len(startup)+4)), startup...)
+
+	mysqlPacket := func(seq byte, payload []byte) []byte {
+		return append([]byte{byte(len(payload)), byte(len(payload) >> 8), 0, seq}, payload...)
+	}
+	greeting := mysqlPacket(0, []byte("\x0a8.0.36\x00\x01\x00\x00\x00saltsalt\x00"))
+	login := binary.LittleEndian.AppendUint32(nil, 0x200|0x8000|0x8) // protocol 41, secure conn, with db
+	login = append(login, 0, 0, 0, 1, 33)
+	login = append(login, make([]byte, 23)...)
+	login = append(login, "app\x00\x04pass"+"shop\x00"...)
+
+	x224 := append([]byte{0xe0, 0, 0, 0, 0, 0}, "Cookie: mstshash=alice\r\n\x01\x00\x08\x00\x03\x00\x00\x00"...)
+	rdp := append([]byte{3, 0, 0, byte(5 + len(x224)), byte(len(x224))}, x224...)
+
+	grpc := append([]byte(http2PrefaceForTest), 0, 0, 0x20, 1, 4, 0, 0, 0, 1, 0x5f, 0x8b)
+	grpc = append(grpc, 0x1d, 0x75, 0xd0, 0x62, 0x0d, 0x26, 0x3d, 0x4c, 0x4d, 0x65, 0x64) // Huffman "application/grpc"
+
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"tls", clientHello(t, &tls.Config{ServerName: "example.com", NextProtos: []string{"h2", "http/1.1"}}), "[TLS/SSL] TLS 1.3, sni=example.com, alpn=h2,http/1.1"},
+		{"http", []byte("GET /api/users HTTP/1.1\r\nHost: x\r\n\r\n"), "[HTTP] GET /api/users"},
+		{"ssh", []byte("SSH-2.0-OpenSSH_9.6\r\n"), "[SSH] OpenSSH_9.6"},
+		{"postgres", postgres, "[PostgreSQL] 3.0, user=app, db=shop"},
+		{"postgres ssl", []byte{0, 0, 0, 8, 0x04, 0xd2, 0x16, 0x2f}, "[PostgreSQL] SSL request"},
+		{"mysql greeting", greeting, "[MySQL] 8.0.36"},
+		{"mysql login", mysqlPacket(1, login), "[MySQL] user=app, db=shop"},
+		{"mongo", mongo, "[MongoDB] db=shop, cmd=find"},
+		{"grpc", grpc, "[gRPC] connection"},
+		{"http2", []byte(http2PrefaceForTest), "[HTTP/2] connection"},
+		{"rdp", rdp, "[RDP] user=alice"},
+		{"vnc", []byte("RFB 003.008\n"), "[VNC] 3.8"},
+		{"binary", []byte{0xde, 0xad, 0xbe, 0xef, 0, 1, 2, 3}, "(binary stream)"},
+	}
+	for _, tt := range tests {
+		if got := analyzeTraffic(tt.head).Raw; got != tt.want {
+			t.Errorf("%s: analyzeTraffic() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+const http2PrefaceForTest = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
@@ -0,0 +1,289 @@
+package wormhole
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// SOCKS5 (RFC 1928) values used by the connect side's local proxy. Reply codes
+// double as the status byte the expose side returns on a SOCKS stream.
+const (
+	socksVersion      = 5
+	socksNoAuth       = 0x00
+	socksNoAcceptable = 0xff
+	socksCmdConnect   = 0x01
+	socksAtypIPv4     = 0x01
+	socksAtypDomain   = 0x03
+	socksAtypIPv6     = 0x04
+
+	socksOK              = 0x00
+	socksFailure         = 0x01
+	socksNotAllowed      = 0x02
+	socksHostUnreachable = 0x04
+	socksRefused         = 0x05
+	socksCmdUnsupported  = 0x07
+	socksAtypUnsupported = 0x08
+)
+
+const (
+	// socksRemote is TunnelBind.Remote for a local SOCKS5 server.
+	socksRemote = "socks"
+	// defaultSocksBind is where the connect side serves SOCKS when not told otherwise.
+	defaultSocksBind = "127.0.0.1:1080"
+	// socksDialTimeout bounds the expose side's dial of a SOCKS destination.
+	socksDialTimeout = 10 * time.Second
+	// DefaultSocksAllow is the destination policy when none is given: private
+	// networks, but not the expose host's own loopback services.
+	DefaultSocksAllow = "10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,fc00::/7"
+)
+
+var errSocksDenied = errors.New("destination not allowed by the SOCKS policy")
+
+// dialRule is one entry of a DialPolicy.
+type dialRule struct {
+	deny   bool
+	prefix *net.IPNet // CIDR or single IP
+	name   string     // exact host name, or ".suffix" for "*.suffix"
+	port   int        // 0 means any port
+}
+
+// DialPolicy decides which destinations SOCKS streams may reach from the
+// expose side. Rules are tried in order and the first match wins; anything
+// that matches no rule is denied.
+type DialPolicy struct {
+	rules []dialRule
+	text  string
+}
+
+// ParseDialPolicy parses a comma-separated rule list. Each rule is a CIDR
+// (10.0.0.0/8), an IP, a host name (db.internal) or a domain wildcard
+// (*.corp.example), optionally with :port, and optionally prefixed with ! to deny:
+//
+//	!10.0.0.1,10.0.0.0/8,*.corp.example:443
+func ParseDialPolicy(s string) (*DialPolicy, error) {
+	p := &DialPolicy{text: s}
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		var r dialRule
+		if rest, ok := strings.CutPrefix(f, "!"); ok {
+			r.deny, f = true, rest
+		}
+		// A port follows the last colon unless that colon is part of an IPv6 address.
+		if host, port, err := net.SplitHostPort(f); err == nil {
+			n, err := strconv.Atoi(port)
+			if err != nil || n < 1 || n > 65535 {
+				return nil, fmt.Errorf("invalid port in rule %q", f)
+			}
+			r.port, f = n, host
+		}
+		switch {
+		case strings.Contains(f, "/"):
+			_, prefix, err := net.ParseCIDR(f)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q", f)
+			}
+			r.prefix = prefix
+		case net.ParseIP(f) != nil:
+			ip := net.ParseIP(f)
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			r.prefix = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		case strings.HasPrefix(f, "*."):
+			r.name = strings.ToLower(f[1:])
+		case f != "" && !strings.ContainsAny(f, "*/ "):
+			r.name = strings.ToLower(f)
+		default:
+			return nil, fmt.Errorf("invalid rule %q", f)
+		}
+		p.rules = append(p.rules, r)
+	}
+	if len(p.rules) == 0 {
+		return nil, fmt.Errorf("empty SOCKS policy")
+	}
+	return p, nil
+}
+
+// String returns the policy as it was written.
+func (p *DialPolicy) String() string {
+	return p.text
+}
+
+// matchName returns the first rule matching host by name, if any.
+func (p *DialPolicy) matchName(host string, port int) (dialRule, bool) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, r := range p.rules {
+		if r.name == "" || (r.port != 0 && r.port != port) {
+			continue
+		}
+		if host == r.name || (strings.HasPrefix(r.name, ".") && strings.HasSuffix(host, r.name)) {
+			return r, true
+		}
+	}
+	return dialRule{}, false
+}
+
+// matchIP returns the first rule matching ip, if any.
+func (p *DialPolicy) matchIP(ip net.IP, port int) (dialRule, bool) {
+	for _, r := range p.rules {
+		if r.prefix != nil && (r.port == 0 || r.port == port) && r.prefix.Contains(ip) {
+			return r, true
+		}
+	}
+	return dialRule{}, false
+}
+
+// resolve checks a destination against the policy and returns the address to
+// dial. Names matched by a name rule are dialed as given; others are resolved
+// here and checked by address, and the checked address is what gets dialed, so
+// a name cannot be re-pointed between the check and the dial.
+func (p *DialPolicy) resolve(ctx context.Context, host string, port int) (string, error) {
+	hostport := func(h string) string { return net.JoinHostPort(h, strconv.Itoa(port)) }
+	if r, ok := p.matchName(host, port); ok {
+		if r.deny {
+			return "", errSocksDenied
+		}
+		return hostport(host), nil
+	}
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return "", err
+		}
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+	}
+	for _, ip := range ips {
+		if r, ok := p.matchIP(ip, port); ok && !r.deny {
+			return hostport(ip.String()), nil
+		}
+	}
+	return "", errSocksDenied
+}
+
+// socksHandshake runs the server side of a SOCKS5 greeting and CONNECT request
+// on c and returns the requested host and port. Unsupported requests get their
+// error reply here.
+func socksHandshake(c net.Conn) (string, int, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c, hdr[:]); err != nil {
+		return "", 0, err
+	}
+	if hdr[0] != socksVersion {
+		return "", 0, fmt.Errorf("not a SOCKS5 client (version %d)", hdr[0])
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(c, methods); err != nil {
+		return "", 0, err
+	}
+	if !strings.ContainsRune(string(methods), socksNoAuth) {
+		c.Write([]byte{socksVersion, socksNoAcceptable})
+		return "", 0, fmt.Errorf("SOCKS client offers no unauthenticated method")
+	}
+	if _, err := c.Write([]byte{socksVersion, socksNoAuth}); err != nil {
+		return "", 0, err
+	}
+
+	var req [4]byte // version, command, reserved, address type
+	if _, err := io.ReadFull(c, req[:]); err != nil {
+		return "", 0, err
+	}
+	if req[1] != socksCmdConnect {
+		socksReply(c, socksCmdUnsupported)
+		return "", 0, fmt.Errorf("SOCKS command %d not supported (only CONNECT)", req[1])
+	}
+	var host string
+	switch req[3] {
+	case socksAtypIPv4, socksAtypIPv6:
+		ip := make(net.IP, 4)
+		if req[3] == socksAtypIPv6 {
+			ip = make(net.IP, 16)
+		}
+		if _, err := io.ReadFull(c, ip); err != nil {
+			return "", 0, err
+		}
+		host = ip.String()
+	case socksAtypDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(c, n[:]); err != nil {
+			return "", 0, err
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(c, name); err != nil {
+			return "", 0, err
+		}
+		host = string(name)
+	default:
+		socksReply(c, socksAtypUnsupported)
+		return "", 0, fmt.Errorf("SOCKS address type %d not supported", req[3])
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(c, port[:]); err != nil {
+		return "", 0, err
+	}
+	return host, int(binary.BigEndian.Uint16(port[:])), nil
+}
+
+// socksReply sends a SOCKS5 reply with an unspecified bound address.
+func socksReply(c net.Conn, code byte) error {
+	_, err := c.Write([]byte{socksVersion, code, 0, socksAtypIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// socksHeader is the stream header of a SOCKS stream: port 0, then the
+// destination as uint16 length + "host:port".
+func socksHeader(dest string) []byte {
+	b := binary.BigEndian.AppendUint16(nil, 0)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(dest)))
+	return append(b, dest...)
+}
+
+// readSocksDest reads the destination that follows a port-0 stream header.
+func readSocksDest(stream net.Conn) (string, int, error) {
+	stream.SetReadDeadline(time.Now().Add(streamHeaderTimeout))
+	defer stream.SetReadDeadline(time.Time{})
+	var n [2]byte
+	if _, err := io.ReadFull(stream, n[:]); err != nil {
+		return "", 0, err
+	}
+	dest := make([]byte, binary.BigEndian.Uint16(n[:]))
+	if _, err := io.ReadFull(stream, dest); err != nil {
+		return "", 0, err
+	}
+	host, port, err := net.SplitHostPort(string(dest))
+	if err != nil {
+		return "", 0, err
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 1 || p > 65535 {
+		return "", 0, fmt.Errorf("invalid SOCKS destination %q", dest)
+	}
+	return host, p, nil
+}
+
+// socksDialStatus maps a dial error to the SOCKS reply code sent back.
+func socksDialStatus(err error) byte {
+	switch {
+	case errors.Is(err, errSocksDenied):
+		return socksNotAllowed
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return socksRefused
+	}
+	return socksHostUnreachable
+}
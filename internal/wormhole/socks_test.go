@@ -0,0 +1,115 @@
+package wormhole
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDialPolicy(t *testing.T) {
+	p, err := ParseDialPolicy("!10.0.0.1, 10.0.0.0/8, 192.168.1.5:22, *.corp.example:443, db.internal, fc00::/7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		host string
+		port int
+		ok   bool
+	}{
+		{"10.1.2.3", 80, true},
+		{"10.0.0.1", 80, false},
+		{"192.168.1.5", 22, true},
+		{"192.168.1.5", 80, false},
+		{"git.corp.example", 443, true},
+		{"git.corp.example", 80, false},
+		{"corp.example", 443, false},
+		{"DB.Internal", 5432, true},
+		{"fd00::1", 80, true},
+		{"8.8.8.8", 53, false},
+		{"127.0.0.1", 22, false},
+	}
+	for _, tt := range tests {
+		_, err := p.resolve(context.Background(), tt.host, tt.port)
+		if (err == nil) != tt.ok {
+			t.Errorf("resolve(%s, %d) error = %v, want allowed %v", tt.host, tt.port, err, tt.ok)
+		}
+	}
+	for _, bad := range []string{"", "10.0.0.0/33", "host:0", "a*b", "!"} {
+		if _, err := ParseDialPolicy(bad); err == nil {
+			t.Errorf("ParseDialPolicy(%q) succeeded", bad)
+		}
+	}
+}
+
+// socksConnect runs a SOCKS5 CONNECT to dest through the proxy at addr and
+// returns the connection and the reply code.
+func socksConnect(t *testing.T, addr, host string, port int) (net.Conn, byte) {
+	t.Helper()
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetDeadline(time.Now().Add(10 * time.Second))
+	req := []byte{socksVersion, 1, socksNoAuth, socksVersion, socksCmdConnect, 0, socksAtypDomain, byte(len(host))}
+	req = binary.BigEndian.AppendUint16(append(req, host...), uint16(port))
+	if _, err := c.Write(req); err != nil {
+		t.Fatal(err)
+	}
+	var resp [12]byte // method selection + reply with an IPv4 address
+	if _, err := io.ReadFull(c, resp[:]); err != nil {
+		t.Fatalf("SOCKS reply: %v", err)
+	}
+	c.SetDeadline(time.Time{})
+	return c, resp[3]
+}
+
+func TestTunnelSocks(t *testing.T) {
+	relay := startRelay(t)
+	allowed, denied := startEcho(t, "ok:"), startEcho(t, "no:")
+	policy, err := ParseDialPolicy("localhost:" + allowed + ",127.0.0.1:" + allowed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bind := freeAddr(t)
+	binds, err := ParseTunnelBinds(bind + "=socks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ExposeTunnel(relay, "t024", nil, &TunnelOptions{Socks: policy})
+	go ConnectTunnel(relay, "t024", binds, nil)
+
+	var c net.Conn
+	var code byte
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if probe, err := net.Dial("tcp", bind); err == nil {
+			probe.Close()
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("SOCKS bind never came up: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	p, _ := strconv.Atoi(allowed)
+	if c, code = socksConnect(t, bind, "localhost", p); code != socksOK {
+		t.Fatalf("CONNECT to allowed destination: reply %d", code)
+	}
+	c.Write([]byte("hello\n"))
+	line, err := bufio.NewReader(c).ReadString('\n')
+	if err != nil || line != "ok:hello\n" {
+		t.Errorf("echo through SOCKS = %q, %v", line, err)
+	}
+	c.Close()
+
+	p, _ = strconv.Atoi(denied)
+	c, code = socksConnect(t, bind, "127.0.0.1", p)
+	c.Close()
+	if code != socksNotAllowed {
+		t.Errorf("CONNECT to denied destination: reply %d, want %d", code, socksNotAllowed)
+	}
+}
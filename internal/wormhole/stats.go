@@ -0,0 +1,182 @@
+package wormhole
+
+import (
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/A-Flex-Box/cli/internal/doctor/instrument"
+)
+
+const (
+	// statsWindow is the sliding window throughput is averaged over.
+	statsWindow = 3 * time.Second
+	// sparkLen is how many per-second session rates the sparkline keeps.
+	sparkLen = 40
+	// maxStreamHistory is how many closed streams keep their final counters.
+	maxStreamHistory = 100
+)
+
+// TunnelStats counts bytes per forwarded stream for the tunnel UI. Each joined
+// connection registers while it is open and moves to the history when it
+// closes; Sample turns the counters into rates. Safe for concurrent use.
+type TunnelStats struct {
+	mu         sync.Mutex
+	opened     int
+	active     []*streamStat // open streams, oldest first
+	history    []StreamSnapshot
+	closedUp   int64 // bytes of streams already closed
+	closedDown int64
+	sampled    int64 // session total at the last Sample
+	speed      *instrument.SpeedCalculator
+	spark      []float64
+}
+
+// NewTunnelStats returns an empty TunnelStats.
+func NewTunnelStats() *TunnelStats {
+	return &TunnelStats{speed: instrument.NewSpeedCalculator(statsWindow, 0)}
+}
+
+// StreamSnapshot is one stream's counters at a point in time. Up is what the
+// connecting client sent towards the service, Down what came back.
+type StreamSnapshot struct {
+	ID       int
+	Remote   string // client address, or the target on the expose side
+	Protocol string // as sniffed from the first bytes; "" until known
+	Up       int64
+	Down     int64
+	Started  time.Time
+	Duration time.Duration
+	Rate     float64 // bytes/s over statsWindow, or the average once closed
+	Closed   bool
+}
+
+// StatsSample is the state of a TunnelStats when it was sampled.
+type StatsSample struct {
+	Active  []StreamSnapshot // open streams, oldest first
+	History []StreamSnapshot // closed streams, newest first
+	Opened  int              // streams seen since the tunnel started
+	Up      int64            // session totals, open and closed streams alike
+	Down    int64
+	Rate    float64   // session throughput in bytes/s
+	Spark   []float64 // session throughput at each Sample, oldest first
+}
+
+// streamStat is the live state of one stream.
+type streamStat struct {
+	id       int
+	remote   string
+	protocol string
+	started  time.Time
+	mon      *instrument.TrafficMonitor
+	speed    *instrument.SpeedCalculator
+	sampled  int64
+	kill     func()
+}
+
+// open registers a stream from remote whose client side is rw, and kill closes.
+// Reads from the returned monitor count as up, writes to it as down.
+func (s *TunnelStats) open(remote string, rw io.ReadWriter, kill func()) *streamStat {
+	st := &streamStat{
+		remote:  remote,
+		started: time.Now(),
+		kill:    kill,
+		mon:     instrument.NewTrafficMonitor(instrument.TrafficMonitorConfig{RW: rw}),
+		speed:   instrument.NewSpeedCalculator(statsWindow, 0),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opened++
+	st.id = s.opened
+	s.active = append(s.active, st)
+	return st
+}
+
+// setProtocol records what the sniffer made of a stream.
+func (s *TunnelStats) setProtocol(st *streamStat, protocol string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st.protocol = protocol
+}
+
+// close moves a stream to the history with its final counters.
+func (s *TunnelStats) close(st *streamStat) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.Index(s.active, st)
+	if i < 0 {
+		return
+	}
+	s.active = slices.Delete(s.active, i, i+1)
+	snap := st.snapshot(time.Now())
+	snap.Closed = true
+	if secs := snap.Duration.Seconds(); secs > 0 {
+		snap.Rate = float64(snap.Up+snap.Down) / secs
+	}
+	s.closedUp += snap.Up
+	s.closedDown += snap.Down
+	s.history = append(s.history, snap)
+	if len(s.history) > maxStreamHistory {
+		s.history = s.history[len(s.history)-maxStreamHistory:]
+	}
+}
+
+// Kill closes the open stream with the given ID, reporting whether there was one.
+func (s *TunnelStats) Kill(id int) bool {
+	s.mu.Lock()
+	i := slices.IndexFunc(s.active, func(st *streamStat) bool { return st.id == id })
+	var kill func()
+	if i >= 0 {
+		kill = s.active[i].kill
+	}
+	s.mu.Unlock()
+	if kill == nil {
+		return false
+	}
+	kill()
+	return true
+}
+
+// Sample records the bytes moved since the last call, for the rates and the
+// sparkline, and returns the current state. The UI calls it once a second.
+func (s *TunnelStats) Sample() StatsSample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	out := StatsSample{Opened: s.opened, Up: s.closedUp, Down: s.closedDown}
+	for _, st := range s.active {
+		up, down := st.mon.Stats()
+		st.speed.Record(up + down - st.sampled)
+		st.sampled = up + down
+		out.Up += up
+		out.Down += down
+		out.Active = append(out.Active, st.snapshot(now))
+	}
+	total := out.Up + out.Down
+	s.speed.Record(total - s.sampled)
+	s.sampled = total
+	out.Rate = s.speed.BytesPerSec()
+	s.spark = append(s.spark, out.Rate)
+	if len(s.spark) > sparkLen {
+		s.spark = s.spark[len(s.spark)-sparkLen:]
+	}
+	out.Spark = slices.Clone(s.spark)
+	out.History = slices.Clone(s.history)
+	slices.Reverse(out.History)
+	return out
+}
+
+func (st *streamStat) snapshot(now time.Time) StreamSnapshot {
+	up, down := st.mon.Stats()
+	return StreamSnapshot{
+		ID:       st.id,
+		Remote:   st.remote,
+		Protocol: st.protocol,
+		Up:       up,
+		Down:     down,
+		Started:  st.started,
+		Duration: now.Sub(st.started),
+		Rate:     st.speed.BytesPerSec(),
+	}
+}
@@ -0,0 +1,48 @@
+package wormhole
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTunnelStats(t *testing.T) {
+	relay := startRelay(t)
+	port := startEcho(t, "raw:")
+	targets, _ := ParseTunnelTargets(port)
+	stats := NewTunnelStats()
+	connectEv := make(chan UIEvent, 64)
+	bind := freeAddr(t)
+	go ExposeTunnel(relay, "t027", targets, nil)
+	go ConnectTunnel(relay, "t027", []TunnelBind{{Local: bind, Remote: port}}, &TunnelOptions{Events: connectEv, Stats: stats})
+	waitEvent(t, connectEv, EventListen)
+
+	echoThrough(t, bind, "raw:", "GET / HTTP/1.1")
+	waitEvent(t, connectEv, EventConnClose)
+
+	s := stats.Sample()
+	if s.Opened != 1 || len(s.Active) != 0 || len(s.History) != 1 {
+		t.Fatalf("Sample() = %d opened, %d active, %d closed", s.Opened, len(s.Active), len(s.History))
+	}
+	h := s.History[0]
+	if h.Up != int64(len("GET / HTTP/1.1\n")) || h.Down != int64(len("raw:GET / HTTP/1.1\n")) || h.Protocol != "HTTP" || !h.Closed {
+		t.Errorf("closed stream = %+v", h)
+	}
+	if s.Up != h.Up || s.Down != h.Down || len(s.Spark) != 1 {
+		t.Errorf("totals = ↑%d ↓%d, spark %v", s.Up, s.Down, s.Spark)
+	}
+}
+
+func TestStatsFormatting(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		42 * time.Second:                   "42s",
+		3*time.Minute + 7*time.Second:      "3m07s",
+		2*time.Hour + 5*time.Minute + 59e9: "2h05m",
+	} {
+		if got := shortDuration(d); got != want {
+			t.Errorf("shortDuration(%s) = %q, want %q", d, got, want)
+		}
+	}
+	if got := sparkline([]float64{9, 0, 4, 8}, 3); got != "▁▄█" {
+		t.Errorf("sparkline() = %q", got)
+	}
+}
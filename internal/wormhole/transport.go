@@ -0,0 +1,202 @@
+package wormhole
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Relay address schemes.
+const (
+	SchemeTCP = "tcp"
+	SchemeTLS = "tls"
+	SchemeWS  = "ws"
+	SchemeWSS = "wss"
+)
+
+// relayDialTimeout bounds the TCP connect and TLS handshake to the relay.
+const relayDialTimeout = 15 * time.Second
+
+// relayEndpoint is a parsed relay address:
+// "[scheme://][token@]host:port[/path][?pin=<sha256 hex>]".
+type relayEndpoint struct {
+	scheme string // SchemeTCP, SchemeTLS, SchemeWS or SchemeWSS
+	addr   string // host:port
+	path   string // WebSocket path (ws/wss only)
+	token  string // relay access token (URL userinfo)
+	pin    string // hex SHA-256 of the relay certificate's public key (tls/wss only)
+}
+
+// parseRelayEndpoint parses a relay address. A missing scheme means tcp.
+func parseRelayEndpoint(addr string) (*relayEndpoint, error) {
+	addr = strings.TrimSpace(addr)
+	if !strings.Contains(addr, "://") {
+		addr = SchemeTCP + "://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid relay address: %w", err)
+	}
+	ep := &relayEndpoint{scheme: strings.ToLower(u.Scheme), addr: u.Host}
+	switch ep.scheme {
+	case SchemeTCP, SchemeTLS:
+	case SchemeWS, SchemeWSS:
+		ep.path = u.Path
+		if ep.path == "" || ep.path == "/" {
+			ep.path = DefaultWebSocketPath
+		}
+	default:
+		return nil, fmt.Errorf("unsupported relay scheme %q (use tcp://, tls://, ws:// or wss://)", u.Scheme)
+	}
+	if ep.addr == "" {
+		return nil, fmt.Errorf("relay address %q has no host", MaskRelayAddr(addr))
+	}
+	if u.User != nil {
+		ep.token = u.User.Username()
+	}
+	ep.pin = strings.ToLower(u.Query().Get("pin"))
+	if ep.pin != "" && ep.scheme != SchemeTLS && ep.scheme != SchemeWSS {
+		return nil, errors.New("relay certificate pin requires a tls:// or wss:// address")
+	}
+	return ep, nil
+}
+
+// dial opens the transport connection to the relay.
+func (ep *relayEndpoint) dial() (net.Conn, error) {
+	d := &net.Dialer{Timeout: relayDialTimeout}
+	switch ep.scheme {
+	case SchemeTLS:
+		return tls.DialWithDialer(d, "tcp", ep.addr, ep.tlsConfig())
+	case SchemeWS, SchemeWSS:
+		return ep.dialWebSocket(d)
+	}
+	return d.Dial("tcp", ep.addr)
+}
+
+// tlsConfig verifies the relay against system roots, or only against the pin
+// when one is given (self-signed relays).
+func (ep *relayEndpoint) tlsConfig() *tls.Config {
+	host, _, err := net.SplitHostPort(ep.addr)
+	if err != nil {
+		host = ep.addr
+	}
+	cfg := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if ep.pin != "" {
+		pin := ep.pin
+		cfg.InsecureSkipVerify = true // replaced by the pin check below
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("wormhole: relay sent no certificate")
+			}
+			got := CertPin(cs.PeerCertificates[0])
+			if subtle.ConstantTimeCompare([]byte(got), []byte(pin)) != 1 {
+				return fmt.Errorf("wormhole: relay certificate pin mismatch (got %s)", got)
+			}
+			return nil
+		}
+	}
+	return cfg
+}
+
+// CertPin returns the hex SHA-256 of a certificate's public key, the value
+// clients pass as "?pin=" for self-signed relays. It survives certificate
+// renewal as long as the key is kept.
+func CertPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseRelayAddr parses "scheme://[token@]host:port[?pin=...]" to host:port.
+func ParseRelayAddr(addr string) (string, error) {
+	ep, err := parseRelayEndpoint(addr)
+	if err != nil {
+		return "", err
+	}
+	return ep.addr, nil
+}
+
+// MaskRelayAddr hides the access token of a relay address for display.
+func MaskRelayAddr(addr string) string {
+	if i := strings.LastIndexByte(addr, '@'); i >= 0 {
+		j := strings.Index(addr, "://")
+		if j < 0 || j > i {
+			j = 0
+		} else {
+			j += 3
+		}
+		return addr[:j] + "***" + addr[i:]
+	}
+	return addr
+}
+
+// LoadOrCreateRelayCert loads a relay certificate and key from PEM files. When
+// selfSigned is set and the files do not exist yet, it generates an ECDSA P-256
+// self-signed certificate and writes it there, so the pin stays stable across
+// restarts.
+func LoadOrCreateRelayCert(certFile, keyFile string, selfSigned bool) (tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err == nil || !selfSigned || !errors.Is(err, fs.ErrNotExist) {
+		return cert, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "wormhole relay"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(certFile), 0700); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.LoadX509KeyPair(certFile, keyFile)
+}
+
+// RelayTLSConfig returns the server TLS config for a relay listener.
+func RelayTLSConfig(cert tls.Certificate) *tls.Config {
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+}
@@ -1,9 +1,13 @@
 package wormhole
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/A-Flex-Box/cli/internal/logger"
@@ -17,80 +21,323 @@ const (
 	EventConnOpen UIEventType = iota
 	EventConnClose
 	EventTraffic
+	EventPath
+	EventSAS
+	EventConfirmSAS
+	EventLinkDown     // Session dropped; a reconnecting tunnel redials
+	EventReconnecting // Redial attempt started
+	EventReconnected  // Session is back
+	EventListen       // Local side of the tunnel is known: targets or binds (Msg lists them)
+	EventHTTP         // An HTTP exchange completed (TunnelOptions.InspectHTTP)
 )
 
 // UIEvent is sent to the tunnel TUI for display.
 type UIEvent struct {
 	Type   UIEventType
-	Msg    string       // Display string
-	Info   *TrafficInfo // For EventTraffic
-	Remote string       // Optional: remote addr
+	Msg    string        // Display string
+	Info   *TrafficInfo  // For EventTraffic
+	Path   *PathInfo     // For EventPath
+	SAS    *SAS          // For EventSAS and EventConfirmSAS
+	Reply  chan<- bool   // For EventConfirmSAS: true when the user confirms
+	Remote string        // Optional: remote addr
+	HTTP   *HTTPExchange // For EventHTTP
+
+	Attempt int       // For EventReconnecting and EventReconnected: attempt number
+	Since   time.Time // For reconnect events: when the session dropped
 }
 
 // TunnelOptions holds optional settings for tunnel UI events.
 type TunnelOptions struct {
-	Events chan<- UIEvent // If non-nil, tunnel sends UI events here
+	Events   chan<- UIEvent // If non-nil, tunnel sends UI events here
+	NoDirect bool           // Stay on the relay even when a LAN path exists
+	Limit    *Limiter       // Bandwidth cap for the whole tunnel; may change while running
+
+	ConfirmSAS func(SAS) bool // Asks the user whether both sides show the same SAS
+	VerifySAS  bool           // Require ConfirmSAS to return true before the tunnel starts
+
+	// Reconnect keeps the tunnel alive across relay or network drops: both sides
+	// redial the same code with backoff, and connect keeps its listener open,
+	// holding new local connections for up to reconnectQueueTimeout.
+	Reconnect bool
+
+	// Socks, on the expose side, also accepts SOCKS streams: the connect side
+	// runs a local SOCKS5 server and the expose side dials each CONNECT
+	// destination the policy allows.
+	Socks *DialPolicy
+
+	// InspectHTTP, on the expose side, parses forwarded connections as HTTP and
+	// reports every exchange as an EventHTTP for the inspector.
+	InspectHTTP bool
+
+	// MaxStreams, OneShot and TTL limit an expose side: at most MaxStreams
+	// streams at once (0 for no limit), only a first stream with OneShot,
+	// ending the tunnel when it closes, and no tunnel past TTL after the first
+	// session opened, reconnects included. Streams over a limit are closed.
+	MaxStreams int
+	OneShot    bool
+	TTL        time.Duration
+
+	// IdleTimeout closes a stream once nothing has moved either way for this long.
+	IdleTimeout time.Duration
+
+	// Stats, if non-nil, counts the bytes of every forwarded stream for the
+	// stream table; set by RunTunnelUI.
+	Stats *TunnelStats
+}
+
+func (o *TunnelOptions) reconnect() bool {
+	return o != nil && o.Reconnect
 }
 
-// ExposeTunnel dials relay, performs PAKE (sender), sends ModeTunnel, then runs StartExpose.
-// Blocks until the tunnel is closed. opts may be nil.
-func ExposeTunnel(relayAddr, code, targetPort string, opts *TunnelOptions) error {
-	logger.Info("tunnel.expose DialRelay", logger.Context("params", map[string]any{"relay": relayAddr, "code": code})...)
-	conn, err := DialRelay(relayAddr, code, true)
+func (o *TunnelOptions) socks() *DialPolicy {
+	if o == nil {
+		return nil
+	}
+	return o.Socks
+}
+
+func (o *TunnelOptions) idleTimeout() time.Duration {
+	if o == nil {
+		return 0
+	}
+	return o.IdleTimeout
+}
+
+func (o *TunnelOptions) stats() *TunnelStats {
+	if o == nil {
+		return nil
+	}
+	return o.Stats
+}
+
+// openTunnel opens a session for a tunnel, applies the bandwidth limit, reports
+// its path and SAS as events and, with VerifySAS, waits for confirmation.
+func openTunnel(relayAddr, code string, isSender bool, opts *TunnelOptions) (*SecureConn, error) {
+	secure, path, err := openSession(relayAddr, code, code, isSender, opts != nil && opts.NoDirect)
 	if err != nil {
-		logger.Warn("tunnel.expose DialRelay failed", logger.Context("params", map[string]any{"error": err.Error()})...)
-		return err
+		return nil, err
 	}
-	defer conn.Close()
+	sendEvent(evChan(opts), UIEvent{Type: EventPath, Msg: path.String(), Path: &path})
+	if opts != nil {
+		secure.SetLimiter(opts.Limit)
+		sas := secure.SAS()
+		sendEvent(opts.Events, UIEvent{Type: EventSAS, Msg: sas.String(), SAS: &sas})
+		if err := confirmSAS(sas, opts.VerifySAS, opts.ConfirmSAS); err != nil {
+			secure.Close()
+			return nil, err
+		}
+	}
+	return secure, nil
+}
 
-	logger.Info("tunnel.expose PAKE upgrade (sender)", logger.Context("params", map[string]any{"remote": conn.RemoteAddr().String()})...)
-	secure, err := UpgradeConn(conn, code, true)
+// ExposeTunnel opens a session (PAKE as sender, direct when possible), sends ModeTunnel
+// and the exposed targets, then forwards each stream to the target whose port it names.
+// targets is also the allowlist: streams asking for any other port are refused. With
+// opts.Socks, SOCKS streams are dialed to destinations the policy allows. Blocks
+// until the tunnel is closed, or with opts.Reconnect until the peer turns out
+// incompatible; a tunnel ended by opts.TTL or opts.OneShot returns nil. opts may be nil.
+func ExposeTunnel(relayAddr, code string, targets []TunnelTarget, opts *TunnelOptions) error {
+	socks := opts.socks()
+	if len(targets) == 0 && socks == nil {
+		return fmt.Errorf("wormhole: nothing to expose")
+	}
+	logger.Info("tunnel.expose open session", logger.Context("params", map[string]any{"relay": MaskRelayAddr(relayAddr), "code": code})...)
+	sendEvent(evChan(opts), UIEvent{Type: EventListen, Msg: describeExposed(targets, socks)})
+	secure, err := openTunnel(relayAddr, code, true, opts)
 	if err != nil {
-		logger.Warn("tunnel.expose UpgradeConn failed", logger.Context("params", map[string]any{"error": err.Error()})...)
+		logger.Warn("tunnel.expose open session failed", logger.Context("params", map[string]any{"error": err.Error()})...)
+		return err
+	}
+	setup := func(s *SecureConn) error { return sendTunnelMode(s, targets, socks != nil) }
+	if err := setup(secure); err != nil {
+		secure.Close()
 		return err
 	}
-	defer secure.Close()
+	rejoin := secure.rejoin
+	gate := newExposeGate(opts)
+	for {
+		logger.Info("tunnel.expose mode sent, starting yamux server", logger.Context("params", map[string]any{"targets": describeExposed(targets, socks)})...)
+		err := serveExpose(secure, targets, usesPortHeaders(secure), gate, opts)
+		secure.Close()
+		if gate.ended() != "" {
+			return exposeEnded(gate, opts)
+		}
+		if !opts.reconnect() {
+			return err
+		}
+		tunnelDown(opts.Events, err)
+		// The gate can end the tunnel during the outage too (TTL, one-shot).
+		if secure, err = redialTunnel(relayAddr, code, rejoin, true, opts, gate.done, setup); err != nil {
+			if errors.Is(err, errRedialStopped) {
+				return exposeEnded(gate, opts)
+			}
+			return err
+		}
+	}
+}
+
+// exposeEnded reports why gate ended the tunnel; ExposeTunnel then returns nil.
+func exposeEnded(gate *exposeGate, opts *TunnelOptions) error {
+	why := gate.ended()
+	sendEvent(evChan(opts), UIEvent{Type: EventTraffic, Msg: "[Closed] " + why})
+	logger.Info("tunnel.expose ended", logger.Context("params", map[string]any{"reason": why})...)
+	return nil
+}
 
+// sendTunnelMode tells the receiver this session is a tunnel and, from protocol
+// v3, which ports it may connect to and whether it accepts SOCKS streams.
+func sendTunnelMode(secure *SecureConn, targets []TunnelTarget, socks bool) error {
+	caps := secure.Capabilities()
+	if err := caps.requireMode(ModeTunnel, "tunnels"); err != nil {
+		return err
+	}
+	if !usesPortHeaders(secure) && socks {
+		return fmt.Errorf("%w: peer (%s, protocol v%d) does not support SOCKS tunnels; upgrade it", ErrIncompatiblePeer, caps.Peer, caps.Version)
+	}
+	if !usesPortHeaders(secure) && len(targets) > 1 {
+		return fmt.Errorf("%w: peer (%s, protocol v%d) can only connect to one target; upgrade it or expose a single one", ErrIncompatiblePeer, caps.Peer, caps.Version)
+	}
 	if _, err := secure.Write([]byte{ModeTunnel}); err != nil {
 		logger.Warn("tunnel.expose write ModeTunnel failed", logger.Context("params", map[string]any{"error": err.Error()})...)
 		return err
 	}
-	logger.Info("tunnel.expose mode sent, starting yamux server", logger.Context("params", map[string]any{"target_port": targetPort})...)
-	return StartExpose(secure, targetPort, opts)
+	if usesPortHeaders(secure) {
+		tp := &TunnelPorts{Socks: socks}
+		for _, t := range targets {
+			tp.Ports = append(tp.Ports, t.Port)
+			tp.Names = append(tp.Names, t.String())
+		}
+		return WriteTunnelPorts(secure, tp)
+	}
+	return nil
 }
 
-// ConnectTunnel dials relay, performs PAKE (receiver), reads mode byte, then runs StartConnect.
-// If mode is ModeFile, returns an error. Blocks until the tunnel is closed. opts may be nil.
-func ConnectTunnel(relayAddr, code, bindAddr string, opts *TunnelOptions) error {
-	logger.Info("tunnel.connect DialRelay", logger.Context("params", map[string]any{"relay": relayAddr, "code": code})...)
-	conn, err := DialRelay(relayAddr, code, false)
+// ConnectTunnel opens a session (PAKE as receiver, direct when possible), reads the
+// mode byte and the exposed ports, listens on each bind (TCP or a Unix socket) and
+// forwards its connections to the matching remote port, or serves SOCKS5 on binds to
+// "socks". With no binds every exposed port is bound on 127.0.0.1 under the same
+// number, and SOCKS on 127.0.0.1:1080 if offered. If mode is ModeFile, returns an error. Blocks
+// until the tunnel is closed. With opts.Reconnect the listeners stay open across
+// drops while the session is redialed, unless the expose side ended the tunnel.
+// opts may be nil.
+func ConnectTunnel(relayAddr, code string, binds []TunnelBind, opts *TunnelOptions) error {
+	logger.Info("tunnel.connect open session", logger.Context("params", map[string]any{"relay": MaskRelayAddr(relayAddr), "code": code})...)
+	secure, err := openTunnel(relayAddr, code, false, opts)
 	if err != nil {
-		logger.Warn("tunnel.connect DialRelay failed", logger.Context("params", map[string]any{"error": err.Error()})...)
+		logger.Warn("tunnel.connect open session failed", logger.Context("params", map[string]any{"error": err.Error()})...)
 		return err
 	}
-	defer conn.Close()
-
-	logger.Info("tunnel.connect PAKE upgrade (receiver)", logger.Context("params", map[string]any{"remote": conn.RemoteAddr().String()})...)
-	secure, err := UpgradeConn(conn, code, false)
+	tp, err := readTunnelMode(secure)
+	if err == nil {
+		binds, err = resolveBinds(binds, tp.ports(), tp.socks())
+	}
 	if err != nil {
-		logger.Warn("tunnel.connect UpgradeConn failed", logger.Context("params", map[string]any{"error": err.Error()})...)
+		secure.Close()
 		return err
 	}
-	defer secure.Close()
+	logger.Info("tunnel.connect mode received, starting yamux client", logger.Context("params", map[string]any{"binds": describeBinds(binds, tp)})...)
+
+	ev := evChan(opts)
+	listeners := make([]net.Listener, 0, len(binds))
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+	for _, b := range binds {
+		l, err := listenBind(b.Local)
+		if err != nil {
+			secure.Close()
+			return err
+		}
+		listeners = append(listeners, l)
+	}
+	logger.Info("tunnel.connect listening", logger.Context("params", map[string]any{
+		"binds": describeBinds(binds, tp), "reconnect": opts.reconnect(),
+	})...)
+	sendEvent(ev, UIEvent{Type: EventListen, Msg: describeBinds(binds, tp)})
 
+	link := newTunnelLink()
+	var wait time.Duration
+	if opts.reconnect() {
+		wait = reconnectQueueTimeout
+	}
+	for i, l := range listeners {
+		if binds[i].Remote == socksRemote {
+			go serveSocks(l, link, wait, opts)
+			continue
+		}
+		var header []byte
+		if tp != nil {
+			header = portHeader(binds[i].Remote)
+		}
+		go serveConnect(l, link, wait, header, opts)
+	}
+
+	rejoin := secure.rejoin
+	setup := func(s *SecureConn) error {
+		_, err := readTunnelMode(s)
+		return err
+	}
+	for {
+		session, err := yamux.Client(secure, yamuxConfig)
+		if err != nil {
+			secure.Close()
+			return err
+		}
+		ended := watchTunnelEnded(session)
+		link.set(session)
+		<-session.CloseChan()
+		link.set(nil)
+		secure.Close()
+		select {
+		case <-ended:
+			sendEvent(ev, UIEvent{Type: EventTraffic, Msg: "[Closed] peer ended the tunnel"})
+			logger.Info("tunnel.connect peer ended the tunnel")
+			return nil
+		default:
+		}
+		if !opts.reconnect() {
+			logger.Info("tunnel.connect session closed (secure conn closed by peer or network)")
+			return nil
+		}
+		tunnelDown(ev, nil)
+		if secure, err = redialTunnel(relayAddr, code, rejoin, false, opts, nil, setup); err != nil {
+			return err
+		}
+	}
+}
+
+// readTunnelMode reads the sender's mode byte and checks it is ModeTunnel. From
+// protocol v3 it also reads the exposed ports; for older peers they are nil.
+func readTunnelMode(secure *SecureConn) (*TunnelPorts, error) {
 	mode := make([]byte, 1)
 	if _, err := io.ReadFull(secure, mode); err != nil {
 		logger.Warn("tunnel.connect read mode failed", logger.Context("params", map[string]any{"error": err.Error()})...)
-		return err
+		return nil, err
 	}
 	if mode[0] == ModeFile {
-		return fmt.Errorf("peer is in file transfer mode, not tunnel mode")
+		return nil, fmt.Errorf("peer is in file transfer mode, not tunnel mode")
 	}
 	if mode[0] != ModeTunnel {
-		return fmt.Errorf("unknown mode byte: %d", mode[0])
+		return nil, fmt.Errorf("unknown mode byte: %d", mode[0])
 	}
-	logger.Info("tunnel.connect mode received, starting yamux client", logger.Context("params", map[string]any{"bind_addr": bindAddr})...)
-	return StartConnect(secure, bindAddr, opts)
+	if !usesPortHeaders(secure) {
+		return nil, nil
+	}
+	tp, err := ReadTunnelPorts(secure)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range tp.Ports {
+		if _, err := parsePort(p); err != nil {
+			return nil, fmt.Errorf("wormhole: peer exposes invalid port: %w", err)
+		}
+	}
+	if len(tp.Ports) == 0 && !tp.Socks {
+		return nil, fmt.Errorf("wormhole: peer exposes no ports")
+	}
+	return tp, nil
 }
 
 // yamuxConfig enables keepalive to prevent Relay/NAT from killing idle connections.
@@ -103,17 +350,33 @@ var yamuxConfig = func() *yamux.Config {
 
 // StartExpose creates a yamux server on the secure connection and forwards
 // incoming streams to the local targetPort. Blocks until secureConn is closed.
-// opts may be nil.
+// Streams carry no port header, as with peers before protocol v3. opts may be nil.
 func StartExpose(secureConn net.Conn, targetPort string, opts *TunnelOptions) error {
+	return serveExpose(secureConn, []TunnelTarget{localTarget(targetPort)}, false, newExposeGate(opts), opts)
+}
+
+// serveExpose runs the yamux server of an expose side. With headers each stream
+// names the port of its target, which must be in targets; without, all go to targets[0].
+// Streams the gate refuses are closed, and the session ends when the gate is done.
+func serveExpose(secureConn net.Conn, targets []TunnelTarget, headers bool, gate *exposeGate, opts *TunnelOptions) error {
 	session, err := yamux.Server(secureConn, yamuxConfig)
 	if err != nil {
 		return err
 	}
 	defer session.Close()
+	go func() {
+		select {
+		case <-gate.done:
+			if headers {
+				sendTunnelEnded(session)
+			}
+			session.Close()
+		case <-session.CloseChan():
+		}
+	}()
 
-	ev := evChan(opts)
 	logger.Info("tunnel.expose session started", logger.Context("params", map[string]any{
-		"target_port": targetPort,
+		"targets": describeTargets(targets), "port_headers": headers,
 	})...)
 
 	for {
@@ -126,24 +389,112 @@ func StartExpose(secureConn net.Conn, targetPort string, opts *TunnelOptions) er
 			logger.Warn("tunnel.expose accept error", logger.Context("params", map[string]any{"error": err.Error(), "session_closed": session.IsClosed()})...)
 			return err
 		}
+		if ok, why := gate.admit(); !ok {
+			sendEvent(evChan(opts), UIEvent{Type: EventTraffic, Msg: "[DENY] stream refused: " + why})
+			logger.Warn("tunnel.expose stream refused", logger.Context("params", map[string]any{"reason": why})...)
+			stream.Close()
+			continue
+		}
+		go func() {
+			gate.release(forwardStream(stream, targets, headers, opts))
+		}()
+	}
+}
 
-		destAddr := "localhost:" + targetPort
-		destConn, err := net.Dial("tcp", destAddr)
+// forwardStream dials the target a stream asks for and joins the two. SOCKS
+// streams are handed to forwardSocks, or refused without opts.Socks. It reports
+// whether the stream reached its target, once the two are done.
+func forwardStream(stream net.Conn, targets []TunnelTarget, headers bool, opts *TunnelOptions) bool {
+	ev, socks := evChan(opts), opts.socks()
+	var target TunnelTarget
+	if !headers {
+		target = targets[0]
+	} else {
+		p, err := readPortHeader(stream)
 		if err != nil {
-			sendEvent(ev, UIEvent{Type: EventTraffic, Msg: "[FAIL] dial " + destAddr + ": " + err.Error()})
-			logger.Info("tunnel.expose dial target failed", logger.Context("params", map[string]any{
-				"target": destAddr, "error": err.Error(),
-			})...)
+			sendEvent(ev, UIEvent{Type: EventTraffic, Msg: "[FAIL] stream header: " + err.Error()})
 			stream.Close()
-			continue
+			return false
+		}
+		if p == "0" && socks != nil {
+			return forwardSocks(stream, opts)
 		}
+		i := slices.IndexFunc(targets, func(t TunnelTarget) bool { return t.Port == p })
+		if i < 0 {
+			sendEvent(ev, UIEvent{Type: EventTraffic, Msg: "[DENY] port " + p + " is not exposed"})
+			logger.Warn("tunnel.expose port denied", logger.Context("params", map[string]any{"port": p, "allowed": describeTargets(targets)})...)
+			stream.Close()
+			return false
+		}
+		target = targets[i]
+	}
 
-		sendEvent(ev, UIEvent{Type: EventConnOpen, Msg: "Client Connected", Remote: destAddr})
-		logger.Info("tunnel.expose stream forwarded", logger.Context("params", map[string]any{
-			"target": destAddr,
+	destAddr := target.String()
+	destConn, err := net.Dial(target.Network, target.Addr)
+	if err != nil {
+		sendEvent(ev, UIEvent{Type: EventTraffic, Msg: "[FAIL] dial " + destAddr + ": " + err.Error()})
+		logger.Info("tunnel.expose dial target failed", logger.Context("params", map[string]any{
+			"target": destAddr, "error": err.Error(),
 		})...)
-		go join(stream, destConn, ev)
+		stream.Close()
+		return false
 	}
+
+	sendEvent(ev, UIEvent{Type: EventConnOpen, Msg: "Client Connected", Remote: destAddr})
+	logger.Info("tunnel.expose stream forwarded", logger.Context("params", map[string]any{
+		"target": destAddr,
+	})...)
+	var tap *httpTap
+	if opts != nil && opts.InspectHTTP {
+		tap = newHTTPTap(target, ev)
+	}
+	join(stream, destConn, destAddr, opts, tap)
+	return true
+}
+
+// forwardSocks reads a SOCKS stream's destination, dials it if the policy
+// allows, answers with a SOCKS reply code and joins the two. It reports whether
+// the destination was reached, as forwardStream does.
+func forwardSocks(stream net.Conn, opts *TunnelOptions) bool {
+	ev, policy := evChan(opts), opts.socks()
+	host, port, err := readSocksDest(stream)
+	if err != nil {
+		sendEvent(ev, UIEvent{Type: EventTraffic, Msg: "[FAIL] socks header: " + err.Error()})
+		stream.Close()
+		return false
+	}
+	dest := net.JoinHostPort(host, strconv.Itoa(port))
+	ctx, cancel := context.WithTimeout(context.Background(), socksDialTimeout)
+	defer cancel()
+	addr, err := policy.resolve(ctx, host, port)
+	var destConn net.Conn
+	if err == nil {
+		destConn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		stream.Write([]byte{socksDialStatus(err)})
+		stream.Close()
+		if errors.Is(err, errSocksDenied) {
+			sendEvent(ev, UIEvent{Type: EventTraffic, Msg: "[DENY] socks " + dest + " is not allowed"})
+			logger.Warn("tunnel.expose socks destination denied", logger.Context("params", map[string]any{"dest": dest, "policy": policy.String()})...)
+			return false
+		}
+		sendEvent(ev, UIEvent{Type: EventTraffic, Msg: "[FAIL] socks dial " + dest + ": " + err.Error()})
+		logger.Info("tunnel.expose socks dial failed", logger.Context("params", map[string]any{"dest": dest, "error": err.Error()})...)
+		return false
+	}
+	if _, err := stream.Write([]byte{socksOK}); err != nil {
+		stream.Close()
+		destConn.Close()
+		return false
+	}
+
+	sendEvent(ev, UIEvent{Type: EventConnOpen, Msg: "Client Connected", Remote: "socks → " + dest})
+	logger.Info("tunnel.expose socks stream forwarded", logger.Context("params", map[string]any{
+		"dest": dest, "addr": addr,
+	})...)
+	join(stream, destConn, "socks → "+dest, opts, nil)
+	return true
 }
 
 func evChan(opts *TunnelOptions) chan<- UIEvent {
@@ -179,12 +530,30 @@ func StartConnect(secureConn net.Conn, bindAddr string, opts *TunnelOptions) err
 		return err
 	}
 	defer listener.Close()
+	// Stop accepting once the session is gone; nothing could be forwarded.
+	go func() {
+		<-session.CloseChan()
+		listener.Close()
+	}()
 
-	ev := evChan(opts)
 	logger.Info("tunnel.connect listening", logger.Context("params", map[string]any{
 		"bind_addr": bindAddr,
 	})...)
+	link := newTunnelLink()
+	link.set(session)
+	err = serveConnect(listener, link, 0, nil, opts)
+	if session.IsClosed() {
+		logger.Info("tunnel.connect session closed (secure conn closed by peer or network)")
+		return nil
+	}
+	return err
+}
 
+// serveConnect accepts local connections and joins each to a new stream on the
+// link's session, which starts with header when non-nil. While the link is down
+// a connection waits up to wait for it. Returns when listener is closed.
+func serveConnect(listener net.Listener, link *tunnelLink, wait time.Duration, header []byte, opts *TunnelOptions) error {
+	ev := evChan(opts)
 	for {
 		localConn, err := listener.Accept()
 		if err != nil {
@@ -198,35 +567,140 @@ func StartConnect(secureConn net.Conn, bindAddr string, opts *TunnelOptions) err
 			"remote": remote,
 		})...)
 
-		stream, err := session.Open()
-		if err != nil {
-			sendEvent(ev, UIEvent{Type: EventTraffic, Msg: "[FAIL] open stream: " + err.Error()})
-			logger.Info("tunnel.connect open stream failed", logger.Context("params", map[string]any{
-				"error": err.Error(),
+		go func() {
+			stream, err := openStream(link, wait, remote, ev)
+			if err != nil {
+				localConn.Close()
+				return
+			}
+			if header != nil {
+				if _, err := stream.Write(header); err != nil {
+					stream.Close()
+					localConn.Close()
+					return
+				}
+			}
+
+			logger.Info("tunnel.connect forwarding", logger.Context("params", map[string]any{
+				"local": remote,
 			})...)
-			localConn.Close()
-			continue
+			join(localConn, stream, remote, opts, nil)
+		}()
+	}
+}
+
+// serveSocks accepts local SOCKS5 clients and carries each CONNECT over a new
+// stream on the link's session; the expose side dials the destination and its
+// status becomes the SOCKS reply. Returns when listener is closed.
+func serveSocks(listener net.Listener, link *tunnelLink, wait time.Duration, opts *TunnelOptions) error {
+	ev := evChan(opts)
+	for {
+		localConn, err := listener.Accept()
+		if err != nil {
+			logger.Info("tunnel.connect socks accept error", logger.Context("params", map[string]any{"error": err.Error()})...)
+			return err
 		}
+		go func() {
+			localConn.SetDeadline(time.Now().Add(streamHeaderTimeout))
+			host, port, err := socksHandshake(localConn)
+			localConn.SetDeadline(time.Time{})
+			if err != nil {
+				sendEvent(ev, UIEvent{Type: EventTraffic, Msg: "[FAIL] socks: " + err.Error()})
+				localConn.Close()
+				return
+			}
+			dest := net.JoinHostPort(host, strconv.Itoa(port))
+			sendEvent(ev, UIEvent{Type: EventConnOpen, Msg: "Client Connected", Remote: "socks → " + dest})
+
+			stream, err := openStream(link, wait, localConn.RemoteAddr().String(), ev)
+			if err != nil {
+				socksReply(localConn, socksFailure)
+				localConn.Close()
+				return
+			}
+			status := []byte{socksFailure}
+			if _, err := stream.Write(socksHeader(dest)); err == nil {
+				io.ReadFull(stream, status)
+			}
+			socksReply(localConn, status[0])
+			if status[0] != socksOK {
+				sendEvent(ev, UIEvent{Type: EventTraffic, Msg: fmt.Sprintf("[FAIL] socks %s refused by peer (reply %d)", dest, status[0])})
+				stream.Close()
+				localConn.Close()
+				return
+			}
+			logger.Info("tunnel.connect socks forwarding", logger.Context("params", map[string]any{
+				"dest": dest,
+			})...)
+			join(localConn, stream, "socks → "+dest, opts, nil)
+		}()
+	}
+}
 
-		logger.Info("tunnel.connect forwarding", logger.Context("params", map[string]any{
-			"local": remote,
+// openStream opens a stream on the link's session for the local connection from
+// remote, waiting up to wait while the link is down.
+func openStream(link *tunnelLink, wait time.Duration, remote string, ev chan<- UIEvent) (net.Conn, error) {
+	if s, _ := link.current(); s == nil && wait > 0 {
+		sendEvent(ev, UIEvent{Type: EventTraffic, Msg: "[Queued] " + remote + " waits for the tunnel to reconnect"})
+	}
+	stream, err := link.open(wait)
+	if err != nil {
+		sendEvent(ev, UIEvent{Type: EventTraffic, Msg: "[FAIL] open stream: " + err.Error()})
+		logger.Info("tunnel.connect open stream failed", logger.Context("params", map[string]any{
+			"error": err.Error(),
 		})...)
-		go join(localConn, stream, ev)
+		return nil, err
 	}
+	return stream, nil
 }
 
-// join performs bidirectional copy between two connections with optional traffic sniffing.
-// Closes both when either side finishes. events may be nil.
-func join(c1, c2 net.Conn, events chan<- UIEvent) {
+// join performs bidirectional copy between two connections with optional traffic
+// sniffing, closing both when either side finishes or has been idle for
+// opts.IdleTimeout. c1 is the client side: with opts.Stats its bytes are counted
+// under remote, where the UI can also kill it, and tap, when non-nil, is fed
+// what c1 sends (requests) and what c2 sends (responses) in place of sniffing.
+// opts may be nil.
+func join(c1, c2 net.Conn, remote string, opts *TunnelOptions, tap *httpTap) {
+	events, stats := evChan(opts), opts.stats()
 	defer c1.Close()
 	defer c2.Close()
 	defer func() { sendEvent(events, UIEvent{Type: EventConnClose, Msg: "Client Disconnected"}) }()
 
 	var src1 io.Reader = c1
-	if events != nil {
-		src1 = NewSniffingReader(c1, func(info TrafficInfo) {
-			sendEvent(events, UIEvent{Type: EventTraffic, Msg: info.Raw, Info: &info})
+	var dst1 io.Writer = c1
+	var st *streamStat
+	if stats != nil {
+		st = stats.open(remote, c1, func() {
+			c1.Close()
+			c2.Close()
+		})
+		defer stats.close(st)
+		src1, dst1 = st.mon, st.mon
+	}
+	if events != nil || st != nil {
+		src1 = NewSniffingReader(src1, func(info TrafficInfo) {
+			if st != nil {
+				stats.setProtocol(st, info.Protocol)
+			}
+			if tap == nil { // with a tap, exchanges are reported in full instead
+				sendEvent(events, UIEvent{Type: EventTraffic, Msg: info.Raw, Info: &info})
+			}
+		})
+	}
+	var src2 io.Reader = c2
+	if tap != nil {
+		defer tap.close()
+		src1 = &tapReader{r: src1, tap: tap.req}
+		src2 = &tapReader{r: c2, tap: tap.resp}
+	}
+	if idle := opts.idleTimeout(); idle > 0 {
+		w := watchIdle(idle, func() {
+			sendEvent(events, UIEvent{Type: EventTraffic, Msg: "[Idle] " + remote + " closed after " + idle.String() + " without traffic"})
+			c1.Close()
+			c2.Close()
 		})
+		defer w.stop()
+		src1, src2 = w.reader(src1), w.reader(src2)
 	}
 
 	done := make(chan struct{}, 1)
@@ -238,7 +712,7 @@ func join(c1, c2 net.Conn, events chan<- UIEvent) {
 		done <- struct{}{}
 	}()
 	go func() {
-		io.Copy(c1, c2)
+		io.Copy(dst1, src2)
 		if tcp, ok := c1.(*net.TCPConn); ok {
 			tcp.CloseWrite()
 		}
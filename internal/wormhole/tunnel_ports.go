@@ -0,0 +1,346 @@
+package wormhole
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// streamHeaderTimeout bounds how long the expose side waits for a stream's port header.
+const streamHeaderTimeout = 10 * time.Second
+
+// unixScheme prefixes Unix socket paths in targets and binds.
+const unixScheme = "unix://"
+
+// firstUnixPort is the first port assigned to Unix socket targets given without one.
+const firstUnixPort = 10000
+
+// TunnelTarget is a service the expose side forwards to. Port identifies it to
+// the connect side: the target's own port for TCP, or one assigned to a socket.
+type TunnelTarget struct {
+	Port    string // Port the connect side asks for
+	Network string // "tcp" or "unix"
+	Addr    string // host:port, or the socket path
+}
+
+// localTarget is the classic target: a port on localhost.
+func localTarget(port string) TunnelTarget {
+	return TunnelTarget{Port: port, Network: "tcp", Addr: "localhost:" + port}
+}
+
+// String renders the target as it is written on the command line, without the port for
+// localhost and sockets: "3000", "10.0.0.5:5432", "unix:///var/run/docker.sock".
+func (t TunnelTarget) String() string {
+	switch {
+	case t.Network == "unix":
+		return unixScheme + t.Addr
+	case t.Addr == "localhost:"+t.Port:
+		return t.Port
+	}
+	return t.Addr
+}
+
+// TunnelBind maps a local listen address on the connect side to a port
+// exposed by the peer.
+type TunnelBind struct {
+	Local  string // host:port to listen on, or unix:// and a socket path
+	Remote string // exposed port; empty means the peer's only port
+}
+
+// usesPortHeaders reports whether the session speaks the multi-port tunnel
+// protocol: a TunnelPorts frame after ModeTunnel and a port header per stream.
+func usesPortHeaders(s *SecureConn) bool {
+	return s.Capabilities().Version >= tunnelPortsVersion
+}
+
+// parsePort checks p is a TCP port number and returns it canonicalized.
+func parsePort(p string) (string, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(p, ":"))
+	if err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid port %q", p)
+	}
+	return strconv.Itoa(n), nil
+}
+
+// ParseTunnelTargets parses a comma-separated target list. Each is one of
+//
+//	3000                          localhost:3000
+//	10.0.0.5:5432                 a host on the LAN, as port 5432
+//	unix:///var/run/docker.sock   a Unix socket, as port 10000 and up
+//	2375=unix:///run/docker.sock  any of the above under an explicit port
+//
+// Ports must be unique; exact duplicates are dropped.
+func ParseTunnelTargets(s string) ([]TunnelTarget, error) {
+	var targets []TunnelTarget
+	var sockets []int // indexes of sockets still needing a port
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		var t TunnelTarget
+		if key, rest, ok := strings.Cut(f, "="); ok {
+			p, err := parsePort(key)
+			if err != nil {
+				return nil, err
+			}
+			t.Port, f = p, rest
+		}
+		switch {
+		case strings.HasPrefix(f, unixScheme):
+			t.Network, t.Addr = "unix", strings.TrimPrefix(f, unixScheme)
+			if !filepath.IsAbs(t.Addr) {
+				return nil, fmt.Errorf("socket path in %q must be absolute, e.g. unix:///var/run/docker.sock", f)
+			}
+		case strings.Contains(strings.TrimPrefix(f, ":"), ":"):
+			host, port, err := net.SplitHostPort(f)
+			if err != nil || host == "" {
+				return nil, fmt.Errorf("invalid target %q (use a port, host:port or unix:///path)", f)
+			}
+			if port, err = parsePort(port); err != nil {
+				return nil, err
+			}
+			t.Network, t.Addr = "tcp", net.JoinHostPort(host, port)
+			if t.Port == "" {
+				t.Port = port
+			}
+		default:
+			p, err := parsePort(f)
+			if err != nil {
+				return nil, err
+			}
+			lt := localTarget(p)
+			t.Network, t.Addr = lt.Network, lt.Addr
+			if t.Port == "" {
+				t.Port = p
+			}
+		}
+		if slices.Contains(targets, t) {
+			continue
+		}
+		if t.Port == "" {
+			sockets = append(sockets, len(targets))
+		} else if i := slices.IndexFunc(targets, func(o TunnelTarget) bool { return o.Port == t.Port }); i >= 0 {
+			return nil, fmt.Errorf("port %s is used by both %s and %s; give one of them another with PORT=%s", t.Port, targets[i], t, t)
+		}
+		targets = append(targets, t)
+	}
+	next := firstUnixPort
+	for _, i := range sockets {
+		for slices.ContainsFunc(targets, func(o TunnelTarget) bool { return o.Port == strconv.Itoa(next) }) {
+			next++
+		}
+		targets[i].Port = strconv.Itoa(next)
+		next++
+	}
+	return targets, nil
+}
+
+// describeTargets renders targets for logs and the TUI, e.g.
+// "3000, 10.0.0.5:5432, 10000 → unix:///var/run/docker.sock". The port is shown
+// when the target does not already end in it.
+func describeTargets(targets []TunnelTarget) string {
+	parts := make([]string, len(targets))
+	for i, t := range targets {
+		parts[i] = t.String()
+		if t.Network == "unix" || !strings.HasSuffix(t.Addr, ":"+t.Port) {
+			parts[i] = t.Port + " → " + parts[i]
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// describeExposed is describeTargets plus the SOCKS policy when there is one.
+func describeExposed(targets []TunnelTarget, socks *DialPolicy) string {
+	s := describeTargets(targets)
+	if socks == nil {
+		return s
+	}
+	if s != "" {
+		s += ", "
+	}
+	return s + "socks → " + socks.String()
+}
+
+// ParseTunnelBinds parses a comma-separated list of binds. Each is one of
+//
+//	3000             127.0.0.1:3000 to the peer's port 3000
+//	9090=3000        127.0.0.1:9090 to the peer's port 3000
+//	:9090=3000       any interface, port 9090, to the peer's port 3000
+//	127.0.0.1:9000   to the peer's only port
+//	unix:///tmp/docker.sock=10000   a local Unix socket to the peer's port 10000
+//	socks            a SOCKS5 server on 127.0.0.1:1080 (peer exposes with --socks)
+//	:1080=socks      a SOCKS5 server on any interface, port 1080
+func ParseTunnelBinds(s string) ([]TunnelBind, error) {
+	var binds []TunnelBind
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		local, remote, mapped := strings.Cut(f, "=")
+		var b TunnelBind
+		if local == socksRemote && !mapped {
+			binds = append(binds, TunnelBind{Local: defaultSocksBind, Remote: socksRemote})
+			continue
+		}
+		if mapped && remote == socksRemote {
+			b.Remote = socksRemote
+		} else if mapped {
+			p, err := parsePort(remote)
+			if err != nil {
+				return nil, err
+			}
+			b.Remote = p
+		}
+		if strings.HasPrefix(local, unixScheme) {
+			if strings.TrimPrefix(local, unixScheme) == "" {
+				return nil, fmt.Errorf("invalid bind %q: missing socket path", f)
+			}
+			b.Local = local
+			binds = append(binds, b)
+			continue
+		}
+		if !strings.Contains(local, ":") {
+			p, err := parsePort(local)
+			if err != nil {
+				return nil, err
+			}
+			local = "127.0.0.1:" + p
+			if !mapped {
+				b.Remote = p
+			}
+		}
+		if _, port, err := net.SplitHostPort(local); err != nil {
+			return nil, fmt.Errorf("invalid bind address %q (use e.g. :9090 or 127.0.0.1:9000)", local)
+		} else if _, err := parsePort(port); err != nil {
+			return nil, err
+		}
+		b.Local = local
+		binds = append(binds, b)
+	}
+	return binds, nil
+}
+
+// resolveBinds fills in and checks binds against the ports the peer exposes
+// (nil for peers before protocol v3, which expose one unnamed port) and whether
+// it accepts SOCKS streams. No binds means every exposed port on 127.0.0.1 under
+// the same number, plus a SOCKS server on 127.0.0.1:1080 when offered.
+func resolveBinds(binds []TunnelBind, ports []string, socks bool) ([]TunnelBind, error) {
+	if len(binds) == 0 {
+		if ports == nil {
+			return nil, fmt.Errorf("wormhole: peer runs an older version that does not list its ports; give a local bind address, e.g. :9090")
+		}
+		for _, p := range ports {
+			binds = append(binds, TunnelBind{Local: "127.0.0.1:" + p, Remote: p})
+		}
+		if socks {
+			binds = append(binds, TunnelBind{Local: defaultSocksBind, Remote: socksRemote})
+		}
+		return binds, nil
+	}
+	if ports == nil {
+		if len(binds) > 1 || binds[0].Remote == socksRemote {
+			return nil, fmt.Errorf("wormhole: peer runs an older version that exposes a single port; give one bind address")
+		}
+		return []TunnelBind{{Local: binds[0].Local}}, nil
+	}
+	choices := ports
+	if socks {
+		choices = append(slices.Clip(ports), socksRemote)
+	}
+	out := slices.Clone(binds)
+	for i, b := range out {
+		switch {
+		case b.Remote == socksRemote && !socks:
+			return nil, fmt.Errorf("wormhole: peer does not offer SOCKS; it must expose with --socks")
+		case b.Remote == "" && len(choices) > 1:
+			return nil, fmt.Errorf("wormhole: peer exposes %s; map each bind to one, e.g. %s=%s", strings.Join(choices, ", "), b.Local, choices[0])
+		case b.Remote == "":
+			out[i].Remote = choices[0]
+		case !slices.Contains(choices, b.Remote):
+			return nil, fmt.Errorf("wormhole: port %s is not exposed by the peer (it exposes %s)", b.Remote, strings.Join(choices, ", "))
+		}
+	}
+	return out, nil
+}
+
+// ports returns the exposed ports, or nil for a peer before protocol v3 (tp nil).
+func (tp *TunnelPorts) ports() []string {
+	if tp == nil {
+		return nil
+	}
+	if tp.Ports == nil {
+		return []string{} // SOCKS only
+	}
+	return tp.Ports
+}
+
+// socks reports whether the peer accepts SOCKS streams.
+func (tp *TunnelPorts) socks() bool {
+	return tp != nil && tp.Socks
+}
+
+// describeBinds renders binds for logs and the TUI, e.g.
+// "127.0.0.1:3000 → 3000, /tmp/d.sock → 10000 (unix:///var/run/docker.sock)",
+// naming the peer's target when it is not a plain localhost port.
+func describeBinds(binds []TunnelBind, tp *TunnelPorts) string {
+	parts := make([]string, len(binds))
+	for i, b := range binds {
+		parts[i] = b.Local
+		if b.Remote == "" {
+			continue
+		}
+		parts[i] += " → " + b.Remote
+		if tp != nil && len(tp.Names) == len(tp.Ports) {
+			if j := slices.Index(tp.Ports, b.Remote); j >= 0 && tp.Names[j] != b.Remote {
+				parts[i] += " (" + tp.Names[j] + ")"
+			}
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// listenBind listens on a TCP address or, for unix:// binds, a Unix socket that
+// only this user may connect to. A stale socket left by a crashed run is replaced.
+func listenBind(local string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(local, unixScheme)
+	if !ok {
+		return net.Listen("tcp", local)
+	}
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if c, err := net.Dial("unix", path); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("wormhole: %s is in use by another process", path)
+		}
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// portHeader encodes the stream header naming target port p (already validated).
+func portHeader(p string) []byte {
+	n, _ := strconv.Atoi(p)
+	return binary.BigEndian.AppendUint16(nil, uint16(n))
+}
+
+// readPortHeader reads a stream's port header. Port "0" marks a SOCKS stream,
+// whose destination follows (readSocksDest).
+func readPortHeader(stream net.Conn) (string, error) {
+	stream.SetReadDeadline(time.Now().Add(streamHeaderTimeout))
+	defer stream.SetReadDeadline(time.Time{})
+	var hdr [2]byte
+	if _, err := io.ReadFull(stream, hdr[:]); err != nil {
+		return "", err
+	}
+	return strconv.Itoa(int(binary.BigEndian.Uint16(hdr[:]))), nil
+}
@@ -0,0 +1,310 @@
+package wormhole
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/yamux"
+)
+
+// dropListener records accepted connections so a test can cut them all,
+// as a relay restart or network drop would.
+type dropListener struct {
+	net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (l *dropListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err == nil {
+		l.mu.Lock()
+		l.conns = append(l.conns, c)
+		l.mu.Unlock()
+	}
+	return c, err
+}
+
+func (l *dropListener) drop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, c := range l.conns {
+		c.Close()
+	}
+	l.conns = nil
+}
+
+// startEcho serves a line echo on loopback, prefixing replies with tag, and
+// returns its port.
+func startEcho(t *testing.T, tag string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveEcho(t, ln, tag)
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	return port
+}
+
+// serveEcho runs the line echo of startEcho on ln until the test ends.
+func serveEcho(t *testing.T, ln net.Listener, tag string) {
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				r := bufio.NewReader(c)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					io.WriteString(c, tag+line)
+				}
+			}()
+		}
+	}()
+}
+
+// waitEvent returns the first event of type typ, failing after a timeout.
+func waitEvent(t *testing.T, ch <-chan UIEvent, typ UIEventType) UIEvent {
+	t.Helper()
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case e := <-ch:
+			if e.Type == typ {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("no event of type %d", typ)
+		}
+	}
+}
+
+func echoThrough(t *testing.T, addr, tag, msg string) {
+	t.Helper()
+	network := "tcp"
+	if path, ok := strings.CutPrefix(addr, unixScheme); ok {
+		network, addr = "unix", path
+	}
+	var c net.Conn
+	var err error
+	for i := 0; i < 50; i++ { // the connect side may not be listening yet
+		if c, err = net.Dial(network, addr); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("dial %s: %v", addr, err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := c.Write([]byte(msg + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := bufio.NewReader(c).ReadString('\n')
+	if err != nil || got != tag+msg+"\n" {
+		t.Fatalf("echo through tunnel = %q, %v; want %q", got, err, tag+msg)
+	}
+}
+
+// freeAddr returns a loopback address with a port nothing listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestTunnelMultiplePorts(t *testing.T) {
+	relay := startRelay(t)
+	web, api := startEcho(t, "web:"), startEcho(t, "api:")
+	webBind, apiBind := freeAddr(t), freeAddr(t)
+
+	go ExposeTunnel(relay, "t022", []TunnelTarget{localTarget(web), localTarget(api)}, nil)
+	go ConnectTunnel(relay, "t022", []TunnelBind{{Local: webBind, Remote: web}, {Local: apiBind, Remote: api}}, nil)
+
+	echoThrough(t, apiBind, "api:", "one")
+	echoThrough(t, webBind, "web:", "two")
+}
+
+func TestTunnelHostAndSocketTargets(t *testing.T) {
+	relay := startRelay(t)
+	dir := t.TempDir()
+	sock, err := net.Listen("unix", filepath.Join(dir, "svc.sock"))
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	serveEcho(t, sock, "sock:")
+	db := startEcho(t, "db:")
+
+	targets, err := ParseTunnelTargets("7000=127.0.0.1:" + db + ",unix://" + filepath.Join(dir, "svc.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbBind, sockBind := freeAddr(t), unixScheme+filepath.Join(dir, "local.sock")
+	binds, err := ParseTunnelBinds(dbBind + "=7000," + sockBind + "=" + targets[1].Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ExposeTunnel(relay, "t023", targets, nil)
+	go ConnectTunnel(relay, "t023", binds, nil)
+
+	echoThrough(t, dbBind, "db:", "one")
+	echoThrough(t, sockBind, "sock:", "two")
+	if fi, err := os.Stat(filepath.Join(dir, "local.sock")); err != nil {
+		t.Error(err)
+	} else if fi.Mode().Perm() != 0600 {
+		t.Errorf("local socket mode = %v, want 0600", fi.Mode().Perm())
+	}
+}
+
+func TestParseTunnelTargets(t *testing.T) {
+	got, err := ParseTunnelTargets("3000, 10.0.0.5:5432,unix:///var/run/docker.sock,2375=unix:///run/b.sock,3000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TunnelTarget{
+		{"3000", "tcp", "localhost:3000"},
+		{"5432", "tcp", "10.0.0.5:5432"},
+		{"10000", "unix", "/var/run/docker.sock"},
+		{"2375", "unix", "/run/b.sock"},
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("ParseTunnelTargets() = %v, want %v", got, want)
+	}
+	if s := describeTargets(got); s != "3000, 10.0.0.5:5432, 10000 → unix:///var/run/docker.sock, 2375 → unix:///run/b.sock" {
+		t.Errorf("describeTargets() = %q", s)
+	}
+	for _, bad := range []string{"", "0", "host:", "unix://relative.sock", "5432,10.0.0.5:5432", "x=3000"} {
+		if _, err := ParseTunnelTargets(bad); err == nil {
+			t.Errorf("ParseTunnelTargets(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestExposeRefusesUnlistedPort(t *testing.T) {
+	secret := startEcho(t, "secret:")
+	a, b := net.Pipe()
+	defer a.Close()
+	go serveExpose(a, []TunnelTarget{localTarget("1")}, true, newExposeGate(nil), nil)
+
+	session, err := yamux.Client(b, yamuxConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	stream, err := session.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Write(append(portHeader(secret), "hello\n"...))
+	stream.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if n, err := stream.Read(make([]byte, 64)); err != io.EOF {
+		t.Fatalf("stream to unlisted port read %d bytes, err %v; want it closed", n, err)
+	}
+}
+
+func TestResolveBinds(t *testing.T) {
+	binds, err := ParseTunnelBinds("3000, 9090=8080,:5433=5432")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TunnelBind{{"127.0.0.1:3000", "3000"}, {"127.0.0.1:9090", "8080"}, {":5433", "5432"}}
+	if !slices.Equal(binds, want) {
+		t.Fatalf("ParseTunnelBinds() = %v, want %v", binds, want)
+	}
+	binds, err = ParseTunnelBinds("socks,:1081=socks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []TunnelBind{{defaultSocksBind, socksRemote}, {":1081", socksRemote}}; !slices.Equal(binds, want) {
+		t.Errorf("ParseTunnelBinds(socks) = %v, want %v", binds, want)
+	}
+	for _, bad := range []string{"", "0", "abc", "9090=70000", "host:", "socks=3000"} {
+		if _, err := ParseTunnelBinds(bad); err == nil {
+			t.Errorf("ParseTunnelBinds(%q) succeeded", bad)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		binds []TunnelBind
+		ports []string
+		socks bool
+		want  []TunnelBind
+		ok    bool
+	}{
+		{"defaults", nil, []string{"3000", "8080"}, false, []TunnelBind{{"127.0.0.1:3000", "3000"}, {"127.0.0.1:8080", "8080"}}, true},
+		{"single port", []TunnelBind{{Local: ":9090"}}, []string{"3000"}, false, []TunnelBind{{":9090", "3000"}}, true},
+		{"ambiguous", []TunnelBind{{Local: ":9090"}}, []string{"3000", "8080"}, false, nil, false},
+		{"not exposed", []TunnelBind{{":9090", "22"}}, []string{"3000"}, false, nil, false},
+		{"older peer", []TunnelBind{{Local: ":9090"}}, nil, false, []TunnelBind{{Local: ":9090"}}, true},
+		{"older peer needs a bind", nil, nil, false, nil, false},
+		{"socks default", nil, []string{"3000"}, true, []TunnelBind{{"127.0.0.1:3000", "3000"}, {defaultSocksBind, socksRemote}}, true},
+		{"socks only", []TunnelBind{{Local: ":1081"}}, []string{}, true, []TunnelBind{{":1081", socksRemote}}, true},
+		{"socks not offered", []TunnelBind{{":1081", socksRemote}}, []string{"3000"}, false, nil, false},
+	}
+	for _, tt := range tests {
+		got, err := resolveBinds(tt.binds, tt.ports, tt.socks)
+		if (err == nil) != tt.ok || !slices.Equal(got, tt.want) {
+			t.Errorf("%s: resolveBinds() = %v, %v; want %v (ok %v)", tt.name, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestTunnelReconnects(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln := &dropListener{Listener: inner}
+	relay := acceptRelay(t, NewRelayServer(5*time.Second, nil), ln)
+	port := startEcho(t, "")
+	bind := freeAddr(t)
+
+	exposeEv := make(chan UIEvent, 64)
+	connectEv := make(chan UIEvent, 64)
+	go ExposeTunnel(relay, "t021", []TunnelTarget{localTarget(port)}, &TunnelOptions{Events: exposeEv, NoDirect: true, Reconnect: true})
+	go ConnectTunnel(relay, "t021", []TunnelBind{{Local: bind}}, &TunnelOptions{Events: connectEv, NoDirect: true, Reconnect: true})
+
+	echoThrough(t, bind, "", "before")
+	ln.drop()
+	waitEvent(t, connectEv, EventLinkDown)
+	waitEvent(t, exposeEv, EventLinkDown)
+
+	// The listener stayed open; this connection may be queued until the link is back.
+	echoThrough(t, bind, "", "after")
+	if e := waitEvent(t, connectEv, EventReconnected); e.Attempt < 1 || e.Since.IsZero() {
+		t.Errorf("EventReconnected = %+v, want attempt and downtime start", e)
+	}
+}
+
+func TestTunnelLinkQueues(t *testing.T) {
+	link := newTunnelLink()
+	if _, err := link.open(0); err != errTunnelDown {
+		t.Fatalf("open() on a down link error = %v, want errTunnelDown", err)
+	}
+	start := time.Now()
+	if _, err := link.open(50 * time.Millisecond); err != errTunnelDown || time.Since(start) < 50*time.Millisecond {
+		t.Fatalf("open() did not wait before giving up (err %v)", err)
+	}
+}
@@ -18,9 +18,17 @@ type Handshaker interface {
 }
 
 // StreamCipher creates encrypt/decrypt streams from a session key.
-// Allows swapping AES-CTR for other ciphers (e.g. ChaCha20).
+// Unauthenticated; only used to recognize legacy AES-CTR peers.
 type StreamCipher interface {
 	// NewDuplex returns enc (our writes) and dec (our reads) streams.
 	// Sender's encStream must match receiver's decStream (same IV) for the wire; isSender selects.
 	NewDuplex(key []byte, isSender bool) (encStream, decStream cipher.Stream, err error)
 }
+
+// RecordCipher creates the AEADs that seal the secure channel into records.
+// Allows swapping AES-GCM for other AEADs (e.g. ChaCha20-Poly1305).
+type RecordCipher interface {
+	// NewAEADs returns seal (our writes) and open (our reads) AEADs.
+	// Sender's seal must match receiver's open; isSender selects.
+	NewAEADs(key []byte, isSender bool) (seal, open cipher.AEAD, err error)
+}
@@ -2,9 +2,13 @@ package wormhole
 
 import (
 	"fmt"
+	"io"
+	"path"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
@@ -15,11 +19,43 @@ var (
 	uiMuted     = lipgloss.AdaptiveColor{Light: "#6B6B6B", Dark: "#9B9B9B"}
 )
 
-// ProgressMsg is sent when transfer progress updates.
+// maxDoneFiles caps how many received paths the done view lists.
+const maxDoneFiles = 5
+
+// rateSampleInterval is how often the throughput estimate for streams is updated.
+const rateSampleInterval = 500 * time.Millisecond
+
+// ProgressMsg is sent when transfer progress updates. Total is -1 for streams of unknown length.
 type ProgressMsg struct {
 	Current, Total int64
 }
 
+// FileProgressMsg is sent when the current file of a multi-file transfer advances.
+type FileProgressMsg FileProgress
+
+// WireMsg carries the compressed bytes sent or received so far.
+type WireMsg int64
+
+// PathMsg is sent once the transfer session is known to be direct or relayed.
+type PathMsg PathInfo
+
+// OfferMsg asks the user to accept, rename or decline an incoming payload.
+// The transfer waits until a decision is sent on Reply.
+type OfferMsg struct {
+	Offer Offer
+	Reply chan<- OfferDecision
+}
+
+// SASMsg carries the session's short authentication string for display.
+type SASMsg SAS
+
+// SASConfirmMsg asks the user whether both sides show the same SAS.
+// The transfer waits for the answer on Reply.
+type SASConfirmMsg struct {
+	SAS   SAS
+	Reply chan<- bool
+}
+
 // DoneMsg is sent when transfer completes.
 type DoneMsg struct {
 	Err    error
@@ -31,11 +67,28 @@ type transferModel struct {
 	progress   progress.Model
 	current    int64
 	total      int64
+	wire       int64          // compressed body bytes; 0 when uncompressed
+	file       *FileProgress  // current entry of a multi-file transfer, nil otherwise
+	path       *PathInfo      // set once the session is open
+	sas        *SAS           // set once the session is open
+	confirm    *SASConfirmMsg // pending SAS comparison (--verify)
 	title      string
 	code       string // pairing code to display while waiting
 	ch         <-chan tea.Msg
 	err        error
 	doneResult *ReceiveResult // set when DoneMsg has Result, shown in View
+	quitOnDone bool           // exit on DoneMsg instead of waiting for q
+	limit      *Limiter       // session bandwidth cap, adjusted with +/-
+	offer      *OfferMsg      // pending offer awaiting a decision
+	renaming   bool           // name input is active for the pending offer
+	input      textinput.Model
+
+	// Throughput for streams (total < 0), sampled every rateSampleInterval.
+	started   time.Time
+	sampledAt time.Time
+	sampled   int64
+	rate      float64 // bytes per second, smoothed
+	finished  time.Duration
 }
 
 func (m transferModel) Init() tea.Cmd {
@@ -45,15 +98,27 @@ func (m transferModel) Init() tea.Cmd {
 func (m transferModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.confirm != nil {
+			return m.updateConfirm(msg)
+		}
+		if m.offer != nil {
+			return m.updateOffer(msg)
+		}
 		// q, Esc, Ctrl+C: always allow exit (fixes "Press any key" being ignored during wait)
 		switch msg.String() {
 		case "q", "Q", "esc", "ctrl+c":
 			return m, tea.Quit
 		}
-		done := m.err != nil || (m.total > 0 && m.current >= m.total)
+		done := m.err != nil || m.doneResult != nil || (m.total > 0 && m.current >= m.total)
 		if done {
 			return m, tea.Quit
 		}
+		switch msg.String() {
+		case "+", "=":
+			m.limit.SetRate(StepRate(m.limit.Rate(), true))
+		case "-", "_":
+			m.limit.SetRate(StepRate(m.limit.Rate(), false))
+		}
 		return m, nil
 
 	case tea.WindowSizeMsg:
@@ -71,6 +136,34 @@ func (m transferModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case ProgressMsg:
 		m.current = msg.Current
 		m.total = msg.Total
+		m.sampleRate(time.Now())
+		return m, waitForTransferMsg(m.ch)
+
+	case WireMsg:
+		m.wire = int64(msg)
+		return m, waitForTransferMsg(m.ch)
+
+	case FileProgressMsg:
+		fp := FileProgress(msg)
+		m.file = &fp
+		return m, waitForTransferMsg(m.ch)
+
+	case PathMsg:
+		p := PathInfo(msg)
+		m.path = &p
+		return m, waitForTransferMsg(m.ch)
+
+	case OfferMsg:
+		m.offer = &msg
+		return m, waitForTransferMsg(m.ch)
+
+	case SASMsg:
+		s := SAS(msg)
+		m.sas = &s
+		return m, waitForTransferMsg(m.ch)
+
+	case SASConfirmMsg:
+		m.confirm = &msg
 		return m, waitForTransferMsg(m.ch)
 
 	case progress.FrameMsg:
@@ -81,9 +174,18 @@ func (m transferModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case DoneMsg:
 		m.err = msg.Err
 		m.doneResult = msg.Result
-		m.current = m.total
-		if m.total == 0 {
-			m.total = 1
+		if m.total < 0 {
+			if !m.started.IsZero() {
+				m.finished = time.Since(m.started)
+			}
+		} else {
+			m.current = m.total
+			if m.total == 0 {
+				m.total = 1
+			}
+		}
+		if m.quitOnDone {
+			return m, tea.Quit
 		}
 		// Don't quit: show result in View, wait for q/Esc
 		return m, nil
@@ -102,7 +204,16 @@ func (m transferModel) View() string {
 		Width(64)
 
 	b.WriteString(lipgloss.NewStyle().Foreground(uiSpecial).Render("Secure Connection Established"))
-	b.WriteString("\n\n")
+	b.WriteString("\n")
+	if m.path != nil {
+		b.WriteString(renderPath(*m.path))
+		b.WriteString("\n")
+	}
+	if m.sas != nil {
+		b.WriteString(renderSAS(*m.sas))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
 	if m.code != "" {
 		b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render("Code: "))
 		b.WriteString(lipgloss.NewStyle().Foreground(uiHighlight).Bold(true).Render(m.code))
@@ -111,7 +222,19 @@ func (m transferModel) View() string {
 	}
 	b.WriteString(lipgloss.NewStyle().Foreground(uiHighlight).Bold(true).Render(m.title))
 	b.WriteString("\n\n")
-	if m.total > 0 {
+	if m.confirm != nil {
+		b.WriteString(viewConfirmSAS())
+		return box.Render(b.String())
+	}
+	if m.offer != nil {
+		b.WriteString(m.viewOffer())
+		return box.Render(b.String())
+	}
+	if m.total < 0 {
+		// Unknown length: no percentage, show bytes so far and throughput.
+		b.WriteString(lipgloss.NewStyle().Foreground(uiHighlight).Render(formatBytes(m.current)))
+		b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render(" • " + m.throughput()))
+	} else if m.total > 0 {
 		pct := float64(m.current) / float64(m.total)
 		b.WriteString(m.progress.ViewAs(pct))
 	} else {
@@ -121,6 +244,30 @@ func (m transferModel) View() string {
 		b.WriteString("\n")
 		b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render(fmt.Sprintf("%d / %d bytes", m.current, m.total)))
 	}
+	if m.limit != nil && m.doneResult == nil && m.err == nil {
+		b.WriteString("\n")
+		b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render("Limit: "))
+		b.WriteString(lipgloss.NewStyle().Foreground(uiHighlight).Render(FormatRate(m.limit.Rate())))
+		b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render("  (+/- to adjust)"))
+	}
+	if m.wire > 0 {
+		b.WriteString("\n")
+		b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render("On the wire: " + formatBytes(m.wire) + " gzip"))
+		if m.current > 0 && m.wire < m.current {
+			saved := 100 - m.wire*100/m.current
+			b.WriteString(lipgloss.NewStyle().Foreground(uiSpecial).Render(fmt.Sprintf(" (%d%% saved)", saved)))
+		}
+	}
+	if m.file != nil && m.doneResult == nil {
+		name := m.file.Name
+		if len(name) > 36 {
+			name = "..." + name[len(name)-33:]
+		}
+		b.WriteString("\n")
+		b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render(fmt.Sprintf("File %d/%d: ", m.file.Index, m.file.Count)))
+		b.WriteString(lipgloss.NewStyle().Foreground(uiHighlight).Render(name))
+		b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render(fmt.Sprintf(" (%d / %d bytes)", m.file.Current, m.file.Total)))
+	}
 	if m.err != nil {
 		b.WriteString("\n\n")
 		b.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("#F25D94")).Render("Error: "+m.err.Error()))
@@ -133,6 +280,43 @@ func (m transferModel) View() string {
 			b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render("Received 1 file:"))
 			b.WriteString("\n  ")
 			b.WriteString(lipgloss.NewStyle().Foreground(uiHighlight).Render("• "+m.doneResult.FilePath))
+			if m.doneResult.Hash != "" {
+				b.WriteString("\n")
+				b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render("SHA-256 verified: "))
+				b.WriteString(lipgloss.NewStyle().Foreground(uiSpecial).Render(m.doneResult.Hash[:16] + "…"))
+			}
+			if m.doneResult.ResumedFrom > 0 {
+				b.WriteString("\n")
+				b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render(fmt.Sprintf("Resumed from %d bytes", m.doneResult.ResumedFrom)))
+			}
+		}
+		if m.doneResult.Written > 0 {
+			b.WriteString("\n")
+			b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render("Wrote "))
+			b.WriteString(lipgloss.NewStyle().Foreground(uiHighlight).Render(formatBytes(m.doneResult.Written)))
+			b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render(" to output"))
+			if m.doneResult.Hash != "" {
+				b.WriteString("\n")
+				b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render("SHA-256 verified: "))
+				b.WriteString(lipgloss.NewStyle().Foreground(uiSpecial).Render(m.doneResult.Hash[:16] + "…"))
+			}
+		}
+		if len(m.doneResult.Files) > 0 {
+			b.WriteString("\n")
+			b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render(fmt.Sprintf("Received %d files (SHA-256 verified):", len(m.doneResult.Files))))
+			for i, f := range m.doneResult.Files {
+				if i == maxDoneFiles {
+					b.WriteString("\n  ")
+					b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render(fmt.Sprintf("... and %d more", len(m.doneResult.Files)-maxDoneFiles)))
+					break
+				}
+				b.WriteString("\n  ")
+				b.WriteString(lipgloss.NewStyle().Foreground(uiHighlight).Render("• " + f))
+			}
+		}
+		if len(m.doneResult.Skipped) > 0 {
+			b.WriteString("\n")
+			b.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("#F25D94")).Render(fmt.Sprintf("Skipped %d unsafe symlink(s)", len(m.doneResult.Skipped))))
 		}
 		if m.doneResult.Text != "" {
 			b.WriteString("\n")
@@ -146,12 +330,163 @@ func (m transferModel) View() string {
 			b.WriteString(lipgloss.NewStyle().Foreground(uiHighlight).Render("  " + text))
 		}
 	}
-	b.WriteString("\n\n")
-	b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render("Press q or Esc to exit"))
+	if !m.quitOnDone {
+		b.WriteString("\n\n")
+		b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render("Press q or Esc to exit"))
+	}
 
 	return box.Render(b.String())
 }
 
+// updateConfirm handles the SAS comparison: y confirms; n, q, Esc and Ctrl+C
+// reject, which closes the session and exits once the transfer has stopped.
+func (m transferModel) updateConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "y", "Y":
+		m.confirm.Reply <- true
+		m.confirm = nil
+	case "n", "N", "q", "Q", "esc", "ctrl+c":
+		m.confirm.Reply <- false
+		m.confirm = nil
+		m.quitOnDone = true
+	}
+	return m, nil
+}
+
+// updateOffer handles keys while an offer waits: y/Enter accepts, r renames,
+// n declines. q, Esc and Ctrl+C decline and exit once the sender has been told.
+func (m transferModel) updateOffer(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.renaming {
+		switch msg.Type {
+		case tea.KeyEsc:
+			m.renaming = false
+			return m, nil
+		case tea.KeyEnter:
+			name := strings.TrimSpace(m.input.Value())
+			if name == "" || name == "." || name == ".." || path.Base(name) != name || strings.ContainsRune(name, '\\') {
+				m.input.Placeholder = "a plain file name, no slashes"
+				m.input.SetValue("")
+				return m, nil
+			}
+			return m.decide(OfferDecision{Accept: true, Name: name}), nil
+		case tea.KeyCtrlC:
+			m.quitOnDone = true
+			return m.decide(OfferDecision{}), nil
+		}
+		var cmd tea.Cmd
+		m.input, cmd = m.input.Update(msg)
+		return m, cmd
+	}
+	switch msg.String() {
+	case "y", "Y", "enter":
+		return m.decide(OfferDecision{Accept: true}), nil
+	case "n", "N":
+		return m.decide(OfferDecision{}), nil
+	case "r", "R":
+		if m.offer.Offer.Renamable {
+			m.renaming = true
+			m.input = textinput.New()
+			m.input.Prompt = "New name: "
+			m.input.CharLimit = 255
+			m.input.SetValue(m.offer.Offer.Name)
+			m.input.Focus()
+			return m, textinput.Blink
+		}
+	case "q", "Q", "esc", "ctrl+c":
+		m.quitOnDone = true
+		return m.decide(OfferDecision{}), nil
+	}
+	return m, nil
+}
+
+// decide answers the pending offer and returns to the progress view.
+func (m transferModel) decide(d OfferDecision) transferModel {
+	m.offer.Reply <- d
+	m.offer = nil
+	m.renaming = false
+	return m
+}
+
+// viewOffer renders the offer preview and the available keys.
+func (m transferModel) viewOffer() string {
+	o := m.offer.Offer
+	label := lipgloss.NewStyle().Foreground(uiMuted)
+	value := lipgloss.NewStyle().Foreground(uiHighlight)
+	var b strings.Builder
+	b.WriteString(lipgloss.NewStyle().Foreground(uiSpecial).Render("Incoming " + o.Type.String()))
+	if o.Name != "" {
+		b.WriteString("\n" + label.Render("Name:    ") + value.Render(o.Name))
+	}
+	size := formatBytes(o.Size)
+	if o.Size < 0 {
+		size = "unknown (stream)"
+	}
+	b.WriteString("\n" + label.Render("Size:    ") + value.Render(size))
+	if len(o.Hash) >= 16 {
+		b.WriteString("\n" + label.Render("SHA-256: ") + value.Render(o.Hash[:16]+"…"))
+	}
+	if o.Exists {
+		b.WriteString("\n" + lipgloss.NewStyle().Foreground(lipgloss.Color("#F25D94")).Render("A file with this name exists and would be overwritten"))
+	}
+	b.WriteString("\n\n")
+	if m.renaming {
+		b.WriteString(m.input.View())
+		b.WriteString("\n" + label.Render("Enter to accept, Esc to go back"))
+		return b.String()
+	}
+	keys := "[y] accept  "
+	if o.Renamable {
+		keys += "[r] rename  "
+	}
+	keys += "[n] decline"
+	b.WriteString(label.Render(keys))
+	return b.String()
+}
+
+// sampleRate updates the smoothed throughput from the byte count at now.
+func (m *transferModel) sampleRate(now time.Time) {
+	if m.started.IsZero() {
+		m.started, m.sampledAt, m.sampled = now, now, m.current
+		return
+	}
+	dt := now.Sub(m.sampledAt)
+	if dt < rateSampleInterval {
+		return
+	}
+	inst := float64(m.current-m.sampled) / dt.Seconds()
+	if m.rate == 0 {
+		m.rate = inst
+	} else {
+		m.rate = 0.7*m.rate + 0.3*inst
+	}
+	m.sampledAt, m.sampled = now, m.current
+}
+
+// throughput renders the current rate, or the average once the stream is done.
+func (m transferModel) throughput() string {
+	if m.finished > 0 {
+		return formatBytes(int64(float64(m.current)/m.finished.Seconds())) + "/s avg"
+	}
+	if m.rate == 0 {
+		return "measuring…"
+	}
+	return formatBytes(int64(m.rate)) + "/s"
+}
+
+// formatBytes renders n with a decimal unit, e.g. "12.3 MB".
+func formatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
+
 func waitForTransferMsg(ch <-chan tea.Msg) tea.Cmd {
 	return func() tea.Msg {
 		return <-ch
@@ -159,17 +494,66 @@ func waitForTransferMsg(ch <-chan tea.Msg) tea.Cmd {
 }
 
 // RunTransferUI runs a transfer with Bubble Tea + Bubbles progress bar.
-// code is displayed in the UI while waiting (empty = hide). fn receives an onProgress callback.
+// code is displayed in the UI while waiting (empty = hide). fn receives TransferOptions
+// whose progress callbacks feed the UI (overall and, for bundles, per-file) and whose
+// Limit starts unlimited; fn may set its rate, and +/- in the UI change it.
 // result: if non-nil, fn should fill it (e.g. Receive) and it will be shown in the UI box when done.
-func RunTransferUI(title string, total int64, code string, result *ReceiveResult, fn func(onProgress func(int64, int64)) error) error {
+func RunTransferUI(title string, total int64, code string, result *ReceiveResult, fn func(opts *TransferOptions) error) error {
+	return RunTransferUIWithOptions(title, total, code, result, nil, fn)
+}
+
+// UIOptions adjusts the transfer UI for pipelines, where stdin or stdout carry data.
+type UIOptions struct {
+	Output     io.Writer // Render here instead of stdout (e.g. os.Stderr for receive --stdout)
+	InputTTY   bool      // Read keys from the terminal because stdin is the payload
+	QuitOnDone bool      // Exit when the transfer ends and leave the final box on screen
+}
+
+// RunTransferUIWithOptions is RunTransferUI with UI options. ui may be nil.
+func RunTransferUIWithOptions(title string, total int64, code string, result *ReceiveResult, ui *UIOptions, fn func(opts *TransferOptions) error) error {
+	if ui == nil {
+		ui = &UIOptions{}
+	}
 	ch := make(chan tea.Msg, 64)
+	limit := NewLimiter(0)
 
 	go func() {
-		err := fn(func(cur, tot int64) {
-			select {
-			case ch <- ProgressMsg{cur, tot}:
-			default:
-			}
+		err := fn(&TransferOptions{
+			Limit: limit,
+			OnProgress: func(cur, tot int64) {
+				select {
+				case ch <- ProgressMsg{cur, tot}:
+				default:
+				}
+			},
+			OnFile: func(fp FileProgress) {
+				select {
+				case ch <- FileProgressMsg(fp):
+				default:
+				}
+			},
+			OnWire: func(n int64) {
+				select {
+				case ch <- WireMsg(n):
+				default:
+				}
+			},
+			OnPath: func(p PathInfo) {
+				ch <- PathMsg(p)
+			},
+			OnSAS: func(s SAS) {
+				ch <- SASMsg(s)
+			},
+			ConfirmSAS: func(s SAS) bool {
+				reply := make(chan bool, 1)
+				ch <- SASConfirmMsg{SAS: s, Reply: reply}
+				return <-reply
+			},
+			OnOffer: func(o Offer) OfferDecision {
+				reply := make(chan OfferDecision, 1)
+				ch <- OfferMsg{Offer: o, Reply: reply}
+				return <-reply
+			},
 		})
 		ch <- DoneMsg{Err: err, Result: result}
 	}()
@@ -180,14 +564,26 @@ func RunTransferUI(title string, total int64, code string, result *ReceiveResult
 	)
 
 	m := transferModel{
-		progress: prog,
-		total:    total,
-		title:    title,
-		code:     code,
-		ch:       ch,
+		progress:   prog,
+		total:      total,
+		title:      title,
+		code:       code,
+		ch:         ch,
+		quitOnDone: ui.QuitOnDone,
+		limit:      limit,
 	}
 
-	p := tea.NewProgram(m, tea.WithAltScreen())
+	var popts []tea.ProgramOption
+	if !ui.QuitOnDone {
+		popts = append(popts, tea.WithAltScreen())
+	}
+	if ui.Output != nil {
+		popts = append(popts, tea.WithOutput(ui.Output))
+	}
+	if ui.InputTTY {
+		popts = append(popts, tea.WithInputTTY())
+	}
+	p := tea.NewProgram(m, popts...)
 	final, err := p.Run()
 	if err != nil {
 		return err
@@ -198,14 +594,47 @@ func RunTransferUI(title string, total int64, code string, result *ReceiveResult
 	return nil
 }
 
+// renderSAS renders "Security code: <emoji> (<words>)".
+func renderSAS(s SAS) string {
+	return lipgloss.NewStyle().Foreground(uiMuted).Render("Security code: ") +
+		lipgloss.NewStyle().Foreground(uiHighlight).Render(s.Emoji()) +
+		lipgloss.NewStyle().Foreground(uiMuted).Render(" ("+s.Words()+")")
+}
+
+// viewConfirmSAS renders the --verify prompt shown under the security code.
+func viewConfirmSAS() string {
+	return lipgloss.NewStyle().Foreground(uiSpecial).Render("Verify your peer") + "\n" +
+		lipgloss.NewStyle().Foreground(uiMuted).Render("Ask them to read their security code. Nothing is sent until it matches.") + "\n\n" +
+		lipgloss.NewStyle().Foreground(uiMuted).Render("[y] codes match  [n] they differ (abort)")
+}
+
+// renderPath renders "Path: direct (...)" in green or "Path: relayed via ..." muted.
+func renderPath(p PathInfo) string {
+	color := uiMuted
+	if p.Direct {
+		color = uiSpecial
+	}
+	return lipgloss.NewStyle().Foreground(uiMuted).Render("Path: ") +
+		lipgloss.NewStyle().Foreground(color).Render(p.String())
+}
+
 // RenderSecureBox renders a "Secure Connection Established" box (for non-TUI use).
-func RenderSecureBox() string {
+// path, if non-nil, adds whether the session was direct or relayed; sas, if
+// non-nil, adds the security code both sides can compare.
+func RenderSecureBox(path *PathInfo, sas *SAS) string {
 	box := lipgloss.NewStyle().
 		Border(lipgloss.RoundedBorder()).
 		BorderForeground(uiHighlight).
 		Padding(1, 2).
 		Width(60)
-	return box.Render(lipgloss.NewStyle().Foreground(uiSpecial).Render("Secure Connection Established"))
+	s := lipgloss.NewStyle().Foreground(uiSpecial).Render("Secure Connection Established")
+	if path != nil {
+		s += "\n" + renderPath(*path)
+	}
+	if sas != nil {
+		s += "\n" + renderSAS(*sas)
+	}
+	return box.Render(s)
 }
 
 // RenderTunnelExposeBox renders a tunnel expose ready box with code and port.
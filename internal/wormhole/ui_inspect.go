@@ -0,0 +1,212 @@
+package wormhole
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	// maxInspected is how many HTTP exchanges the inspector keeps.
+	maxInspected = 200
+	// inspectWidth is the widest line the inspector renders inside the tunnel box.
+	inspectWidth = 60
+	// maxDetailLines caps the headers and body preview shown per side.
+	maxDetailLines = 8
+)
+
+// replayDoneMsg carries the result of replaying an exchange.
+type replayDoneMsg struct {
+	x   *HTTPExchange
+	err error
+}
+
+// addExchange records an exchange, dropping the oldest past maxInspected.
+func (m *tunnelModel) addExchange(x *HTTPExchange) {
+	m.exchanges = append(m.exchanges, x)
+	if len(m.exchanges) > maxInspected {
+		m.exchanges = m.exchanges[len(m.exchanges)-maxInspected:]
+		m.selected = max(m.selected-1, 0)
+	}
+}
+
+// updateInspector handles keys while the inspector is shown.
+func (m tunnelModel) updateInspector(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		m.selected = max(m.selected-1, 0)
+	case "down", "j":
+		m.selected = min(m.selected+1, max(len(m.exchanges)-1, 0))
+	case "enter":
+		m.detail = !m.detail && len(m.exchanges) > 0
+	case "esc":
+		if m.detail {
+			m.detail = false
+		} else {
+			m.inspecting = false
+		}
+	case "i":
+		m.inspecting, m.detail = false, false
+	case "r":
+		if len(m.exchanges) == 0 {
+			return m, nil
+		}
+		x := m.exchanges[m.selected]
+		m.status = "Replaying " + x.Method + " " + x.URL + "…"
+		return m, func() tea.Msg {
+			r, err := x.Replay()
+			return replayDoneMsg{r, err}
+		}
+	case "e":
+		m.status = exportHAR(m.exchanges)
+	}
+	return m, nil
+}
+
+// exportHAR writes exchanges to a new HAR file in the working directory and
+// returns a status line.
+func exportHAR(exchanges []*HTTPExchange) string {
+	if len(exchanges) == 0 {
+		return "Nothing to export yet"
+	}
+	name := "wormhole-" + time.Now().Format("20060102-150405") + ".har"
+	f, err := os.Create(name)
+	if err != nil {
+		return "Export failed: " + err.Error()
+	}
+	err = WriteHAR(f, exchanges)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "Export failed: " + err.Error()
+	}
+	return fmt.Sprintf("Exported %d exchanges to %s", len(exchanges), name)
+}
+
+// viewInspector renders the exchange list, or the selected exchange in detail.
+func (m tunnelModel) viewInspector() string {
+	muted := lipgloss.NewStyle().Foreground(uiMuted)
+	var b strings.Builder
+	b.WriteString(muted.Render(fmt.Sprintf("─── HTTP Inspector (%d) ───", len(m.exchanges))))
+	b.WriteString("\n")
+	switch {
+	case len(m.exchanges) == 0:
+		b.WriteString(muted.Render("  (no HTTP requests yet)"))
+		b.WriteString("\n")
+	case m.detail:
+		b.WriteString(viewExchange(m.exchanges[m.selected]))
+	default:
+		// A window of maxTrafficLogs rows that keeps the selection in view.
+		from := max(0, min(m.selected-maxTrafficLogs/2, len(m.exchanges)-maxTrafficLogs))
+		to := min(len(m.exchanges), from+maxTrafficLogs)
+		for i := from; i < to; i++ {
+			line := fmt.Sprintf("#%d %s", i+1, m.exchanges[i].Summary())
+			if m.exchanges[i].Replayed {
+				line += " ↻"
+			}
+			line = clip(line, inspectWidth)
+			if i == m.selected {
+				b.WriteString(lipgloss.NewStyle().Foreground(uiHighlight).Bold(true).Render("▸ " + line))
+			} else {
+				b.WriteString("  " + exchangeStyle(m.exchanges[i]).Render(line))
+			}
+			b.WriteString("\n")
+		}
+	}
+	if m.status != "" {
+		b.WriteString(muted.Render(clip(m.status, inspectWidth)))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	b.WriteString(muted.Render("↑/↓ select · enter details · r replay · e export HAR · i back"))
+	return b.String()
+}
+
+// viewExchange renders one exchange: request line, headers and body preview,
+// then the same for the response.
+func viewExchange(x *HTTPExchange) string {
+	muted := lipgloss.NewStyle().Foreground(uiMuted)
+	plain := lipgloss.NewStyle()
+	var b strings.Builder
+	line := func(style lipgloss.Style, s string) {
+		b.WriteString("  " + style.Render(clip(s, inspectWidth)) + "\n")
+	}
+	line(lipgloss.NewStyle().Foreground(uiHighlight).Bold(true), fmt.Sprintf("%s %s %s", x.Method, x.URL, x.Proto))
+	line(muted, fmt.Sprintf("%s · %s · %s", x.Target, x.Start.Format("15:04:05.000"), formatBytes(x.ReqSize)))
+	for _, h := range headerLines(x.ReqHeader) {
+		line(plain, h)
+	}
+	for _, l := range bodyPreview(x.ReqBody, x.ReqSize) {
+		line(muted, l)
+	}
+	b.WriteString("\n")
+	if x.Err != "" {
+		line(exchangeStyle(x), x.Err)
+		return b.String()
+	}
+	line(exchangeStyle(x).Bold(true), x.StatusText)
+	line(muted, fmt.Sprintf("%s · %s", x.Duration.Round(time.Millisecond), formatBytes(x.RespSize)))
+	for _, h := range headerLines(x.RespHeader) {
+		line(plain, h)
+	}
+	for _, l := range bodyPreview(x.RespBody, x.RespSize) {
+		line(muted, l)
+	}
+	return b.String()
+}
+
+// exchangeStyle colors an exchange by status class.
+func exchangeStyle(x *HTTPExchange) lipgloss.Style {
+	switch {
+	case x.Err != "" || x.Status >= 500:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("#F25D94"))
+	case x.Status >= 400:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("#F2B45D"))
+	}
+	return lipgloss.NewStyle().Foreground(lipgloss.Color("#43BF6D"))
+}
+
+// headerLines renders headers sorted by name, at most maxDetailLines of them.
+func headerLines(h http.Header) []string {
+	var out []string
+	for _, k := range slices.Sorted(maps.Keys(h)) {
+		out = append(out, k+": "+strings.Join(h[k], ", "))
+	}
+	if len(out) > maxDetailLines {
+		out = append(out[:maxDetailLines-1], fmt.Sprintf("… %d more", len(out)-maxDetailLines+1))
+	}
+	return out
+}
+
+// bodyPreview returns the first lines of a body, or a note for binary ones.
+func bodyPreview(body []byte, size int64) []string {
+	if size == 0 {
+		return nil
+	}
+	text, enc := harText(body)
+	if enc != "" {
+		return []string{fmt.Sprintf("(%s of binary data)", formatBytes(size))}
+	}
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	if len(lines) > maxDetailLines {
+		lines = append(lines[:maxDetailLines], "…")
+	}
+	return lines
+}
+
+// clip shortens s to n runes, marking the cut with an ellipsis.
+func clip(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
@@ -0,0 +1,156 @@
+package wormhole
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// sparkChars are the levels of the throughput sparkline, lowest first.
+var sparkChars = []rune("▁▂▃▄▅▆▇█")
+
+// statsTickMsg samples the stream counters; see statsTick.
+type statsTickMsg struct{}
+
+func statsTick() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg { return statsTickMsg{} })
+}
+
+// updateStreams handles keys while the stream table is shown.
+func (m tunnelModel) updateStreams(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		m.streamSel = max(m.streamSel-1, 0)
+	case "down", "j":
+		m.streamSel = min(m.streamSel+1, max(len(m.sample.Active)-1, 0))
+	case "x":
+		if m.history || m.streamSel >= len(m.sample.Active) {
+			return m, nil
+		}
+		r := m.sample.Active[m.streamSel]
+		if m.stats.Kill(r.ID) {
+			m.status = fmt.Sprintf("Killed stream #%d (%s)", r.ID, r.Remote)
+		} else {
+			m.status = fmt.Sprintf("Stream #%d already closed", r.ID)
+		}
+	case "h":
+		m.history = !m.history
+	case "s", "esc":
+		m.streams, m.history = false, false
+	}
+	return m, nil
+}
+
+// viewTotals renders the session-wide counters and sparkline, or "" before the
+// first stream.
+func (m tunnelModel) viewTotals() string {
+	if m.sample.Opened == 0 {
+		return ""
+	}
+	muted := lipgloss.NewStyle().Foreground(uiMuted)
+	hi := lipgloss.NewStyle().Foreground(uiHighlight)
+	return muted.Render("Total: ") +
+		hi.Render(fmt.Sprintf("↑ %s ↓ %s", formatBytes(m.sample.Up), formatBytes(m.sample.Down))) +
+		muted.Render(fmt.Sprintf(" · %s/s · %d open ", formatBytes(int64(m.sample.Rate)), len(m.sample.Active))) +
+		hi.Render(sparkline(m.sample.Spark, 10)) + "\n"
+}
+
+// viewStreams renders the table of open streams, or of closed ones with their
+// final counters, under the session sparkline.
+func (m tunnelModel) viewStreams() string {
+	muted := lipgloss.NewStyle().Foreground(uiMuted)
+	s := m.sample
+	rows, title, empty := s.Active, fmt.Sprintf("─── Streams (%d open, %d total) ───", len(s.Active), s.Opened), "  (no open streams)"
+	if m.history {
+		rows, title, empty = s.History, fmt.Sprintf("─── Closed Streams (%d) ───", len(s.History)), "  (no closed streams yet)"
+	}
+	var b strings.Builder
+	b.WriteString(muted.Render(title))
+	b.WriteString("\n")
+	b.WriteString(lipgloss.NewStyle().Foreground(uiHighlight).Render("  " + sparkline(s.Spark, sparkLen)))
+	b.WriteString(muted.Render(fmt.Sprintf(" %s/s", formatBytes(int64(s.Rate)))))
+	b.WriteString("\n\n")
+	if len(rows) == 0 {
+		b.WriteString(muted.Render(empty))
+		b.WriteString("\n")
+	} else {
+		rate := "Rate"
+		if m.history {
+			rate = "Avg"
+		}
+		b.WriteString(muted.Render(streamRow("Remote", "Proto", "↑", "↓", "Time", rate)))
+		b.WriteString("\n")
+		for i, r := range rows {
+			if i == maxTrafficLogs {
+				b.WriteString(muted.Render(fmt.Sprintf("  … %d more", len(rows)-i)))
+				b.WriteString("\n")
+				break
+			}
+			proto := r.Protocol
+			if proto == "" {
+				proto = "…"
+			}
+			line := streamRow(r.Remote, proto, formatBytes(r.Up), formatBytes(r.Down), shortDuration(r.Duration), formatBytes(int64(r.Rate))+"/s")
+			switch {
+			case m.history:
+				b.WriteString(muted.Render(line))
+			case i == m.streamSel:
+				b.WriteString(lipgloss.NewStyle().Foreground(uiHighlight).Bold(true).Render("▸" + line[1:]))
+			default:
+				b.WriteString(line)
+			}
+			b.WriteString("\n")
+		}
+	}
+	if m.status != "" {
+		b.WriteString(muted.Render(clip(m.status, inspectWidth)))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	if m.history {
+		b.WriteString(muted.Render("h open streams · s back"))
+	} else {
+		b.WriteString(muted.Render("↑/↓ select · x kill · h closed streams · s back"))
+	}
+	return b.String()
+}
+
+// streamRow lays out one line of the stream table.
+func streamRow(remote, proto, up, down, dur, rate string) string {
+	return fmt.Sprintf("  %-16s %-9s %8s %8s %5s %10s", clip(remote, 16), clip(proto, 9), up, down, dur, rate)
+}
+
+// shortDuration renders d in at most five characters, e.g. "42s", "3m07s", "2h05m".
+func shortDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+	}
+	return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// sparkline renders the last n values scaled to their maximum.
+func sparkline(vals []float64, n int) string {
+	if len(vals) > n {
+		vals = vals[len(vals)-n:]
+	}
+	var peak float64
+	for _, v := range vals {
+		peak = max(peak, v)
+	}
+	var b strings.Builder
+	for _, v := range vals {
+		i := 0
+		if peak > 0 {
+			i = int(v / peak * float64(len(sparkChars)-1))
+		}
+		b.WriteRune(sparkChars[i])
+	}
+	return b.String()
+}
@@ -1,7 +1,9 @@
 package wormhole
 
 import (
+	"fmt"
 	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -16,23 +18,73 @@ type TunnelEventMsg UIEvent
 type tunnelModel struct {
 	role       string   // "expose" or "connect"
 	code       string
-	addr       string   // port or bindAddr
-	trafficLog []string // last N traffic events, newest last
+	addr       string          // exposed ports, or local binds once known
+	path       *PathInfo       // set once the session is open
+	limit      *Limiter        // tunnel bandwidth cap, adjusted with +/-
+	sas        *SAS            // set once the session is open
+	confirm    chan<- bool     // pending SAS comparison (--verify)
+	trafficLog []string        // last N traffic events, newest last
+	downSince  time.Time       // when the session dropped; zero while it is up
+	attempt    int             // current reconnect attempt
+	reconnects int             // times the session came back
+	downtime   time.Duration   // total time spent reconnecting
+	exchanges  []*HTTPExchange // HTTP inspector entries, oldest first
+	selected   int             // inspector cursor into exchanges
+	inspecting bool            // inspector shown instead of Live Traffic
+	detail     bool            // selected exchange shown in full
+	status     string          // result of the last replay, export or kill
+	stats      *TunnelStats    // per-stream counters, sampled every second
+	sample     StatsSample     // the latest sample of stats
+	streams    bool            // stream table shown instead of Live Traffic
+	history    bool            // stream table lists closed streams
+	streamSel  int             // stream table cursor into sample.Active
 	width      int
 	height     int
 	eventsCh   <-chan UIEvent
 }
 
 func (m tunnelModel) Init() tea.Cmd {
+	if m.stats != nil {
+		return tea.Batch(waitForTunnelEvent(m.eventsCh), statsTick())
+	}
 	return waitForTunnelEvent(m.eventsCh)
 }
 
 func (m tunnelModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.confirm != nil {
+			switch msg.String() {
+			case "y", "Y":
+				m.confirm <- true
+				m.confirm = nil
+			case "n", "N", "q", "Q", "esc", "ctrl+c":
+				m.confirm <- false
+				m.confirm = nil
+			}
+			return m, nil
+		}
+		if m.inspecting && msg.String() != "q" && msg.String() != "ctrl+c" {
+			return m.updateInspector(msg)
+		}
+		if m.streams && msg.String() != "q" && msg.String() != "ctrl+c" {
+			return m.updateStreams(msg)
+		}
 		switch msg.String() {
+		case "i":
+			m.inspecting = true
+			return m, nil
+		case "s":
+			m.streams = m.stats != nil
+			return m, nil
 		case "q", "Q", "esc", "ctrl+c":
 			return m, tea.Quit
+		case "+", "=":
+			m.limit.SetRate(StepRate(m.limit.Rate(), true))
+			return m, nil
+		case "-", "_":
+			m.limit.SetRate(StepRate(m.limit.Rate(), false))
+			return m, nil
 		}
 
 	case tea.WindowSizeMsg:
@@ -41,9 +93,62 @@ func (m tunnelModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, waitForTunnelEvent(m.eventsCh)
 
 	case TunnelEventMsg:
+		switch msg.Type {
+		case EventPath:
+			m.path = msg.Path
+			return m, waitForTunnelEvent(m.eventsCh)
+		case EventSAS:
+			m.sas = msg.SAS
+			return m, waitForTunnelEvent(m.eventsCh)
+		case EventConfirmSAS:
+			m.sas, m.confirm = msg.SAS, msg.Reply
+			return m, waitForTunnelEvent(m.eventsCh)
+		case EventListen:
+			m.addr = msg.Msg
+			return m, waitForTunnelEvent(m.eventsCh)
+		case EventHTTP:
+			m.addExchange(msg.HTTP)
+			m.appendTraffic(eventToLogLine(UIEvent(msg)))
+			return m, waitForTunnelEvent(m.eventsCh)
+		case EventLinkDown:
+			m.downSince, m.attempt = msg.Since, 0
+			m.appendTraffic(eventToLogLine(UIEvent(msg)))
+			return m, tea.Batch(waitForTunnelEvent(m.eventsCh), linkTick())
+		case EventReconnecting:
+			m.attempt = msg.Attempt
+			return m, waitForTunnelEvent(m.eventsCh)
+		case EventReconnected:
+			m.downtime += time.Since(msg.Since)
+			m.reconnects++
+			m.downSince = time.Time{}
+			m.appendTraffic(eventToLogLine(UIEvent(msg)))
+			return m, waitForTunnelEvent(m.eventsCh)
+		}
 		m.appendTraffic(eventToLogLine(UIEvent(msg)))
 		return m, waitForTunnelEvent(m.eventsCh)
 
+	case replayDoneMsg:
+		if msg.err != nil {
+			m.status = "Replay failed: " + msg.err.Error()
+			return m, nil
+		}
+		m.addExchange(msg.x)
+		m.selected = len(m.exchanges) - 1
+		m.status = "Replayed: " + msg.x.Summary()
+		return m, nil
+
+	case statsTickMsg:
+		m.sample = m.stats.Sample()
+		m.streamSel = min(m.streamSel, max(len(m.sample.Active)-1, 0))
+		return m, statsTick()
+
+	case linkTickMsg:
+		// Redraws the downtime counter; stops once the link is back.
+		if m.downSince.IsZero() {
+			return m, nil
+		}
+		return m, linkTick()
+
 	case tunnelDoneMsg:
 		return m, tea.Quit
 	}
@@ -56,6 +161,12 @@ func eventToLogLine(e UIEvent) string {
 		return lipgloss.NewStyle().Foreground(lipgloss.Color("#3B82F6")).Render("● Client Connected" + optRemote(e.Remote))
 	case EventConnClose:
 		return lipgloss.NewStyle().Foreground(lipgloss.Color("#6B6B6B")).Render("○ Client Disconnected")
+	case EventLinkDown:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("#F25D94")).Render("✕ " + e.Msg)
+	case EventReconnected:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("#43BF6D")).Render("✓ " + e.Msg)
+	case EventHTTP:
+		return exchangeStyle(e.HTTP).Render(e.Msg)
 	case EventTraffic:
 		if e.Info != nil && e.Info.Protocol == "HTTP" {
 			return lipgloss.NewStyle().Foreground(lipgloss.Color("#43BF6D")).Render(e.Msg)
@@ -83,6 +194,33 @@ func (m *tunnelModel) appendTraffic(line string) {
 	}
 }
 
+// linkTickMsg refreshes the view while a reconnecting tunnel is down.
+type linkTickMsg struct{}
+
+func linkTick() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg { return linkTickMsg{} })
+}
+
+// viewLink renders the reconnect status line, or "" for a tunnel that never dropped.
+func (m tunnelModel) viewLink() string {
+	if !m.downSince.IsZero() {
+		s := fmt.Sprintf("Link: down %s, reconnecting", time.Since(m.downSince).Round(time.Second))
+		if m.attempt > 0 {
+			s += fmt.Sprintf(" (attempt %d)", m.attempt)
+		}
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("#F25D94")).Render(s) + "\n"
+	}
+	if m.reconnects == 0 {
+		return ""
+	}
+	plural := "s"
+	if m.reconnects == 1 {
+		plural = ""
+	}
+	return lipgloss.NewStyle().Foreground(uiMuted).Render(fmt.Sprintf("Link: up, %d reconnect%s, %s down in total",
+		m.reconnects, plural, m.downtime.Round(time.Second))) + "\n"
+}
+
 // tunnelDoneMsg is sent when the tunnel event channel is closed.
 type tunnelDoneMsg struct{}
 
@@ -116,8 +254,43 @@ func (m tunnelModel) View() string {
 	b.WriteString(lipgloss.NewStyle().Foreground(uiHighlight).Bold(true).Render(m.code))
 	b.WriteString("\n\n")
 	b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render("Addr: "))
-	b.WriteString(lipgloss.NewStyle().Foreground(uiHighlight).Render(m.addr))
-	b.WriteString("\n\n")
+	if m.addr == "" {
+		b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render("(binding the peer's ports once connected)"))
+	} else {
+		b.WriteString(lipgloss.NewStyle().Foreground(uiHighlight).Render(m.addr))
+	}
+	b.WriteString("\n")
+	if m.path != nil {
+		b.WriteString(renderPath(*m.path))
+		b.WriteString("\n")
+	}
+	if m.sas != nil {
+		b.WriteString(renderSAS(*m.sas))
+		b.WriteString("\n")
+	}
+	b.WriteString(m.viewLink())
+	if m.confirm != nil {
+		b.WriteString("\n")
+		b.WriteString(viewConfirmSAS())
+		return box.Render(b.String())
+	}
+	if m.limit != nil {
+		b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render("Limit: "))
+		b.WriteString(lipgloss.NewStyle().Foreground(uiHighlight).Render(FormatRate(m.limit.Rate())))
+		b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render("  (+/- to adjust)"))
+		b.WriteString("\n")
+	}
+	b.WriteString(m.viewTotals())
+	b.WriteString("\n")
+
+	if m.inspecting {
+		b.WriteString(m.viewInspector())
+		return box.Render(b.String())
+	}
+	if m.streams {
+		b.WriteString(m.viewStreams())
+		return box.Render(b.String())
+	}
 
 	// Live Traffic panel
 	b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render("─── Live Traffic ───"))
@@ -132,17 +305,31 @@ func (m tunnelModel) View() string {
 		}
 	}
 	b.WriteString("\n")
-	b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render("Press q or Esc to exit"))
+	hint := "Press q or Esc to exit"
+	if m.sample.Opened > 0 {
+		hint += ", s for streams"
+	}
+	if len(m.exchanges) > 0 {
+		hint += ", i to inspect HTTP"
+	}
+	b.WriteString(lipgloss.NewStyle().Foreground(uiMuted).Render(hint))
 
 	return box.Render(b.String())
 }
 
 // RunTunnelUI runs the tunnel with a Bubble Tea TUI. fn should block running the tunnel.
 // It creates an event channel, starts fn in a goroutine with opts.Events set,
-// and runs the TUI. When the user quits (q/Esc), the process exits.
+// and runs the TUI. opts.Limit starts unlimited; fn may set its rate and +/- change it.
+// opts.Stats feeds the stream table shown with s.
+// When the user quits (q/Esc), the process exits.
 func RunTunnelUI(role, code, addr string, fn func(opts *TunnelOptions) error) error {
 	ch := make(chan UIEvent, 64)
-	opts := &TunnelOptions{Events: ch}
+	opts := &TunnelOptions{Events: ch, Limit: NewLimiter(0), Stats: NewTunnelStats()}
+	opts.ConfirmSAS = func(s SAS) bool {
+		reply := make(chan bool, 1)
+		ch <- UIEvent{Type: EventConfirmSAS, Msg: s.String(), SAS: &s, Reply: reply}
+		return <-reply
+	}
 
 	go func() {
 		if err := fn(opts); err != nil {
@@ -159,6 +346,8 @@ func RunTunnelUI(role, code, addr string, fn func(opts *TunnelOptions) error) er
 		code:     code,
 		addr:     addr,
 		eventsCh: ch,
+		limit:    opts.Limit,
+		stats:    opts.Stats,
 	}
 
 	p := tea.NewProgram(m, tea.WithAltScreen())
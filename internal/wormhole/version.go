@@ -0,0 +1,162 @@
+package wormhole
+
+import (
+	"fmt"
+	"io"
+	"runtime/debug"
+	"slices"
+
+	"github.com/A-Flex-Box/cli/internal/logger"
+)
+
+// Protocol versions. Bump ProtocolVersion for any change to the record cipher,
+// header formats, payload types or modes that an older peer would misread, and
+// raise MinProtocolVersion when the older form is no longer spoken.
+//
+//	1: AES-GCM records and JSON headers, no Hello (inferred, never sent)
+//	2: Hello exchange after verification
+//	3: tunnels list their ports (TunnelPorts) and each stream names its target
+const (
+	ProtocolVersion    = 3
+	MinProtocolVersion = 2
+)
+
+// tunnelPortsVersion is the first version with multi-port tunnels.
+const tunnelPortsVersion = 3
+
+// CipherAESGCM names the AES-256-GCM record layer (GCMRecordCipher) in a Hello.
+const CipherAESGCM = "aes-256-gcm"
+
+// Capabilities is what both peers agreed on in the Hello exchange.
+type Capabilities struct {
+	Version int           // Protocol version in use: the highest both speak
+	Peer    string        // Peer's software, as it announced it
+	Cipher  string        // Record cipher
+	Comp    []string      // Body compressions both support
+	Types   []PayloadType // Payload types the peer can receive
+	Modes   []int         // Session modes both support
+}
+
+// hasComp reports whether both peers support compression comp.
+func (c Capabilities) hasComp(comp string) bool {
+	return slices.Contains(c.Comp, comp)
+}
+
+// requireType fails if the peer cannot receive payloads of type t.
+func (c Capabilities) requireType(t PayloadType) error {
+	if !slices.Contains(c.Types, t) {
+		return fmt.Errorf("%w: peer (%s, protocol v%d) cannot receive %s payloads; upgrade it", ErrIncompatiblePeer, c.Peer, c.Version, t)
+	}
+	return nil
+}
+
+// requireMode fails if the peer does not support session mode m.
+func (c Capabilities) requireMode(m int, name string) error {
+	if !slices.Contains(c.Modes, m) {
+		return fmt.Errorf("%w: peer (%s, protocol v%d) does not support %s; upgrade it", ErrIncompatiblePeer, c.Peer, c.Version, name)
+	}
+	return nil
+}
+
+// software names this build in a Hello, e.g. "cli v1.4.0".
+func software() string {
+	if bi, ok := debug.ReadBuildInfo(); ok && bi.Main.Version != "" {
+		return "cli " + bi.Main.Version
+	}
+	return "cli"
+}
+
+// localHello lists what this build speaks.
+func localHello() *Hello {
+	return &Hello{
+		Version:    ProtocolVersion,
+		MinVersion: MinProtocolVersion,
+		Software:   software(),
+		Ciphers:    []string{CipherAESGCM},
+		Comp:       []string{CompGzip},
+		Types:      []PayloadType{TypeFile, TypeText, TypeDir, TypeStream},
+		Modes:      []int{ModeFile, ModeTunnel},
+	}
+}
+
+// exchangeHello swaps Hellos over a freshly verified session and agrees on
+// capabilities. The receiver speaks first; the sender always answers, even when
+// it is about to fail, so both sides report the same mismatch.
+func exchangeHello(rw io.ReadWriter, isSender bool) (Capabilities, error) {
+	local := localHello()
+	var peer *Hello
+	var err error
+	if isSender {
+		if peer, err = ReadHello(rw); err != nil {
+			return Capabilities{}, err
+		}
+		if err := WriteHello(rw, local); err != nil {
+			return Capabilities{}, err
+		}
+	} else {
+		if err := WriteHello(rw, local); err != nil {
+			return Capabilities{}, err
+		}
+		if peer, err = ReadHello(rw); err != nil {
+			return Capabilities{}, err
+		}
+	}
+	caps, err := negotiateHello(local, peer)
+	if err != nil {
+		logger.Warn("wormhole.exchangeHello incompatible peer", logger.Context("params", map[string]any{
+			"error": err.Error(), "peer_version": peer.Version, "peer_min": peer.MinVersion, "peer_software": peer.Software,
+		})...)
+		return Capabilities{}, err
+	}
+	logger.Info("wormhole.exchangeHello agreed", logger.Context("result", map[string]any{
+		"version": caps.Version, "peer": caps.Peer, "cipher": caps.Cipher, "comp": caps.Comp,
+	})...)
+	return caps, nil
+}
+
+// negotiateHello picks the highest common version and intersects the rest.
+// A Hello without a version is a version 1 peer's Candidates or PathDecision.
+func negotiateHello(local, peer *Hello) (Capabilities, error) {
+	peerMax, peerMin, peerName := peer.Version, peer.MinVersion, peer.Software
+	if peerMax == 0 {
+		peerMax, peerMin = 1, 1
+	}
+	if peerName == "" {
+		peerName = "an older cli"
+	}
+	v := min(local.Version, peerMax)
+	if v < max(local.MinVersion, peerMin) {
+		return Capabilities{}, fmt.Errorf("%w: this side (%s) speaks protocol %s, the peer (%s) speaks %s; upgrade the older side",
+			ErrIncompatiblePeer, local.Software, versionRange(local.MinVersion, local.Version), peerName, versionRange(peerMin, peerMax))
+	}
+	caps := Capabilities{Version: v, Peer: peerName}
+	for _, c := range local.Ciphers {
+		if slices.Contains(peer.Ciphers, c) {
+			caps.Cipher = c
+			break
+		}
+	}
+	if caps.Cipher == "" {
+		return Capabilities{}, fmt.Errorf("%w: no common record cipher (this side %v, peer %s %v)", ErrIncompatiblePeer, local.Ciphers, peerName, peer.Ciphers)
+	}
+	for _, c := range local.Comp {
+		if slices.Contains(peer.Comp, c) {
+			caps.Comp = append(caps.Comp, c)
+		}
+	}
+	caps.Types = peer.Types
+	for _, m := range local.Modes {
+		if slices.Contains(peer.Modes, m) {
+			caps.Modes = append(caps.Modes, m)
+		}
+	}
+	return caps, nil
+}
+
+// versionRange formats accepted versions, e.g. "v2" or "v2-v3".
+func versionRange(lo, hi int) string {
+	if lo >= hi {
+		return fmt.Sprintf("v%d", hi)
+	}
+	return fmt.Sprintf("v%d-v%d", lo, hi)
+}
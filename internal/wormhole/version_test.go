@@ -0,0 +1,72 @@
+package wormhole
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateHello(t *testing.T) {
+	local := localHello()
+	tests := []struct {
+		name    string
+		peer    *Hello
+		version int
+		errWant []string // substrings of the error; nil means success
+	}{
+		{"same build", localHello(), ProtocolVersion, nil},
+		{"newer peer still speaks ours", &Hello{Version: ProtocolVersion + 1, MinVersion: ProtocolVersion, Software: "cli v9", Ciphers: []string{CipherAESGCM}}, ProtocolVersion, nil},
+		{"newer peer dropped ours", &Hello{Version: ProtocolVersion + 2, MinVersion: ProtocolVersion + 1, Software: "cli v9", Ciphers: []string{CipherAESGCM}}, 0,
+			[]string{"cli v9", versionRange(ProtocolVersion+1, ProtocolVersion+2), versionRange(MinProtocolVersion, ProtocolVersion)}},
+		{"peer before hello", &Hello{}, 0, []string{"an older cli", "v1"}},
+		{"no common cipher", &Hello{Version: ProtocolVersion, MinVersion: ProtocolVersion, Ciphers: []string{"chacha20-poly1305"}}, 0, []string{"cipher"}},
+	}
+	for _, tt := range tests {
+		caps, err := negotiateHello(local, tt.peer)
+		if tt.errWant == nil {
+			if err != nil || caps.Version != tt.version || caps.Cipher != CipherAESGCM {
+				t.Errorf("%s: got %+v, %v; want version %d", tt.name, caps, err, tt.version)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrIncompatiblePeer) {
+			t.Errorf("%s: error = %v, want ErrIncompatiblePeer", tt.name, err)
+			continue
+		}
+		for _, want := range tt.errWant {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: error %q does not mention %q", tt.name, err, want)
+			}
+		}
+	}
+
+	// Only what both sides support is used.
+	caps, err := negotiateHello(local, &Hello{Version: ProtocolVersion, MinVersion: ProtocolVersion,
+		Ciphers: []string{CipherAESGCM}, Types: []PayloadType{TypeFile, TypeText}, Modes: []int{ModeFile}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.hasComp(CompGzip) || caps.requireType(TypeStream) == nil || caps.requireMode(ModeTunnel, "tunnels") == nil {
+		t.Errorf("capabilities %+v include features the peer lacks", caps)
+	}
+	if offerComp(nil, caps, false) != "" {
+		t.Error("offerComp proposed gzip to a peer without it")
+	}
+}
+
+func TestHelloRefusesPreHelloPeer(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	// A receiver from before the exchange sends Candidates where a Hello goes,
+	// then waits for the PathDecision.
+	go func() {
+		WriteCandidates(b, &Candidates{Addrs: []string{"192.0.2.1:4000"}, Secret: "s"})
+		ReadPathDecision(b)
+	}()
+	_, err := exchangeHello(a, true)
+	if !errors.Is(err, ErrIncompatiblePeer) || !strings.Contains(err.Error(), "v1") {
+		t.Fatalf("exchangeHello() error = %v, want ErrIncompatiblePeer naming v1", err)
+	}
+}
@@ -0,0 +1,52 @@
+package wormhole
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/A-Flex-Box/cli/internal/logger"
+	"github.com/coder/websocket"
+)
+
+// DefaultWebSocketPath is the relay's WebSocket endpoint when the address has no path.
+const DefaultWebSocketPath = "/wormhole"
+
+// dialWebSocket opens a binary WebSocket to the relay and returns it as a
+// net.Conn. The proxy comes from HTTPS_PROXY / HTTP_PROXY / NO_PROXY.
+func (ep *relayEndpoint) dialWebSocket(d *net.Dialer) (net.Conn, error) {
+	u := url.URL{Scheme: ep.scheme, Host: ep.addr, Path: ep.path}
+	tr := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         d.DialContext,
+		TLSClientConfig:     ep.tlsConfig(),
+		TLSHandshakeTimeout: relayDialTimeout,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), relayDialTimeout)
+	defer cancel()
+	c, _, err := websocket.Dial(ctx, u.String(), &websocket.DialOptions{HTTPClient: &http.Client{Transport: tr}})
+	if err != nil {
+		return nil, err
+	}
+	return websocket.NetConn(context.Background(), c, websocket.MessageBinary), nil
+}
+
+// WebSocketHandler accepts WebSocket upgrades at any path and hands the
+// resulting binary stream to HandleConn, so ws:// clients pair with tcp:// ones.
+func (r *RelayServer) WebSocketHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// Origin checks protect cookie-authenticated browser sessions; relay
+		// clients are not browsers and the payload is end-to-end encrypted.
+		c, err := websocket.Accept(w, req, &websocket.AcceptOptions{InsecureSkipVerify: true})
+		if err != nil {
+			logger.Warn("relay.WebSocket accept failed", logger.Context("params", map[string]any{
+				"remote": req.RemoteAddr, "error": err.Error(),
+			})...)
+			return
+		}
+		// The conn outlives the handler for the matching arrival, so it must
+		// not be bound to the request context.
+		r.HandleConn(websocket.NetConn(context.Background(), c, websocket.MessageBinary))
+	})
+}
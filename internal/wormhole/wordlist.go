@@ -0,0 +1,32 @@
+package wormhole
+
+// codeWords is the built-in wordlist for pairing codes: 256 short, distinct,
+// easy-to-type words, so each word adds 8 bits of entropy.
+var codeWords = [256]string{
+	"acid", "acorn", "actor", "adobe", "agent", "alarm", "album", "alert", "algae", "alien", "amber",
+	"anchor", "angle", "ankle", "apple", "april", "apron", "arena", "armor", "arrow", "aspen",
+	"atlas", "attic", "audio", "autumn", "avocado", "badge", "bagel", "baker", "bamboo", "banana",
+	"banjo", "barley", "basil", "basin", "beacon", "beetle", "bench", "berry", "bingo", "bison",
+	"blade", "blanket", "blossom", "boat", "bonsai", "border", "bottle", "boxer", "branch", "bread",
+	"breeze", "brick", "bridge", "broom", "bubble", "bucket", "buffalo", "bugle", "butter", "cabin",
+	"cactus", "camel", "candle", "canoe", "canyon", "carbon", "cargo", "carpet", "carrot", "castle",
+	"cedar", "cello", "chalk", "cherry", "chess", "circus", "citrus", "clover", "cobalt", "cocoa",
+	"comet", "copper", "coral", "cotton", "cougar", "coyote", "crater", "crayon", "cricket",
+	"crystal", "cupcake", "dahlia", "daisy", "delta", "denim", "desert", "diesel", "dingo", "dolphin",
+	"domino", "donkey", "dragon", "drum", "eagle", "easel", "echo", "eclipse", "elbow", "elephant",
+	"ember", "emerald", "engine", "falcon", "feather", "fennel", "ferry", "fiddle", "finch", "fjord",
+	"flamingo", "flute", "forest", "fossil", "fox", "galaxy", "garlic", "gazelle", "gecko", "geyser",
+	"ginger", "giraffe", "glacier", "globe", "gopher", "granite", "grape", "gravel", "guitar",
+	"hammer", "harbor", "harp", "hazel", "helmet", "heron", "hickory", "honey", "horizon", "husky",
+	"iceberg", "igloo", "indigo", "iris", "island", "ivory", "jacket", "jaguar", "jasmine", "jelly",
+	"jigsaw", "jungle", "kayak", "kernel", "kettle", "kiwi", "koala", "ladder", "lagoon", "lantern",
+	"laser", "lemon", "leopard", "lilac", "lime", "linen", "lizard", "llama", "lobster", "lotus",
+	"magnet", "mango", "maple", "marble", "meadow", "melon", "meteor", "mint", "mirror", "mocha",
+	"monsoon", "moose", "mosaic", "mustard", "nectar", "needle", "nickel", "noodle", "nutmeg",
+	"oasis", "ocean", "olive", "onion", "opal", "orbit", "orchid", "otter", "oyster", "paddle",
+	"panda", "papaya", "parrot", "peach", "pebble", "pelican", "pepper", "piano", "pickle", "pilot",
+	"pine", "pixel", "planet", "plum", "pocket", "polar", "poppy", "prism", "pumpkin", "quartz",
+	"quill", "rabbit", "radar", "radish", "raven", "reef", "ribbon", "river", "rocket", "saddle",
+	"saffron", "salmon", "sapphire", "satin", "sierra", "silver", "spruce", "squid", "summit",
+	"sunset", "swan", "tango", "teapot", "thistle", "thunder", "tiger", "tomato", "topaz",
+}